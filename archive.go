@@ -0,0 +1,86 @@
+package comgo
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Returns a reader over rd that transparently decompresses gzip content
+// COMTRADE files never start with the gzip magic number
+func decompress(rd io.Reader) (*bufio.Reader, error) {
+	br := bufio.NewReader(rd)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(zr), nil
+	}
+	return br, nil
+}
+
+// Reads rd until EOF, decompressing gzip content
+func readAll(rd io.Reader) ([]byte, error) {
+	br, err := decompress(rd)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(br)
+}
+
+// OpenZip reads every record stored in the zip archive name
+func OpenZip(name string) ([]*Record, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return readZip(&zr.Reader)
+}
+
+// ReadZip reads every record stored in a zip archive of the given size
+// records are paired by name inside the archive, whatever folder they are in
+func ReadZip(r io.ReaderAt, size int64) ([]*Record, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return readZip(zr)
+}
+
+func readZip(zr *zip.Reader) ([]*Record, error) {
+	var records []*Record
+	seen := make(map[string]bool)
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		// Each record is found through its configuration or combined file
+		name := strings.TrimSuffix(strings.ToLower(file.Name), ".gz")
+		ext := path.Ext(name)
+		if ext != ExtCFG && ext != ExtCFF {
+			continue
+		}
+		base := strings.TrimSuffix(name, ext)
+		if seen[base] {
+			continue
+		}
+		seen[base] = true
+
+		rec, err := OpenFS(zr, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no record found in zip archive")
+	}
+	return records, nil
+}
@@ -0,0 +1,99 @@
+package comgo
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// Returns a zip archive holding files, in the given order
+func testZip(t *testing.T, files [][2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := zw.Create(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(file[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadZip(t *testing.T) {
+	cfg := fmt.Sprintf(testDatCFG, FileTypeASCII)
+	dat := "1,0,10,0\n2,1000,,0\n3,2000,-4,1\n"
+	content := testZip(t, [][2]string{
+		{"events/", ""},
+		{"events/North.CFG", cfg},
+		{"events/north.DAT", dat},
+		{"events/north.HDR", "header\n"},
+		{"events/2020/deep.cfg.GZ", string(gzipped(t, []byte(cfg)))},
+		{"events/2020/Deep.dat.Gz", string(gzipped(t, []byte(dat)))},
+		{"combined.cff", "--- file type: CFG ---\n" + cfg + "--- file type: DAT ASCII ---\n" + dat},
+		{"readme.txt", "not a record\n"},
+	})
+
+	dir, err := ioutil.TempDir("", "zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "records.zip")
+	if err := ioutil.WriteFile(name, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, open := range []struct {
+		name string
+		read func() ([]*Record, error)
+	}{
+		{"ReadZip", func() ([]*Record, error) { return ReadZip(bytes.NewReader(content), int64(len(content))) }},
+		{"OpenZip", func() ([]*Record, error) { return OpenZip(name) }},
+	} {
+		records, err := open.read()
+		if err != nil {
+			t.Fatalf("%s: %v", open.name, err)
+		}
+		var names []string
+		for _, rec := range records {
+			names = append(names, rec.Name)
+			values, err := rec.GetAnalogChannelData(1)
+			if err != nil {
+				t.Fatalf("%s: %s: %v", open.name, rec.Name, err)
+			}
+			assertFloats(t, rec.Name, values, []float64{6, math.NaN(), -1}, 1e-12)
+		}
+		sort.Strings(names)
+		if want := fmt.Sprint([]string{"combined", "events/2020/deep", "events/North"}); fmt.Sprint(names) != want {
+			t.Errorf("%s: got records %v, want %s", open.name, names, want)
+		}
+		for _, rec := range records {
+			if rec.Name == "events/North" && string(rec.Header) != "header\n" {
+				t.Errorf("%s: got header %q", open.name, rec.Header)
+			}
+		}
+	}
+
+	// A configuration without its data file fails the whole archive
+	content = testZip(t, [][2]string{{"a.cfg", cfg}, {"b.cfg", cfg}, {"b.dat", dat}})
+	if _, err := ReadZip(bytes.NewReader(content), int64(len(content))); err == nil {
+		t.Error("read an archive with a record lacking its data file")
+	}
+	content = testZip(t, [][2]string{{"readme.txt", ""}})
+	if _, err := ReadZip(bytes.NewReader(content), int64(len(content))); err == nil {
+		t.Error("read an archive without records")
+	}
+}
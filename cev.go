@@ -0,0 +1,313 @@
+package comgo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings of the relay naming the terminal and the relay in a SEL event report
+var (
+	selTerminalID = regexp.MustCompile(`\bTID\s*=\s*(\S+(?: \S+)*)`)
+	selRelayID    = regexp.MustCompile(`\bRID\s*=\s*(\S+(?: \S+)*)`)
+)
+
+// Units of SEL analog channels given in the channel name, e.g. "VA(kV)"
+var selUnit = regexp.MustCompile(`^(.*)\((.+)\)$`)
+
+/*
+ * cevLine - A line of a compressed event report
+ * @number: Line number in the file
+ * @fields: Fields without the checksum
+ */
+type cevLine struct {
+	number int
+	fields []string
+}
+
+// Splits a compressed event report into lines and checks the checksum closing each line:
+// the sum of the line bytes preceding the checksum field, as 4 hexadecimal digits
+func splitCEV(content []byte) ([]cevLine, error) {
+	var lines []cevLine
+	for i, raw := range bytes.Split(content, []byte("\n")) {
+		// Reports sent by the relay are framed by STX and ETX
+		raw = bytes.TrimSpace(bytes.Trim(raw, "\x02\x03\x1a\r"))
+		if len(raw) == 0 {
+			continue
+		}
+		r := csv.NewReader(bytes.NewReader(raw))
+		r.LazyQuotes = true
+		fields, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("cev format error: line %d: %v", i+1, err)
+		}
+		comma := bytes.LastIndexByte(raw, ',')
+		if len(fields) < 2 || comma < 0 {
+			return nil, fmt.Errorf("cev format error: line %d has no checksum", i+1)
+		}
+		checksum, err := strconv.ParseUint(strings.TrimSpace(fields[len(fields)-1]), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("cev format error: line %d: invalid checksum %q", i+1, fields[len(fields)-1])
+		}
+		var sum uint16
+		for _, c := range raw[:comma+1] {
+			sum += uint16(c)
+		}
+		if uint64(sum) != checksum {
+			return nil, fmt.Errorf("cev checksum error: line %d: got %04X, expected %04X", i+1, sum, checksum)
+		}
+		lines = append(lines, cevLine{number: i + 1, fields: fields[:len(fields)-1]})
+	}
+	return lines, nil
+}
+
+// Returns the value of the header field named name, the header names being on the
+// line before the values
+func cevHeader(lines []cevLine, name string) (string, bool) {
+	for i := 0; i+1 < len(lines); i++ {
+		for j, field := range lines[i].fields {
+			if strings.EqualFold(strings.TrimSpace(field), name) && j < len(lines[i+1].fields) {
+				return strings.TrimSpace(lines[i+1].fields[j]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns the phase of a SEL channel from its name, e.g. "A" for "IA" or "VA"
+func selPhase(name string) string {
+	name = strings.ToUpper(name)
+	if len(name) != 2 || (name[0] != 'I' && name[0] != 'V') {
+		return ""
+	}
+	switch name[1] {
+	case 'A', 'B', 'C':
+		return name[1:]
+	case 'N', 'G':
+		return "N"
+	}
+	return ""
+}
+
+// OpenCEV reads the SEL compressed event report name, see ReadCEV
+func OpenCEV(name string) (*Record, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rec, err := ReadCEV(f)
+	if err != nil {
+		return nil, err
+	}
+	rec.Name = strings.TrimSuffix(name, ".gz")
+	rec.Name = strings.TrimSuffix(rec.Name, filepath.Ext(rec.Name))
+	return rec, nil
+}
+
+// ReadCEV reads a SEL compressed event report (.cev) and checks the checksum of every line.
+// Analog channels precede the trigger column of the data section, the relay word bits
+// named in the last column are digital channels. The event time stamp is the time of the
+// row marked ">" in the trigger column, or "*" without such a row, the sampling rate is the line frequency times the samples per cycle. The lines
+// preceding the data section and the settings following it are kept as header file.
+func ReadCEV(rd io.Reader) (*Record, error) {
+	content, err := readAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := splitCEV(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// The data section starts with the channel names, the trigger column among them
+	names := -1
+	trigger := -1
+	for i, line := range lines {
+		for j, field := range line.fields {
+			if strings.EqualFold(strings.TrimSpace(field), "TRIGGER") {
+				names, trigger = i, j
+				break
+			}
+		}
+		if names >= 0 {
+			break
+		}
+	}
+	if names < 0 {
+		return nil, errors.New("cev format error: data section not found")
+	}
+	if trigger == 0 {
+		return nil, errors.New("cev format error: no analog channel in data section")
+	}
+	nameFields := lines[names].fields
+	var bitNames []string
+	if trigger+1 < len(nameFields) {
+		bitNames = strings.Fields(nameFields[trigger+1])
+	}
+
+	// Header fields
+	number := func(name string) (float64, error) {
+		value, ok := cevHeader(lines[:names], name)
+		if !ok {
+			return 0, fmt.Errorf("cev format error: missing %s", name)
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cev format error: invalid %s %q", name, value)
+		}
+		return f, nil
+	}
+	frequency, err := number("FREQ")
+	if err != nil {
+		return nil, err
+	}
+	perCycle, err := number("SAM/CYC_A")
+	if err != nil {
+		return nil, err
+	}
+	if frequency <= 0 || perCycle <= 0 {
+		return nil, fmt.Errorf("cev format error: invalid sampling %g samples per cycle at %g Hz", perCycle, frequency)
+	}
+	var stamp [7]int
+	for i, name := range []string{"MONTH", "DAY", "YEAR", "HOUR", "MIN", "SEC", "MSEC"} {
+		value, err := number(name)
+		if err != nil {
+			return nil, err
+		}
+		stamp[i] = int(value)
+	}
+	triggerTime := time.Date(stamp[2], time.Month(stamp[0]), stamp[1], stamp[3], stamp[4], stamp[5], stamp[6]*int(time.Millisecond), time.UTC)
+
+	// Data rows run until the first line that is not a sample, e.g. the settings
+	analog := make([][]float64, trigger)
+	digital := make([][]uint8, len(bitNames))
+	triggerRow, faultRow := -1, -1
+	end := names + 1
+	for ; end < len(lines); end++ {
+		fields := lines[end].fields
+		if len(fields) < trigger+1 {
+			break
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64); err != nil {
+			break
+		}
+		row := end - names - 1
+		for ch := 0; ch < trigger; ch++ {
+			value, err := strconv.ParseFloat(strings.TrimSpace(fields[ch]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("cev format error: line %d channel %s: %v", lines[end].number, nameFields[ch], err)
+			}
+			analog[ch] = append(analog[ch], value)
+		}
+		switch strings.TrimSpace(fields[trigger]) {
+		case ">":
+			if triggerRow < 0 {
+				triggerRow = row
+			}
+		case "*":
+			if faultRow < 0 {
+				faultRow = row
+			}
+		}
+		var bits string
+		if trigger+1 < len(fields) {
+			bits = strings.TrimSpace(fields[trigger+1])
+		}
+		for ch := range bitNames {
+			var state uint8
+			if digit := ch / 4; digit < len(bits) {
+				nibble, err := strconv.ParseUint(bits[digit:digit+1], 16, 8)
+				if err != nil {
+					return nil, fmt.Errorf("cev format error: line %d: invalid relay word bits %q", lines[end].number, bits)
+				}
+				state = uint8(nibble>>uint(3-ch%4)) & 1
+			}
+			digital[ch] = append(digital[ch], state)
+		}
+	}
+	if end == names+1 {
+		return nil, errors.New("cev format error: no sample in data section")
+	}
+	// Without a trigger row, the row marked for the fault calculation stands for it
+	if triggerRow < 0 {
+		triggerRow = faultRow
+	}
+	if triggerRow < 0 {
+		triggerRow = 0
+	}
+
+	cfg := NewCFG()
+	if fid, ok := cevHeader(lines[:names], "FID"); ok {
+		cfg.RecordDeviceId = strings.TrimPrefix(fid, "FID=")
+	}
+	var header bytes.Buffer
+	for _, line := range append(append([]cevLine{}, lines[:names]...), lines[end:]...) {
+		header.WriteString(strings.Join(line.fields, ","))
+		header.WriteString("\r\n")
+	}
+	if m := selTerminalID.FindStringSubmatch(header.String()); m != nil {
+		cfg.StationName = strings.TrimSpace(m[1])
+	}
+	if m := selRelayID.FindStringSubmatch(header.String()); m != nil {
+		cfg.RecordDeviceId = strings.TrimSpace(m[1])
+	}
+	cfg.RevisionYear = 2013
+	cfg.DataFileType = FileTypeFloat32
+	cfg.LineFrequency = uint16(math.Round(frequency))
+	rate := frequency * perCycle
+	cfg.SampleDetail = []SampleRate{{Rate: rate, Number: len(analog[0])}}
+	cfg.TriggerTime = triggerTime
+	cfg.StartTime = triggerTime.Add(-time.Duration(math.Round(float64(triggerRow) / rate * 1e9)))
+	cfg.AnalogDetail, cfg.DigitDetail = &ChannelA{}, &ChannelD{}
+
+	for ch := 0; ch < trigger; ch++ {
+		name, unit := strings.TrimSpace(nameFields[ch]), ""
+		if m := selUnit.FindStringSubmatch(name); m != nil {
+			name, unit = strings.TrimSpace(m[1]), m[2]
+		}
+		if unit == "" {
+			switch {
+			case strings.HasPrefix(strings.ToUpper(name), "I"):
+				unit = "A"
+			case strings.HasPrefix(strings.ToUpper(name), "V"):
+				unit = "V"
+			case strings.EqualFold(name, "FREQ"):
+				unit = "Hz"
+			}
+		}
+		cfg.AnalogDetail.AddChannel(AnalogChannel{
+			Number:       uint16(ch + 1),
+			Name:         normalizeChannelName(name),
+			OriginalName: name,
+			Phase:        selPhase(name),
+			Unit:         unit,
+		})
+	}
+	for ch, name := range bitNames {
+		cfg.DigitDetail.AddChannel(DigitalChannel{
+			Number:       uint16(ch + 1),
+			Name:         normalizeChannelName(name),
+			OriginalName: name,
+			InitialState: digital[ch][0],
+		})
+	}
+
+	times := make([]float64, len(analog[0]))
+	for i := range times {
+		times[i] = float64(i) / rate
+	}
+	if err := cfg.SetSamples(times, analog, digital); err != nil {
+		return nil, err
+	}
+	return &Record{CFG: &cfg, Header: header.Bytes()}, nil
+}
@@ -0,0 +1,165 @@
+package comgo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns line followed by its SEL checksum field
+func withCEVChecksum(line string) string {
+	var sum uint16
+	for _, c := range []byte(line + ",") {
+		sum += uint16(c)
+	}
+	return fmt.Sprintf(`%s,"%04X"`, line, sum)
+}
+
+// testdata/event.cev is a 4 samples per cycle report at 60 Hz triggered on its fourth row
+// on 2024-03-14 at 10:22:33.250, relay word bits 51P, 51G, TRIP, OUT101 and IN101 set from there
+func TestReadCEV(t *testing.T) {
+	rec, err := OpenCEV("testdata/event.cev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Name != "testdata/event" || rec.GetStationName() != "NORTH SUBSTATION" || rec.GetRecordDeviceId() != "FEEDER 1 RELAY" {
+		t.Errorf("got name %q station %q device %q", rec.Name, rec.GetStationName(), rec.GetRecordDeviceId())
+	}
+	if rec.GetLineFrequency() != 60 || rec.GetSamplingRate() != 240 || rec.GetSamplingNumber() != 8 {
+		t.Errorf("got %d Hz, %g samples/s, %d samples", rec.GetLineFrequency(), rec.GetSamplingRate(), rec.GetSamplingNumber())
+	}
+	trigger := time.Date(2024, 3, 14, 10, 22, 33, 250000000, time.UTC)
+	if !rec.GetTriggerTime().Equal(trigger) {
+		t.Errorf("got trigger time %v, want %v", rec.GetTriggerTime(), trigger)
+	}
+	if start := trigger.Add(-12500 * time.Microsecond); !rec.GetStartTime().Equal(start) {
+		t.Errorf("got start time %v, want %v", rec.GetStartTime(), start)
+	}
+	if !bytes.Contains(rec.Header, []byte("SETTINGS")) || !bytes.Contains(rec.Header, []byte("FREQ")) {
+		t.Errorf("got header %q", rec.Header)
+	}
+
+	var names []string
+	for _, ch := range rec.GetAnalogChannels() {
+		names = append(names, ch.Name+"/"+ch.Phase+"/"+ch.Unit)
+	}
+	if got, want := strings.Join(names, " "), "IA/A/A IB/B/A IC/C/A IN/N/A VA/A/kV VB/B/kV VC/C/kV FREQ//Hz"; got != want {
+		t.Errorf("got analog channels %s, want %s", got, want)
+	}
+	for _, tc := range []struct {
+		num  uint16
+		want []float64
+	}{
+		{1, []float64{0, 100, 0, -100, 0, 100, 0, -100}},
+		{5, []float64{66, 0, -66, 0, 66, 0, -66, 0}},
+		{8, []float64{60, 60, 60, 60, 60, 60, 60, 60}},
+	} {
+		values, err := rec.GetAnalogChannelData(tc.num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFloats(t, fmt.Sprint("analog channel ", tc.num), values, tc.want, 1e-6)
+	}
+
+	names = names[:0]
+	for _, ch := range rec.GetDigitalChannels() {
+		names = append(names, ch.Name)
+	}
+	if got := strings.Join(names, " "); got != "51P 51G TRIP OUT101 IN101" {
+		t.Errorf("got digital channels %s", got)
+	}
+	for num := uint16(1); num <= 5; num++ {
+		states, err := rec.GetDigitalChannelData(num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []uint8{0, 0, 0, 1, 1, 1, 1, 1}; !bytes.Equal(states, want) {
+			t.Errorf("got digital channel %d %v, want %v", num, states, want)
+		}
+	}
+}
+
+func TestReadCEVTriggerRow(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/event.cev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(content), "\n")
+	row := func(i int) int {
+		for j, line := range lines {
+			if strings.Contains(line, `"TRIGGER"`) {
+				return j + 1 + i
+			}
+		}
+		t.Fatal("no data section")
+		return 0
+	}
+	// Moves the trigger mark to data row i
+	mark := func(i int, marker string) {
+		for j := row(0); j < row(8); j++ {
+			line := strings.TrimRight(lines[j], "\r")
+			fields := strings.Split(line, ",")
+			fields[8] = `""`
+			if j == row(i) {
+				fields[8] = `"` + marker + `"`
+			}
+			lines[j] = withCEVChecksum(strings.Join(fields[:len(fields)-1], ","))
+		}
+	}
+
+	trigger := time.Date(2024, 3, 14, 10, 22, 33, 250000000, time.UTC)
+	for _, tc := range []struct {
+		marker string
+		row    int
+	}{
+		{">", 5},
+		{"*", 2},
+		{"", 0},
+	} {
+		mark(tc.row, tc.marker)
+		rec, err := ReadCEV(strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := trigger.Add(-time.Duration(math.Round(float64(tc.row) / 240 * 1e9)))
+		if !rec.GetStartTime().Equal(start) || !rec.GetTriggerTime().Equal(trigger) {
+			t.Errorf("trigger marked %q on row %d: got start %v and trigger %v, want %v and %v",
+				tc.marker, tc.row, rec.GetStartTime(), rec.GetTriggerTime(), start, trigger)
+		}
+	}
+
+	// The trigger row wins over the fault row
+	mark(6, "*")
+	line := strings.Split(lines[row(1)], ",")
+	line[8] = `">"`
+	lines[row(1)] = withCEVChecksum(strings.Join(line[:len(line)-1], ","))
+	rec, err := ReadCEV(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start := trigger.Add(-time.Duration(math.Round(1e9 / 240))); !rec.GetStartTime().Equal(start) {
+		t.Errorf("got start %v, want %v", rec.GetStartTime(), start)
+	}
+}
+
+func TestReadCEVChecksum(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/event.cev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One digit of the first sample changed
+	corrupted := bytes.Replace(content, []byte("0,-87,87,0,66.0"), []byte("0,-88,87,0,66.0"), 1)
+	if bytes.Equal(corrupted, content) {
+		t.Fatal("sample not found")
+	}
+	if _, err := ReadCEV(bytes.NewReader(corrupted)); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("got %v, want a checksum error", err)
+	}
+	if _, err := ReadCEV(strings.NewReader(withCEVChecksum(`"FID"`) + "\n")); err == nil {
+		t.Error("read a report without data section")
+	}
+}
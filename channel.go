@@ -0,0 +1,464 @@
+package comgo
+
+import (
+	"fmt"
+)
+
+/*
+ * AnalogChannel - Parameters of one analog channel
+ * @Index: Position of the channel in the .cfg file, as used by GetAnalogChannelData
+ * @Number: Channel index number as written in the .cfg file
+ * @Name: Channel name with spaces replaced by underscores
+ * @OriginalName: Channel name as written in the .cfg file
+ * @Phase: Phase identification
+ * @Element: Circuit component being monitored (ccbm)
+ * @Unit: Channel units
+ * @FactorA: Conversion factor A
+ * @FactorB: Conversion factor B
+ * @TimeFactor: Time skew between channels in microseconds
+ * @ValueMin: Min Value of the channel
+ * @ValueMax: Max Value of the channel
+ * @Primary: Primary ratio
+ * @Secondary: Secondary ratio
+ * @HasRatio: Whether primary and secondary ratios are present
+ * @IsSecondaryMeasurement: Whether values are recorded on the secondary side (PS flag)
+ */
+type AnalogChannel struct {
+	Index                  uint16
+	Number                 uint16
+	Name                   string
+	OriginalName           string
+	Phase                  string
+	Element                string
+	Unit                   string
+	FactorA                float64
+	FactorB                float64
+	TimeFactor             float64
+	ValueMin               int
+	ValueMax               int
+	Primary                float64
+	Secondary              float64
+	HasRatio               bool
+	IsSecondaryMeasurement bool
+}
+
+func (m *AnalogChannel) GetIndex() uint16 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetNumber() uint16 {
+	if m != nil {
+		return m.Number
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *AnalogChannel) GetOriginalName() string {
+	if m != nil {
+		return m.OriginalName
+	}
+	return ""
+}
+
+func (m *AnalogChannel) GetPhase() string {
+	if m != nil {
+		return m.Phase
+	}
+	return ""
+}
+
+func (m *AnalogChannel) GetElement() string {
+	if m != nil {
+		return m.Element
+	}
+	return ""
+}
+
+func (m *AnalogChannel) GetUnit() string {
+	if m != nil {
+		return m.Unit
+	}
+	return ""
+}
+
+func (m *AnalogChannel) GetFactorA() float64 {
+	if m != nil {
+		return m.FactorA
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetFactorB() float64 {
+	if m != nil {
+		return m.FactorB
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetTimeFactor() float64 {
+	if m != nil {
+		return m.TimeFactor
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetValueMin() int {
+	if m != nil {
+		return m.ValueMin
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetValueMax() int {
+	if m != nil {
+		return m.ValueMax
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetPrimary() float64 {
+	if m != nil {
+		return m.Primary
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetSecondary() float64 {
+	if m != nil {
+		return m.Secondary
+	}
+	return 0
+}
+
+func (m *AnalogChannel) GetHasRatio() bool {
+	if m != nil {
+		return m.HasRatio
+	}
+	return false
+}
+
+func (m *AnalogChannel) GetIsSecondaryMeasurement() bool {
+	if m != nil {
+		return m.IsSecondaryMeasurement
+	}
+	return false
+}
+
+// Returns the factor to apply to recorded values of the channel
+// so that they are expressed in the requested scaling
+func (m *AnalogChannel) GetScaleFactor(scaling Scaling) (float64, error) {
+	if scaling == ScaleRecorded || scaling == ScaleRaw {
+		return 1, nil
+	}
+	if scaling != ScalePrimary && scaling != ScaleSecondary {
+		return 0, fmt.Errorf("unknown scaling mode %d", scaling)
+	}
+	if !m.GetHasRatio() {
+		return 0, fmt.Errorf("primary/secondary ratio not available for analog channel %d", m.GetIndex())
+	}
+	primary, secondary := m.GetPrimary(), m.GetSecondary()
+	if primary == 0 || secondary == 0 {
+		return 0, fmt.Errorf("invalid primary/secondary ratio %g/%g for analog channel %d", primary, secondary, m.GetIndex())
+	}
+	switch {
+	case scaling == ScalePrimary && m.GetIsSecondaryMeasurement():
+		return primary / secondary, nil
+	case scaling == ScaleSecondary && !m.GetIsSecondaryMeasurement():
+		return secondary / primary, nil
+	}
+	return 1, nil
+}
+
+// Returns the PS flag as written in the .cfg file
+func (m *AnalogChannel) GetPS() string {
+	if m.GetIsSecondaryMeasurement() {
+		return "S"
+	}
+	return "P"
+}
+
+/*
+ * DigitalChannel - Parameters of one digital channel
+ * @Index: Position of the channel in the .cfg file
+ * @Number: Channel index number as written in the .cfg file
+ * @Name: Channel name with spaces replaced by underscores
+ * @OriginalName: Channel name as written in the .cfg file
+ * @Phase: Phase identification
+ * @Element: Circuit component being monitored (ccbm)
+ * @InitialState: Normal state of the channel, 2 when not given
+ */
+type DigitalChannel struct {
+	Index        uint16
+	Number       uint16
+	Name         string
+	OriginalName string
+	Phase        string
+	Element      string
+	InitialState uint8
+}
+
+func (m *DigitalChannel) GetIndex() uint16 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *DigitalChannel) GetNumber() uint16 {
+	if m != nil {
+		return m.Number
+	}
+	return 0
+}
+
+func (m *DigitalChannel) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *DigitalChannel) GetOriginalName() string {
+	if m != nil {
+		return m.OriginalName
+	}
+	return ""
+}
+
+func (m *DigitalChannel) GetPhase() string {
+	if m != nil {
+		return m.Phase
+	}
+	return ""
+}
+
+func (m *DigitalChannel) GetElement() string {
+	if m != nil {
+		return m.Element
+	}
+	return ""
+}
+
+func (m *DigitalChannel) GetInitialState() uint8 {
+	if m != nil {
+		return m.InitialState
+	}
+	return 0
+}
+
+// Appends ch to the channel list and keeps the per field slices in step
+func (m *ChannelA) appendChannel(ch AnalogChannel) {
+	if m.ConversionFactors == nil {
+		m.ConversionFactors = make(map[string][]float64)
+	}
+	m.Channels = append(m.Channels, ch)
+	m.ChannelNumber = append(m.ChannelNumber, ch.Number)
+	m.ChannelNames = append(m.ChannelNames, ch.Name)
+	m.OriginalNames = append(m.OriginalNames, ch.OriginalName)
+	m.ChannelPhases = append(m.ChannelPhases, ch.Phase)
+	m.ChannelElements = append(m.ChannelElements, ch.Element)
+	m.ChannelUnits = append(m.ChannelUnits, ch.Unit)
+	m.ConversionFactors["a"] = append(m.ConversionFactors["a"], ch.FactorA)
+	m.ConversionFactors["b"] = append(m.ConversionFactors["b"], ch.FactorB)
+	m.TimeFactors = append(m.TimeFactors, ch.TimeFactor)
+	m.ValueMin = append(m.ValueMin, ch.ValueMin)
+	m.ValueMax = append(m.ValueMax, ch.ValueMax)
+	m.Primary = append(m.Primary, ch.Primary)
+	m.Secondary = append(m.Secondary, ch.Secondary)
+	m.IsSecondaryMeasurement = append(m.IsSecondaryMeasurement, ch.IsSecondaryMeasurement)
+}
+
+// Adds an analog channel after the existing ones
+// ch.Index is assigned from its position
+func (m *ChannelA) AddChannel(ch AnalogChannel) {
+	m.ChannelTotal++
+	ch.Index = m.ChannelTotal
+	m.appendChannel(ch)
+}
+
+// Appends ch to the channel list and keeps the per field slices in step
+func (m *ChannelD) appendChannel(ch DigitalChannel) {
+	m.Channels = append(m.Channels, ch)
+	m.ChannelNumber = append(m.ChannelNumber, ch.Number)
+	m.ChannelNames = append(m.ChannelNames, ch.Name)
+	m.OriginalNames = append(m.OriginalNames, ch.OriginalName)
+	m.ChannelPhases = append(m.ChannelPhases, ch.Phase)
+	m.ChannelElements = append(m.ChannelElements, ch.Element)
+	m.InitialState = append(m.InitialState, ch.InitialState)
+}
+
+// Replaces the channels, the per field slices included
+func (m *ChannelA) setChannels(channels []AnalogChannel) {
+	*m = ChannelA{ChannelTotal: uint16(len(channels))}
+	for _, ch := range channels {
+		m.appendChannel(ch)
+	}
+}
+
+// Replaces the channels, the per field slices included
+func (m *ChannelD) setChannels(channels []DigitalChannel) {
+	*m = ChannelD{ChannelTotal: uint16(len(channels))}
+	for _, ch := range channels {
+		m.appendChannel(ch)
+	}
+}
+
+// Adds a digital channel after the existing ones
+// ch.Index is assigned from its position
+func (m *ChannelD) AddChannel(ch DigitalChannel) {
+	m.ChannelTotal++
+	ch.Index = m.ChannelTotal
+	m.appendChannel(ch)
+}
+
+// Returns the channels described by the per field slices, for a ChannelA filled
+// without AddChannel. Ratios are only set for channels with both a primary and a secondary
+func (m *ChannelA) channelsOfSlices() []AnalogChannel {
+	float := func(values []float64, i int) float64 {
+		if i < len(values) {
+			return values[i]
+		}
+		return 0
+	}
+	str := func(values []string, i int) string {
+		if i < len(values) {
+			return values[i]
+		}
+		return ""
+	}
+	integer := func(values []int, i int) int {
+		if i < len(values) {
+			return values[i]
+		}
+		return 0
+	}
+	factors := m.GetConversionFactors()
+	channels := make([]AnalogChannel, m.GetChannelTotal())
+	for i := range channels {
+		ch := AnalogChannel{
+			Index:        uint16(i + 1),
+			Number:       uint16(i + 1),
+			Name:         str(m.ChannelNames, i),
+			OriginalName: str(m.OriginalNames, i),
+			Phase:        str(m.ChannelPhases, i),
+			Element:      str(m.ChannelElements, i),
+			Unit:         str(m.ChannelUnits, i),
+			FactorA:      float(factors["a"], i),
+			FactorB:      float(factors["b"], i),
+			TimeFactor:   float(m.TimeFactors, i),
+			ValueMin:     integer(m.ValueMin, i),
+			ValueMax:     integer(m.ValueMax, i),
+		}
+		if i < len(m.ChannelNumber) {
+			ch.Number = m.ChannelNumber[i]
+		}
+		if ch.OriginalName == "" {
+			ch.OriginalName = ch.Name
+		}
+		if i < len(m.Primary) && i < len(m.Secondary) {
+			ch.Primary, ch.Secondary, ch.HasRatio = m.Primary[i], m.Secondary[i], true
+		}
+		if i < len(m.IsSecondaryMeasurement) {
+			ch.IsSecondaryMeasurement = m.IsSecondaryMeasurement[i]
+		}
+		channels[i] = ch
+	}
+	return channels
+}
+
+// Returns the channels described by the per field slices, for a ChannelD filled
+// without AddChannel
+func (m *ChannelD) channelsOfSlices() []DigitalChannel {
+	str := func(values []string, i int) string {
+		if i < len(values) {
+			return values[i]
+		}
+		return ""
+	}
+	channels := make([]DigitalChannel, m.GetChannelTotal())
+	for i := range channels {
+		ch := DigitalChannel{
+			Index:        uint16(i + 1),
+			Number:       uint16(i + 1),
+			Name:         str(m.ChannelNames, i),
+			OriginalName: str(m.OriginalNames, i),
+			Phase:        str(m.ChannelPhases, i),
+			Element:      str(m.ChannelElements, i),
+		}
+		if i < len(m.ChannelNumber) {
+			ch.Number = m.ChannelNumber[i]
+		}
+		if ch.OriginalName == "" {
+			ch.OriginalName = ch.Name
+		}
+		if i < len(m.InitialState) {
+			ch.InitialState = m.InitialState[i]
+		}
+		channels[i] = ch
+	}
+	return channels
+}
+
+// Return the parameters of every analog channel
+// the result is shared with the record and should not be modified
+func (cfg *CFG) GetAnalogChannels() []AnalogChannel {
+	return cfg.GetAnalogDetail().GetChannels()
+}
+
+// Return the parameters of every digital channel
+// the result is shared with the record and should not be modified
+func (cfg *CFG) GetDigitalChannels() []DigitalChannel {
+	return cfg.GetDigitDetail().GetChannels()
+}
+
+// Return a copy of the parameters of analog channel num (1-based, as in GetAnalogChannelData)
+// changing it does not change the record
+func (cfg *CFG) GetAnalogChannel(num uint16) (*AnalogChannel, error) {
+	channels := cfg.GetAnalogChannels()
+	if num < 1 || int(num) > len(channels) {
+		return nil, fmt.Errorf("analog channel %d out of range 1-%d", num, len(channels))
+	}
+	ch := channels[num-1]
+	return &ch, nil
+}
+
+// Return a copy of the parameters of digital channel num (1-based)
+// changing it does not change the record
+func (cfg *CFG) GetDigitalChannel(num uint16) (*DigitalChannel, error) {
+	channels := cfg.GetDigitalChannels()
+	if num < 1 || int(num) > len(channels) {
+		return nil, fmt.Errorf("digital channel %d out of range 1-%d", num, len(channels))
+	}
+	ch := channels[num-1]
+	return &ch, nil
+}
+
+// Calls fn with a copy of every analog channel in order, stopping at the first error
+func (cfg *CFG) EachAnalogChannel(fn func(ch *AnalogChannel) error) error {
+	for _, ch := range cfg.GetAnalogChannels() {
+		if err := fn(&ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls fn with a copy of every digital channel in order, stopping at the first error
+func (cfg *CFG) EachDigitalChannel(fn func(ch *DigitalChannel) error) error {
+	for _, ch := range cfg.GetDigitalChannels() {
+		if err := fn(&ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package comgo
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Records whose channels are filled through the per field slices only, as before
+// Channels existed, still scale and validate
+func TestChannelsOfSlices(t *testing.T) {
+	cfg := NewCFG()
+	if err := cfg.ReadCFG(strings.NewReader(fmt.Sprintf(testDatCFG, FileTypeASCII))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ReadDAT(bytes.NewReader([]byte("1,0,10,0\n2,1000,,0\n3,2000,-4,1\n"))); err != nil {
+		t.Fatal(err)
+	}
+	cfg.AnalogDetail = &ChannelA{
+		ChannelTotal:           1,
+		ChannelNumber:          []uint16{1},
+		ChannelNames:           []string{"VA"},
+		ChannelPhases:          []string{"A"},
+		ChannelUnits:           []string{"V"},
+		ConversionFactors:      map[string][]float64{"a": {0.5}, "b": {1}},
+		TimeFactors:            []float64{0},
+		ValueMin:               []int{-32767},
+		ValueMax:               []int{32767},
+		Primary:                []float64{100},
+		Secondary:              []float64{1},
+		IsSecondaryMeasurement: []bool{true},
+	}
+	cfg.DigitDetail = &ChannelD{
+		ChannelTotal:  1,
+		ChannelNumber: []uint16{1},
+		ChannelNames:  []string{"TRIP"},
+		InitialState:  []uint8{0},
+	}
+
+	for _, tc := range []struct {
+		scaling Scaling
+		want    []float64
+	}{
+		{ScaleRecorded, []float64{6, math.NaN(), -1}},
+		{ScalePrimary, []float64{600, math.NaN(), -100}},
+		{ScaleSecondary, []float64{6, math.NaN(), -1}},
+		{ScaleRaw, []float64{10, math.NaN(), -4}},
+	} {
+		values, err := cfg.GetAnalogChannelDataScaled(1, tc.scaling)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.scaling, err)
+		}
+		assertFloats(t, "VA "+tc.scaling.String(), values, tc.want, 1e-9)
+	}
+
+	ch, err := cfg.GetAnalogChannel(1)
+	if err != nil || ch.Name != "VA" || ch.Unit != "V" || !ch.HasRatio || ch.GetPS() != "S" {
+		t.Errorf("got analog channel %+v, %v", ch, err)
+	}
+	// Channels are copies, the record keeps its parameters
+	ch.FactorA = 2
+	if values, _ := cfg.GetAnalogChannelData(1); values[0] != 6 {
+		t.Errorf("changing a channel copy changed the values of the record to %v", values)
+	}
+	if d, err := cfg.GetDigitalChannel(1); err != nil || d.Name != "TRIP" {
+		t.Errorf("got digital channel %+v, %v", d, err)
+	}
+
+	if r := cfg.Validate(); len(r.Findings) != 0 {
+		t.Errorf("got findings %+v", r.Findings)
+	}
+
+	// Writing samples groups the channels
+	if err := cfg.SetSamples([]float64{0, 0.001, 0.002}, [][]float64{{1, 2, 3}}, [][]uint8{{0, 1, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.AnalogDetail.Channels) != 1 || len(cfg.DigitDetail.Channels) != 1 || cfg.AnalogDetail.Channels[0].Primary != 100 {
+		t.Errorf("got channels %+v and %+v", cfg.AnalogDetail.Channels, cfg.DigitDetail.Channels)
+	}
+	if values, err := cfg.GetAnalogChannelData(1); err != nil || len(values) != 3 {
+		t.Errorf("got %v, %v after SetSamples", values, err)
+	}
+}
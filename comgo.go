@@ -2,13 +2,10 @@ package comgo
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -211,6 +208,16 @@ func (cfg *CFG) GetTimeCodeOffset() int64 {
 	return 0
 }
 
+// GetStartTimeUTC returns the start time shifted to UTC according to the time code
+func (cfg *CFG) GetStartTimeUTC() time.Time {
+	return cfg.GetStartTime().Add(-time.Duration(cfg.GetTimeCodeOffset()))
+}
+
+// GetTriggerTimeUTC returns the trigger time shifted to UTC according to the time code
+func (cfg *CFG) GetTriggerTimeUTC() time.Time {
+	return cfg.GetTriggerTime().Add(-time.Duration(cfg.GetTimeCodeOffset()))
+}
+
 func (cfg *CFG) GetDataFileContent() []byte {
 	if cfg != nil {
 		return cfg.DataFileContent
@@ -252,6 +259,7 @@ func (cfg *CFG) GetAnalogChannelNames() []string {
  * @ChannelTotal: Total number of channels
  * @ChannelNumber: Channel number series
  * @ChannelNames: Names of each channel
+ * @OriginalNames: Names of each channel as written in the .cfg file
  * @ChannelPhases: Phases of each channel
  * @ChannelElements: Channel element (usually null)
  * @ChannelUnits: Units of each channel
@@ -261,11 +269,14 @@ func (cfg *CFG) GetAnalogChannelNames() []string {
  * @ValueMax: Max Value of each channels
  * @Primary: Primary ratios
  * @Secondary: Secondary ratios
+ * @IsSecondaryMeasurement: Whether values are recorded on the secondary side (PS flag)
+ * @Channels: Parameters grouped per channel, built from the slices above when empty
  */
 type ChannelA struct {
 	ChannelTotal           uint16
 	ChannelNumber          []uint16
 	ChannelNames           []string
+	OriginalNames          []string
 	ChannelPhases          []string
 	ChannelElements        []string
 	ChannelUnits           []string
@@ -276,6 +287,7 @@ type ChannelA struct {
 	Primary                []float64
 	Secondary              []float64
 	IsSecondaryMeasurement []bool
+	Channels               []AnalogChannel
 }
 
 func (m *ChannelA) GetChannelTotal() uint16 {
@@ -299,6 +311,13 @@ func (m *ChannelA) GetChannelNames() []string {
 	return nil
 }
 
+func (m *ChannelA) GetOriginalNames() []string {
+	if m != nil {
+		return m.OriginalNames
+	}
+	return nil
+}
+
 func (m *ChannelA) GetChannelPhases() []string {
 	if m != nil {
 		return m.ChannelPhases
@@ -362,21 +381,100 @@ func (m *ChannelA) GetSecondary() []float64 {
 	return nil
 }
 
+func (m *ChannelA) GetIsSecondaryMeasurement() []bool {
+	if m != nil {
+		return m.IsSecondaryMeasurement
+	}
+	return nil
+}
+
+// Scaling selects the side of the instrument transformer analog values are expressed in
+type Scaling uint8
+
+const (
+	// ScaleRecorded returns values as stored by the recorder: y = factorA * x + factorB
+	ScaleRecorded Scaling = iota
+	// ScalePrimary converts values to primary quantities using the channel ratio
+	ScalePrimary
+	// ScaleSecondary converts values to secondary quantities using the channel ratio
+	ScaleSecondary
+	// ScaleRaw returns values as stored in the data file, without conversion factors
+	ScaleRaw
+)
+
+func (s Scaling) String() string {
+	switch s {
+	case ScaleRecorded:
+		return "recorded"
+	case ScalePrimary:
+		return "primary"
+	case ScaleSecondary:
+		return "secondary"
+	case ScaleRaw:
+		return "raw"
+	}
+	return "unknown"
+}
+
+// ParseScaling returns the scaling named name as String returns it, ignoring case.
+// An empty name stands for ScaleRecorded
+func ParseScaling(name string) (Scaling, error) {
+	if name == "" {
+		return ScaleRecorded, nil
+	}
+	for _, s := range []Scaling{ScaleRecorded, ScalePrimary, ScaleSecondary, ScaleRaw} {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scaling %q, expected recorded, primary, secondary or raw", name)
+}
+
+// Returns the factor to apply to recorded values of analog channel idx (0-based)
+// so that they are expressed in the requested scaling
+func (m *ChannelA) GetScaleFactor(idx int, scaling Scaling) (float64, error) {
+	if scaling == ScaleRecorded || scaling == ScaleRaw {
+		return 1, nil
+	}
+	channels := m.GetChannels()
+	if idx < 0 || idx >= len(channels) {
+		return 0, errors.New("invalid analog channel")
+	}
+	return channels[idx].GetScaleFactor(scaling)
+}
+
+// Returns the parameters of every channel: Channels, or when it is empty
+// the channels described by the per field slices
+func (m *ChannelA) GetChannels() []AnalogChannel {
+	if m == nil {
+		return nil
+	}
+	if len(m.Channels) == 0 && m.ChannelTotal > 0 {
+		return m.channelsOfSlices()
+	}
+	return m.Channels
+}
+
 /*
  * ChannelD - Digit channel parameters
  * @ChannelTotal: Total number of channels
  * @ChannelNumber: Channel number series
  * @ChannelNames: Names of each channel
+ * @OriginalNames: Names of each channel as written in the .cfg file
  * @ChannelPhases: Phases of each channel
  * @ChannelElements: Channel element (usually null)
+ * @InitialState: Normal state of each channel
+ * @Channels: Parameters grouped per channel, built from the slices above when empty
  */
 type ChannelD struct {
 	ChannelTotal    uint16
 	ChannelNumber   []uint16
 	ChannelNames    []string
+	OriginalNames   []string
 	ChannelPhases   []string
 	ChannelElements []string
 	InitialState    []uint8
+	Channels        []DigitalChannel
 }
 
 func (m *ChannelD) GetChannelTotal() uint16 {
@@ -400,6 +498,13 @@ func (m *ChannelD) GetChannelNames() []string {
 	return nil
 }
 
+func (m *ChannelD) GetOriginalNames() []string {
+	if m != nil {
+		return m.OriginalNames
+	}
+	return nil
+}
+
 func (m *ChannelD) GetChannelPhases() []string {
 	if m != nil {
 		return m.ChannelPhases
@@ -421,6 +526,18 @@ func (m *ChannelD) GetInitialState() []uint8 {
 	return nil
 }
 
+// Returns the parameters of every channel: Channels, or when it is empty
+// the channels described by the per field slices
+func (m *ChannelD) GetChannels() []DigitalChannel {
+	if m == nil {
+		return nil
+	}
+	if len(m.Channels) == 0 && m.ChannelTotal > 0 {
+		return m.channelsOfSlices()
+	}
+	return m.Channels
+}
+
 /*
  * SampleRate - Sampling rate and sampling number
  * @Rate: Sampling rate
@@ -482,7 +599,7 @@ func (m *BinData) GetValue() []int16 {
 // return empty CFG and error if err != nil
 func (cfg *CFG) ReadCFG(rd io.Reader) (err error) {
 	var tempList [][]byte
-	content, err := ioutil.ReadAll(rd)
+	content, err := readAll(rd)
 	if err != nil {
 		return err
 	}
@@ -545,65 +662,62 @@ func (cfg *CFG) ReadCFG(rd io.Reader) (err error) {
 		if len(tempList) < 10 {
 			return fmt.Errorf("cfg format error: missing info for analog channel %d", i)
 		}
+		ch := AnalogChannel{Index: uint16(i + 1)}
 		if num, err := strconv.Atoi(ByteToString(tempList[0])); err != nil {
 			return err
 		} else {
-			chA.ChannelNumber = append(chA.GetChannelNumber(), uint16(num))
+			ch.Number = uint16(num)
 		}
 		// Format ids to xxx_xxx_xxx
-		chA.ChannelNames = append(chA.GetChannelNames(), ByteToString(bytes.Join(bytes.Split(tempList[1], []byte(" ")), []byte("_"))))
-		chA.ChannelPhases = append(chA.GetChannelPhases(), ByteToString(tempList[2]))
+		ch.Name = normalizeChannelName(string(tempList[1]))
+		ch.OriginalName = ByteToString(tempList[1])
+		ch.Phase = ByteToString(tempList[2])
 		// Channel element (usually null)
-		chA.ChannelElements = append(chA.GetChannelElements(), ByteToString(tempList[3]))
-		chA.ChannelUnits = append(chA.GetChannelUnits(), ByteToString(tempList[4]))
+		ch.Element = ByteToString(tempList[3])
+		ch.Unit = ByteToString(tempList[4])
 		// Conversion factor A
 		if num, err := strconv.ParseFloat(ByteToString(tempList[5]), 64); err != nil {
 			return err
 		} else {
-			chA.ConversionFactors["a"] = append(chA.GetConversionFactors()["a"], num)
+			ch.FactorA = num
 		}
 		// Conversion factor B
 		if num, err := strconv.ParseFloat(ByteToString(tempList[6]), 64); err != nil {
 			return err
 		} else {
-			chA.ConversionFactors["b"] = append(chA.GetConversionFactors()["b"], num)
+			ch.FactorB = num
 		}
 		// Time factor
 		if num, err := strconv.ParseFloat(ByteToString(tempList[7]), 64); err != nil {
 			return err
 		} else {
-			chA.TimeFactors = append(chA.GetTimeFactors(), num)
+			ch.TimeFactor = num
 		}
 		// Min Value at current channel
 		if num, err := strconv.Atoi(ByteToString(tempList[8])); err != nil {
 			return err
 		} else {
-			chA.ValueMin = append(chA.GetValueMin(), num)
+			ch.ValueMin = num
 		}
 		// Max Value at current channel
 		if num, err := strconv.Atoi(ByteToString(tempList[9])); err != nil {
 			return err
 		} else {
-			chA.ValueMax = append(chA.GetValueMax(), num)
+			ch.ValueMax = num
 		}
 
-		if len(tempList) > 10 {
-			if num, err := strconv.ParseFloat(ByteToString(tempList[10]), 64); err == nil {
-				chA.Primary = append(chA.GetPrimary(), num)
-			}
-		}
+		// Ratios and PS flag are optional, the channel only has a ratio when both parse
 		if len(tempList) > 11 {
-			if num, err := strconv.ParseFloat(ByteToString(tempList[11]), 64); err == nil {
-				chA.Secondary = append(chA.GetSecondary(), num)
+			primary, errP := strconv.ParseFloat(ByteToString(tempList[10]), 64)
+			secondary, errS := strconv.ParseFloat(ByteToString(tempList[11]), 64)
+			if errP == nil && errS == nil {
+				ch.Primary, ch.Secondary, ch.HasRatio = primary, secondary, true
 			}
 		}
 		if len(tempList) > 12 {
-			if strings.ToLower(ByteToString(tempList[12])) == "s" {
-				chA.IsSecondaryMeasurement = append(chA.IsSecondaryMeasurement, true)
-			} else {
-				chA.IsSecondaryMeasurement = append(chA.IsSecondaryMeasurement, false)
-			}
+			ch.IsSecondaryMeasurement = strings.ToLower(ByteToString(tempList[12])) == "s"
 		}
+		chA.appendChannel(ch)
 	}
 
 	// Processing digit channels
@@ -612,30 +726,31 @@ func (cfg *CFG) ReadCFG(rd io.Reader) (err error) {
 		if len(tempList) < 3 {
 			return fmt.Errorf("cfg format error: missing info for digit channel: %d", i)
 		}
+		ch := DigitalChannel{Index: uint16(i + 1)}
 		if num, err := strconv.Atoi(ByteToString(tempList[0])); err != nil {
 			return err
 		} else {
-			chD.ChannelNumber = append(chD.GetChannelNumber(), uint16(num))
+			ch.Number = uint16(num)
 		}
-		chD.ChannelNames = append(chD.GetChannelNames(), ByteToString(bytes.Join(bytes.Split(tempList[1], []byte(" ")), []byte("_"))))
-		chD.ChannelPhases = append(chD.GetChannelPhases(), ByteToString(tempList[2]))
+		ch.Name = normalizeChannelName(string(tempList[1]))
+		ch.OriginalName = ByteToString(tempList[1])
+		ch.Phase = ByteToString(tempList[2])
 
 		// checking vector length to avoid IndexError
 		if len(tempList) > 3 {
 			// Channel element (usually null)
-			chD.ChannelElements = append(chD.GetChannelElements(), ByteToString(tempList[3]))
-		} else {
-			chD.ChannelElements = append(chD.GetChannelElements(), "")
+			ch.Element = ByteToString(tempList[3])
 		}
 		if len(tempList) > 4 {
 			if num, err := strconv.ParseUint(ByteToString(tempList[4]), 10, 8); err != nil {
 				return err
 			} else {
-				chD.InitialState = append(chD.GetInitialState(), uint8(num))
+				ch.InitialState = uint8(num)
 			}
 		} else {
-			chD.InitialState = append(chD.GetInitialState(), uint8(2))
+			ch.InitialState = uint8(2)
 		}
+		chD.appendChannel(ch)
 	}
 
 	// Read line frequency
@@ -723,10 +838,10 @@ func (cfg *CFG) ReadCFG(rd io.Reader) (err error) {
 	return nil
 }
 
-// Reads the contents of the Comtrade .dat file
+// Reads the contents of the Comtrade .dat file, gzip compressed or not
 // Store the contents in a private variable
 func (cfg *CFG) ReadDAT(rd io.Reader) (err error) {
-	content, err := ioutil.ReadAll(rd)
+	content, err := readAll(rd)
 	if err != nil {
 		return err
 	}
@@ -736,20 +851,45 @@ func (cfg *CFG) ReadDAT(rd io.Reader) (err error) {
 
 // Returns an array of numbers containing the data values of the channel number
 // num is the number of the channel as in .cfg file
+// missing samples are returned as NaN, see IsMissing
 func (cfg *CFG) GetAnalogChannelData(num uint16) (result []float64, err error) {
-	if cfg == nil {
-		return nil, errors.New("invalid cfg file, read .cfg first")
+	return cfg.GetAnalogChannelDataScaled(num, ScaleRecorded)
+}
+
+// Returns the data values of the channel number converted to primary or secondary
+// quantities according to the channel ratio and PS flag
+func (cfg *CFG) GetAnalogChannelDataScaled(num uint16, scaling Scaling) (result []float64, err error) {
+	rd, err := cfg.newDatReader()
+	if err != nil {
+		return nil, err
 	}
+	return cfg.analogData(rd, num, scaling)
+}
 
-	if cfg.GetDataFileContent() == nil || bytes.Equal(cfg.GetDataFileContent(), []byte("")) {
-		return nil, errors.New("not data content, read .dat first")
+// Decodes analog channel num from the data file read by rd
+func (cfg *CFG) analogData(rd *datReader, num uint16, scaling Scaling) (result []float64, err error) {
+	scale, err := cfg.analogScale(num, scaling)
+	if err != nil {
+		return nil, err
 	}
 
-	analogDetail := cfg.GetAnalogDetail()
-	if analogDetail == nil {
-		return nil, errors.New("invalid analog channel")
+	// Reading the values from datFileContent, missing samples stay NaN
+	result = make([]float64, rd.samples)
+	for i := range result {
+		value, err := rd.getAnalog(i, int(num)-1)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = scale(value)
 	}
 
+	return result, nil
+}
+
+// Returns the conversion of the stored values of analog channel num to scaling
+func (cfg *CFG) analogScale(num uint16, scaling Scaling) (func(value float64) float64, error) {
+	analogDetail := cfg.GetAnalogDetail()
+
 	if num > analogDetail.GetChannelTotal() {
 		return nil, errors.New("analog channel number greater than the total number of channels")
 	}
@@ -758,44 +898,27 @@ func (cfg *CFG) GetAnalogChannelData(num uint16) (result []float64, err error) {
 		return nil, errors.New("analog channel number cannot be less than 1")
 	}
 
-	digitDetail := cfg.GetDigitDetail()
-	if digitDetail == nil {
-		return nil, errors.New("invalid digital channel")
-	}
-
-	// Number of bytes per Sample:
-	NB := 8 + int(analogDetail.GetChannelTotal())<<1 + int(math.Ceil(float64(int(digitDetail.GetChannelTotal()))/float64(16)))<<1
-
-	sampleDetail := cfg.GetSampleDetail()
-	if sampleDetail == nil || len(sampleDetail) == 0 {
-		return nil, errors.New("invalid or not enough sample detail")
+	ch, err := cfg.GetAnalogChannel(num)
+	if err != nil {
+		return nil, err
 	}
-
-	dataFileContent := cfg.GetDataFileContent()
-	if dataFileContent == nil {
-		return nil, errors.New("invalid dat file content")
+	factorA, factorB := ch.FactorA, ch.FactorB
+	if scaling == ScaleRaw {
+		factorA, factorB = 1, 0
 	}
 
-	factor := analogDetail.GetConversionFactors()
-
-	// Number of samples: @TODO - only take 1 rate into account
-	// Reading the values from datFileContent string
-	for i := 0; i < sampleDetail[0].GetNumber(); i++ {
-
-		// get data from in memory file contents
-		s := dataFileContent[i*NB : i*NB+NB]
-
-		value := make([]int16, (NB-8)/2)
-
-		err = binary.Read(bytes.NewReader(s[8:]), binary.LittleEndian, &value)
-		if err != nil {
-			return nil, err
-		}
-
-		result = append(result, float64(value[num-1])*factor["a"][num-1]+factor["b"][num-1])
+	ratio, err := ch.GetScaleFactor(scaling)
+	if err != nil {
+		return nil, err
 	}
+	return func(value float64) float64 {
+		return (value*factorA + factorB) * ratio
+	}, nil
+}
 
-	return result, nil
+// Format channel ids to xxx_xxx_xxx
+func normalizeChannelName(name string) string {
+	return strings.TrimSpace(strings.Replace(name, " ", "_", -1))
 }
 
 // Convert []byte type file content to string
@@ -0,0 +1,126 @@
+package comgo
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// TimeColumn selects how the time of each sample is written
+type TimeColumn uint8
+
+const (
+	// TimeAbsolute writes the UTC date and time of the sample in ISO-8601
+	TimeAbsolute TimeColumn = iota
+	// TimeRelative writes the seconds since the trigger, negative before it
+	TimeRelative
+	// TimeIndex writes the 1-based sample number
+	TimeIndex
+)
+
+// ISO-8601 layout used for absolute sample times
+const ISOTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+/*
+ * CSVOptions - Layout of a CSV export
+ * @Analog: Analog channel numbers to export, nil for all
+ * @Digital: Digital channel numbers to export, nil for all
+ * @Time: Content of the time column
+ * @Scaling: Scaling of analog values
+ * @Delimiter: Field delimiter
+ * @Decimals: Decimal places of analog values, nil for the shortest exact representation
+ */
+type CSVOptions struct {
+	Analog    []uint16
+	Digital   []uint16
+	Time      TimeColumn
+	Scaling   Scaling
+	Delimiter rune
+	Decimals  *int
+}
+
+// NewCSVOptions returns options exporting every channel as recorded,
+// with absolute times, comma delimited and full precision
+func NewCSVOptions() CSVOptions {
+	return CSVOptions{Delimiter: ','}
+}
+
+// Returns the header of the time column
+func (t TimeColumn) header() string {
+	switch t {
+	case TimeRelative:
+		return "time_s"
+	case TimeIndex:
+		return "sample"
+	}
+	return "time"
+}
+
+// Formats the time of sample i at offset seconds from the start time
+func (cfg *CFG) formatSampleTime(column TimeColumn, i int, offset float64) string {
+	switch column {
+	case TimeRelative:
+		trigger := cfg.GetTriggerTime().Sub(cfg.GetStartTime()).Seconds()
+		return strconv.FormatFloat(offset-trigger, 'f', 9, 64)
+	case TimeIndex:
+		return strconv.Itoa(i + 1)
+	}
+	return cfg.GetStartTimeUTC().Add(time.Duration(math.Round(offset * 1e9))).Format(ISOTimeFormat)
+}
+
+// WriteCSV writes the selected channels with a header row, one sample per line
+// missing analog samples are written as empty fields
+func (cfg *CFG) WriteCSV(w io.Writer, opts CSVOptions) error {
+	if opts.Time > TimeIndex {
+		return errors.New("unknown time column")
+	}
+
+	t, err := cfg.decodeTable(opts.Analog, opts.Digital, opts.Scaling)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		cw.Comma = opts.Delimiter
+	}
+
+	row := make([]string, 0, 1+len(t.analog)+len(t.digital))
+	row = append(row, opts.Time.header())
+	for _, ch := range t.analog {
+		row = append(row, ch.Name)
+	}
+	for _, ch := range t.digital {
+		row = append(row, ch.Name)
+	}
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+
+	decimals := -1
+	if opts.Decimals != nil {
+		decimals = *opts.Decimals
+	}
+	for i, offset := range t.times {
+		row = append(row[:0], cfg.formatSampleTime(opts.Time, i, offset))
+		for _, values := range t.values {
+			if math.IsNaN(values[i]) {
+				row = append(row, "")
+			} else {
+				row = append(row, strconv.FormatFloat(values[i], 'f', decimals, 64))
+			}
+		}
+		for _, states := range t.states {
+			row = append(row, strconv.Itoa(int(states[i])))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
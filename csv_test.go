@@ -0,0 +1,82 @@
+package comgo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Records exported to CSV are imported back with the same samples and times
+func TestWriteCSVRoundTrip(t *testing.T) {
+	rec := testRecord(t, FileTypeBinary32)
+	opts := NewCSVOptions()
+	opts.Delimiter = ';'
+	var buf bytes.Buffer
+	if err := rec.WriteCSV(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if header := strings.SplitN(buf.String(), "\n", 2)[0]; header != "time;VA;IA;TRIP" {
+		t.Errorf("got header %q", header)
+	}
+
+	trigger := rec.GetTriggerTime().Sub(rec.GetStartTime()).Seconds()
+	imported, err := ImportCSV(&buf, CSVMapping{
+		FileType:   FileTypeFloat32,
+		Delimiter:  ";",
+		TimeFormat: ISOTimeFormat,
+		Trigger:    &trigger,
+		Columns:    []CSVColumn{{Column: "VA"}, {Column: "IA"}, {Column: "TRIP", Digital: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imported.GetStartTime().Equal(rec.GetStartTime()) || !imported.GetTriggerTime().Equal(rec.GetTriggerTime()) {
+		t.Errorf("got start %v and trigger %v, want %v and %v", imported.GetStartTime(), imported.GetTriggerTime(), rec.GetStartTime(), rec.GetTriggerTime())
+	}
+	assertSameSamples(t, rec.CFG, imported.CFG, ScaleRecorded)
+}
+
+func TestWriteCSVTimeColumns(t *testing.T) {
+	rec := testRecord(t, FileTypeASCII)
+	for _, tc := range []struct {
+		column TimeColumn
+		want   string
+	}{
+		{TimeAbsolute, "time,VA\n2020-01-01T00:00:00.000000000Z,0.00\n2020-01-01T00:00:00.001000000Z,81.50\n"},
+		{TimeRelative, "time_s,VA\n-0.001000000,0.00\n0.000000000,81.50\n"},
+		{TimeIndex, "sample,VA\n1,0.00\n2,81.50\n"},
+	} {
+		opts := NewCSVOptions()
+		decimals := 2
+		opts.Analog, opts.Digital, opts.Time, opts.Decimals = []uint16{1}, []uint16{}, tc.column, &decimals
+		var buf bytes.Buffer
+		if err := rec.WriteCSV(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); !strings.HasPrefix(got, tc.want) {
+			t.Errorf("time column %d: got %q, want it to start with %q", tc.column, got, tc.want)
+		}
+	}
+}
+
+// The zero value of CSVOptions keeps every digit of analog values
+func TestWriteCSVDecimals(t *testing.T) {
+	rec := testRecord(t, FileTypeFloat32)
+	zero := 0
+	for _, tc := range []struct {
+		decimals *int
+		want     string
+	}{
+		{nil, "5,-12.25,0"},
+		{&zero, "5,-12,0"},
+	} {
+		var buf bytes.Buffer
+		if err := rec.WriteCSV(&buf, CSVOptions{Time: TimeIndex, Analog: []uint16{1}, Decimals: tc.decimals}); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if got := lines[len(lines)-1]; got != tc.want {
+			t.Errorf("decimals %v: got last line %q, want %q", tc.decimals, got, tc.want)
+		}
+	}
+}
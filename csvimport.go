@@ -0,0 +1,322 @@
+package comgo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * CSVColumn - Channel made from a CSV column
+ * @Column: Header of the column
+ * @Name: Channel name, the column header when empty
+ * @Phase: Phase identification
+ * @Element: Circuit component being monitored (ccbm)
+ * @Unit: Channel units
+ * @Scale: Factor applied to the column values, 1 when 0
+ * @Primary: Primary ratio, no ratio when 0
+ * @Secondary: Secondary ratio
+ * @SecondaryMeasurement: Whether values are on the secondary side (PS flag)
+ * @Digital: Whether the column holds a digital channel
+ */
+type CSVColumn struct {
+	Column               string  `json:"column"`
+	Name                 string  `json:"name,omitempty"`
+	Phase                string  `json:"phase,omitempty"`
+	Element              string  `json:"element,omitempty"`
+	Unit                 string  `json:"unit,omitempty"`
+	Scale                float64 `json:"scale,omitempty"`
+	Primary              float64 `json:"primary,omitempty"`
+	Secondary            float64 `json:"secondary,omitempty"`
+	SecondaryMeasurement bool    `json:"secondary_measurement,omitempty"`
+	Digital              bool    `json:"digital,omitempty"`
+}
+
+/*
+ * CSVMapping - How a CSV file maps to a COMTRADE record
+ * @Station: Name of the station
+ * @Device: Identification of the recording device
+ * @LineFrequency: Line frequency in Hz
+ * @FileType: Data file type, BINARY when empty
+ * @Delimiter: Field delimiter, ',' when empty
+ * @SkipRows: Lines preceding the header row, e.g. an oscilloscope preamble
+ * @Time: Header of the time column, the first column when empty
+ * @TimeScale: Seconds per unit of a numeric time column, 1 when 0, e.g. 0.001 for ms
+ * @TimeFormat: Layout of absolute times (time.Parse), the time column is numeric when empty
+ * @Origin: Date and time of time 0 of a numeric time column, the Unix epoch when not set
+ * @Trigger: Trigger time in seconds on a numeric time column, time 0 when in the record,
+ *           otherwise the first sample; with absolute times, seconds from the first sample
+ * @Columns: Channels to import, every other column as an analog channel when empty
+ */
+type CSVMapping struct {
+	Station       string      `json:"station,omitempty"`
+	Device        string      `json:"device,omitempty"`
+	LineFrequency uint16      `json:"line_frequency,omitempty"`
+	FileType      string      `json:"file_type,omitempty"`
+	Delimiter     string      `json:"delimiter,omitempty"`
+	SkipRows      int         `json:"skip_rows,omitempty"`
+	Time          string      `json:"time,omitempty"`
+	TimeScale     float64     `json:"time_scale,omitempty"`
+	TimeFormat    string      `json:"time_format,omitempty"`
+	Origin        time.Time   `json:"origin,omitempty"`
+	Trigger       *float64    `json:"trigger,omitempty"`
+	Columns       []CSVColumn `json:"columns,omitempty"`
+}
+
+// ReadCSVMapping reads a mapping spec stored as JSON, see CSVMapping
+func ReadCSVMapping(rd io.Reader) (*CSVMapping, error) {
+	content, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	m := &CSVMapping{}
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("csv mapping: %v", err)
+	}
+	return m, nil
+}
+
+// Parses the status of a digital channel
+func parseState(field string) (uint8, error) {
+	switch strings.ToLower(field) {
+	case "1", "true", "on", "high", "closed":
+		return 1, nil
+	case "0", "false", "off", "low", "open", "":
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0, err
+	}
+	if value != 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// OpenCSV imports the CSV file name, see ImportCSV
+func OpenCSV(name string, mapping CSVMapping) (*Record, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rec, err := ImportCSV(f, mapping)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	rec.Name = strings.TrimSuffix(name, ".gz")
+	rec.Name = strings.TrimSuffix(rec.Name, filepath.Ext(rec.Name))
+	return rec, nil
+}
+
+// ImportCSV builds a record from a CSV file made of a header row, a time column and value
+// columns, mapped to channels as described by mapping. Empty and NaN analog values are
+// missing samples, digital values are 0/1, true/false, on/off or numbers, non-zero being 1.
+// The sampling rate is inferred from the time column, samples are time stamped when unevenly
+// spaced, and conversion factors are chosen to fit the data file type. Save writes the result.
+func ImportCSV(rd io.Reader, mapping CSVMapping) (*Record, error) {
+	content, err := readAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitN(string(content), "\n", mapping.SkipRows+1)
+	if len(lines) <= mapping.SkipRows {
+		return nil, errors.New("csv: no header row")
+	}
+
+	r := csv.NewReader(strings.NewReader(lines[mapping.SkipRows]))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		r.Comma = []rune(mapping.Delimiter)[0]
+	}
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv: %v", err)
+	}
+	if len(rows) < 2 {
+		return nil, errors.New("csv: no sample after the header row")
+	}
+	header := rows[0]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	column := func(name string) (int, error) {
+		for i, h := range header {
+			if strings.TrimSpace(h) == name {
+				return i, nil
+			}
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("csv: column %q not found", name)
+	}
+
+	timeColumn := 0
+	if mapping.Time != "" {
+		if timeColumn, err = column(mapping.Time); err != nil {
+			return nil, err
+		}
+	}
+	columns := mapping.Columns
+	if len(columns) == 0 {
+		for i, h := range header {
+			if i != timeColumn {
+				columns = append(columns, CSVColumn{Column: strings.TrimSpace(h)})
+			}
+		}
+	}
+	indices := make([]int, len(columns))
+	for i, c := range columns {
+		if indices[i], err = column(c.Column); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sample times in seconds from time 0 of the time column
+	samples := rows[1:]
+	times := make([]float64, len(samples))
+	var first time.Time
+	for i, row := range samples {
+		if timeColumn >= len(row) {
+			return nil, fmt.Errorf("csv: row %d has no time", i+1)
+		}
+		field := strings.TrimSpace(row[timeColumn])
+		if mapping.TimeFormat != "" {
+			t, err := time.Parse(mapping.TimeFormat, field)
+			if err != nil {
+				return nil, fmt.Errorf("csv: row %d time: %v", i+1, err)
+			}
+			if i == 0 {
+				first = t
+			}
+			times[i] = t.Sub(first).Seconds()
+			continue
+		}
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("csv: row %d time: %v", i+1, err)
+		}
+		if mapping.TimeScale != 0 {
+			value *= mapping.TimeScale
+		}
+		times[i] = value
+	}
+	for i := 1; i < len(times); i++ {
+		if times[i] < times[i-1] {
+			return nil, fmt.Errorf("csv: time goes backwards at row %d", i+1)
+		}
+	}
+
+	cfg := NewCFG()
+	cfg.StationName, cfg.RecordDeviceId = mapping.Station, mapping.Device
+	cfg.LineFrequency = mapping.LineFrequency
+	cfg.DataFileType = mapping.FileType
+	cfg.AnalogDetail, cfg.DigitDetail = &ChannelA{}, &ChannelD{}
+
+	// The record starts at the first sample
+	origin, trigger := first, 0.0
+	if mapping.TimeFormat == "" {
+		origin = mapping.Origin
+		if origin.IsZero() {
+			origin = time.Unix(0, 0).UTC()
+		}
+		if times[0] <= 0 && times[len(times)-1] >= 0 {
+			trigger = -times[0]
+		}
+		offset := times[0]
+		origin = origin.Add(time.Duration(math.Round(offset * 1e9)))
+		for i := range times {
+			times[i] -= offset
+		}
+		if mapping.Trigger != nil {
+			trigger = *mapping.Trigger - offset
+		}
+	} else if mapping.Trigger != nil {
+		trigger = *mapping.Trigger
+	}
+	cfg.StartTime = origin
+	cfg.TriggerTime = origin.Add(time.Duration(math.Round(trigger * 1e9)))
+
+	var analog [][]float64
+	var digital [][]uint8
+	for c, col := range columns {
+		name := col.Name
+		if name == "" {
+			name = col.Column
+		}
+		if col.Digital {
+			states := make([]uint8, len(samples))
+			for i, row := range samples {
+				if indices[c] >= len(row) {
+					continue
+				}
+				if states[i], err = parseState(strings.TrimSpace(row[indices[c]])); err != nil {
+					return nil, fmt.Errorf("csv: row %d column %q: %v", i+1, col.Column, err)
+				}
+			}
+			cfg.DigitDetail.AddChannel(DigitalChannel{
+				Number:       cfg.DigitDetail.ChannelTotal + 1,
+				Name:         normalizeChannelName(name),
+				OriginalName: name,
+				Phase:        col.Phase,
+				Element:      col.Element,
+				InitialState: states[0],
+			})
+			digital = append(digital, states)
+			continue
+		}
+
+		scale := col.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		values := make([]float64, len(samples))
+		for i, row := range samples {
+			field := ""
+			if indices[c] < len(row) {
+				field = strings.TrimSpace(row[indices[c]])
+			}
+			if field == "" {
+				values[i] = math.NaN()
+				continue
+			}
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("csv: row %d column %q: %v", i+1, col.Column, err)
+			}
+			values[i] = value * scale
+		}
+		cfg.AnalogDetail.AddChannel(AnalogChannel{
+			Number:                 cfg.AnalogDetail.ChannelTotal + 1,
+			Name:                   normalizeChannelName(name),
+			OriginalName:           name,
+			Phase:                  col.Phase,
+			Element:                col.Element,
+			Unit:                   col.Unit,
+			Primary:                col.Primary,
+			Secondary:              col.Secondary,
+			HasRatio:               col.Primary != 0 && col.Secondary != 0,
+			IsSecondaryMeasurement: col.SecondaryMeasurement,
+		})
+		analog = append(analog, values)
+	}
+
+	if err := cfg.SetSamples(times, analog, digital); err != nil {
+		return nil, err
+	}
+	return &Record{CFG: &cfg}, nil
+}
@@ -0,0 +1,307 @@
+package comgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Data file types as written in the .cfg file
+const (
+	FileTypeASCII    = "ASCII"
+	FileTypeBinary   = "BINARY"
+	FileTypeBinary32 = "BINARY32"
+	FileTypeFloat32  = "FLOAT32"
+)
+
+// Values reserved by C37.111 to mark a missing analog sample in binary data files
+const (
+	MissingBinary   = -0x8000
+	MissingBinary32 = -0x80000000
+)
+
+// IsMissing reports whether a decoded analog value marks a missing sample
+func IsMissing(v float64) bool {
+	return math.IsNaN(v)
+}
+
+/*
+ * datReader - Random access to the samples of a data file
+ * @fileType: Upper cased data file type
+ * @analog: Number of analog channels
+ * @digital: Number of digital channels
+ * @analogSize: Bytes per analog value (binary only)
+ * @recordSize: Bytes per sample (binary only)
+ * @content: Data file content
+ * @rows: Fields of each sample (ASCII only)
+ * @samples: Number of samples declared in the .cfg file
+ * @present: Number of complete samples in the data file
+ */
+type datReader struct {
+	fileType   string
+	analog     int
+	digital    int
+	analogSize int
+	recordSize int
+	content    []byte
+	rows       [][][]byte
+	samples    int
+	present    int
+}
+
+// Returns the total number of samples declared in the .cfg file,
+// the end sample of the last sampling rate
+func (cfg *CFG) getTotalSamples() int {
+	sampleDetail := cfg.GetSampleDetail()
+	if len(sampleDetail) == 0 {
+		return 0
+	}
+	return sampleDetail[len(sampleDetail)-1].GetNumber()
+}
+
+// Prepares a reader over the data file content according to the data file type
+// an error is returned if the data file holds fewer samples than declared
+func (cfg *CFG) newDatReader() (*datReader, error) {
+	rd, err := cfg.scanDat()
+	if err != nil {
+		return nil, err
+	}
+	if rd.present < rd.samples {
+		return nil, fmt.Errorf("dat file truncated: %d of %d samples present", rd.present, rd.samples)
+	}
+	return rd, nil
+}
+
+// Prepares a reader over the data file content without checking the number of samples
+func (cfg *CFG) scanDat() (*datReader, error) {
+	if cfg == nil {
+		return nil, errors.New("invalid cfg file, read .cfg first")
+	}
+
+	content := cfg.GetDataFileContent()
+	if len(content) == 0 {
+		return nil, errors.New("not data content, read .dat first")
+	}
+
+	analogDetail, digitDetail := cfg.GetAnalogDetail(), cfg.GetDigitDetail()
+	if analogDetail == nil {
+		return nil, errors.New("invalid analog channel")
+	}
+	if digitDetail == nil {
+		return nil, errors.New("invalid digital channel")
+	}
+
+	if len(cfg.GetSampleDetail()) == 0 {
+		return nil, errors.New("invalid or not enough sample detail")
+	}
+
+	rd := &datReader{
+		fileType: strings.ToUpper(cfg.GetDataFileType()),
+		analog:   int(analogDetail.GetChannelTotal()),
+		digital:  int(digitDetail.GetChannelTotal()),
+		content:  content,
+		samples:  cfg.getTotalSamples(),
+	}
+
+	switch rd.fileType {
+	case FileTypeBinary:
+		rd.analogSize = 2
+	case FileTypeBinary32, FileTypeFloat32:
+		rd.analogSize = 4
+	case FileTypeASCII:
+		for _, line := range bytes.Split(content, []byte("\n")) {
+			// Skip blank lines and the DOS end of file marker
+			line = bytes.TrimSpace(bytes.TrimRight(line, "\x1a"))
+			if len(line) == 0 {
+				continue
+			}
+			fields := bytes.Split(line, []byte(","))
+			if len(fields) < 2+rd.analog+rd.digital {
+				return nil, fmt.Errorf("dat format error: sample %d has %d fields, expected %d", len(rd.rows)+1, len(fields), 2+rd.analog+rd.digital)
+			}
+			rd.rows = append(rd.rows, fields)
+		}
+		rd.present = len(rd.rows)
+		return rd, nil
+	default:
+		return nil, fmt.Errorf("unsupported data file type %q", cfg.GetDataFileType())
+	}
+
+	// Sample number and time stamp, analog values, then digital status words of 16 channels each
+	rd.recordSize = 8 + rd.analog*rd.analogSize + (rd.digital+15)/16*2
+	rd.present = len(content) / rd.recordSize
+	return rd, nil
+}
+
+// Returns the stored value of analog channel ch (0-based) at sample i,
+// NaN if the sample is marked as missing
+func (rd *datReader) getAnalog(i, ch int) (float64, error) {
+	if rd.fileType == FileTypeASCII {
+		field := ByteToString(rd.rows[i][2+ch])
+		if field == "" {
+			return math.NaN(), nil
+		}
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return 0, fmt.Errorf("dat format error: sample %d analog channel %d: %v", i+1, ch+1, err)
+		}
+		return value, nil
+	}
+
+	offset := i*rd.recordSize + 8 + ch*rd.analogSize
+	switch rd.fileType {
+	case FileTypeBinary:
+		value := int16(binary.LittleEndian.Uint16(rd.content[offset:]))
+		if value == MissingBinary {
+			return math.NaN(), nil
+		}
+		return float64(value), nil
+	case FileTypeBinary32:
+		value := int32(binary.LittleEndian.Uint32(rd.content[offset:]))
+		if value == MissingBinary32 {
+			return math.NaN(), nil
+		}
+		return float64(value), nil
+	}
+	// FLOAT32 has no sentinel, a NaN stored by the recorder stays NaN
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(rd.content[offset:]))), nil
+}
+
+// Returns the sample number stored at sample i
+func (rd *datReader) getSampleNumber(i int) (int64, error) {
+	if rd.fileType == FileTypeASCII {
+		value, err := strconv.ParseInt(ByteToString(rd.rows[i][0]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("dat format error: sample %d number: %v", i+1, err)
+		}
+		return value, nil
+	}
+	return int64(binary.LittleEndian.Uint32(rd.content[i*rd.recordSize:])), nil
+}
+
+// Returns the time stamp stored at sample i, false if it is missing
+func (rd *datReader) getTimestamp(i int) (int64, bool, error) {
+	if rd.fileType == FileTypeASCII {
+		field := ByteToString(rd.rows[i][1])
+		if field == "" {
+			return 0, false, nil
+		}
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("dat format error: sample %d time stamp: %v", i+1, err)
+		}
+		return value, true, nil
+	}
+	value := binary.LittleEndian.Uint32(rd.content[i*rd.recordSize+4:])
+	if value == 0xFFFFFFFF {
+		return 0, false, nil
+	}
+	return int64(value), true, nil
+}
+
+// Returns the status of digital channel ch (0-based) at sample i
+func (rd *datReader) getDigital(i, ch int) (uint8, error) {
+	if rd.fileType == FileTypeASCII {
+		value, err := strconv.ParseUint(ByteToString(rd.rows[i][2+rd.analog+ch]), 10, 8)
+		if err != nil {
+			return 0, fmt.Errorf("dat format error: sample %d digital channel %d: %v", i+1, ch+1, err)
+		}
+		return uint8(value), nil
+	}
+	offset := i*rd.recordSize + 8 + rd.analog*rd.analogSize + ch/16*2
+	return uint8(binary.LittleEndian.Uint16(rd.content[offset:]) >> uint(ch%16) & 1), nil
+}
+
+// Returns the time of every sample in seconds from the start time
+// fixed sampling rates are used when given, time stamps otherwise
+func (cfg *CFG) GetSampleTimes() ([]float64, error) {
+	rd, err := cfg.newDatReader()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.sampleTimes(rd)
+}
+
+// Computes the time of every sample of the data file read by rd
+func (cfg *CFG) sampleTimes(rd *datReader) ([]float64, error) {
+	result := make([]float64, rd.samples)
+	sampleDetail := cfg.GetSampleDetail()
+	if sampleDetail[0].GetRate() > 0 {
+		var start float64
+		first := 0
+		for _, rate := range sampleDetail {
+			if rate.GetRate() <= 0 {
+				return nil, errors.New("invalid sampling rate")
+			}
+			for i := first; i < rate.GetNumber() && i < len(result); i++ {
+				result[i] = start + float64(i-first)/rate.GetRate()
+			}
+			if rate.GetNumber() > first {
+				start += float64(rate.GetNumber()-first) / rate.GetRate()
+				first = rate.GetNumber()
+			}
+		}
+		return result, nil
+	}
+
+	// Time stamps are in microseconds, multiplied by the time factor
+	factor := cfg.GetTimeFactor()
+	if factor == 0 {
+		factor = 1
+	}
+	for i := range result {
+		stamp, ok, err := rd.getTimestamp(i)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("missing time stamp at sample %d without sampling rate", i+1)
+		}
+		result[i] = float64(stamp) * factor * 1e-6
+	}
+	return result, nil
+}
+
+// Return the digital channel status of every sample
+// num is the number of the channel as in .cfg file
+func (cfg *CFG) GetDigitalChannelData(num uint16) (result []uint8, err error) {
+	rd, err := cfg.newDatReader()
+	if err != nil {
+		return nil, err
+	}
+	return rd.digitalData(num)
+}
+
+// Decodes digital channel num from the data file
+func (rd *datReader) digitalData(num uint16) (result []uint8, err error) {
+	if int(num) > rd.digital {
+		return nil, errors.New("digital channel number greater than the total number of channels")
+	}
+
+	if num < 1 {
+		return nil, errors.New("digital channel number cannot be less than 1")
+	}
+
+	result = make([]uint8, rd.samples)
+	for i := range result {
+		if result[i], err = rd.getDigital(i, int(num)-1); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetSamples returns the time of every sample and the values of every channel in .cfg order,
+// reading the data file once: times as GetSampleTimes returns them, analog values as
+// GetAnalogChannelDataScaled does
+func (cfg *CFG) GetSamples(scaling Scaling) (times []float64, analog [][]float64, digital [][]uint8, err error) {
+	t, err := cfg.decodeTable(nil, nil, scaling)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return t.times, t.values, t.states, nil
+}
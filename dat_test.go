@@ -0,0 +1,138 @@
+package comgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Configuration of 3 samples at 1 kHz of VA, with factors a = 0.5 and b = 1, and TRIP,
+// the data file type left to format
+const testDatCFG = `S,D,1999
+2,1A,1D
+1,VA,A,,V,0.5,1,0,-32767,32767,1,1,P
+1,TRIP,,,0
+50
+1
+1000,3
+01/01/2020,00:00:00.000000
+01/01/2020,00:00:00.001000
+%s
+1
+`
+
+// Returns binary samples of VA and TRIP, put encoding the stored analog values of size bytes
+func testBinaryDAT(size int, stored []float64, put func(b []byte, v float64)) []byte {
+	var buf bytes.Buffer
+	for i, v := range stored {
+		b := make([]byte, 8+size+2)
+		binary.LittleEndian.PutUint32(b, uint32(i+1))
+		binary.LittleEndian.PutUint32(b[4:], uint32(i*1000))
+		put(b[8:], v)
+		binary.LittleEndian.PutUint16(b[8+size:], uint16(testTRIP[i]))
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeDataFileTypes(t *testing.T) {
+	stored := []float64{10, 0, -4}
+	for _, tc := range []struct {
+		fileType string
+		dat      []byte
+	}{
+		{FileTypeASCII, []byte("1,0,10,0\n2,1000,,0\n3,2000,-4,1\n\x1a")},
+		{FileTypeBinary, testBinaryDAT(2, stored, func(b []byte, v float64) {
+			if v == 0 {
+				v = MissingBinary
+			}
+			binary.LittleEndian.PutUint16(b, uint16(int16(v)))
+		})},
+		{FileTypeBinary32, testBinaryDAT(4, stored, func(b []byte, v float64) {
+			if v == 0 {
+				v = MissingBinary32
+			}
+			binary.LittleEndian.PutUint32(b, uint32(int32(v)))
+		})},
+		{FileTypeFloat32, testBinaryDAT(4, stored, func(b []byte, v float64) {
+			if v == 0 {
+				v = math.NaN()
+			}
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+		})},
+	} {
+		t.Run(tc.fileType, func(t *testing.T) {
+			cfg := NewCFG()
+			if err := cfg.ReadCFG(strings.NewReader(fmt.Sprintf(testDatCFG, tc.fileType))); err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.ReadDAT(bytes.NewReader(tc.dat)); err != nil {
+				t.Fatal(err)
+			}
+			times, err := cfg.GetSampleTimes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFloats(t, "times", times, []float64{0, 0.001, 0.002}, 1e-12)
+
+			// The second sample is missing, whatever the scaling
+			values, err := cfg.GetAnalogChannelData(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFloats(t, "VA", values, []float64{6, math.NaN(), -1}, 1e-12)
+			raw, err := cfg.GetAnalogChannelDataScaled(1, ScaleRaw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFloats(t, "VA raw", raw, []float64{10, math.NaN(), -4}, 1e-12)
+
+			states, err := cfg.GetDigitalChannelData(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(states, testTRIP[:3]) {
+				t.Errorf("got TRIP %v, want %v", states, testTRIP[:3])
+			}
+		})
+	}
+}
+
+func TestDecodeTruncatedDataFile(t *testing.T) {
+	cfg := NewCFG()
+	if err := cfg.ReadCFG(strings.NewReader(fmt.Sprintf(testDatCFG, FileTypeBinary))); err != nil {
+		t.Fatal(err)
+	}
+	dat := testBinaryDAT(2, []float64{1, 2, 3}, func(b []byte, v float64) {
+		binary.LittleEndian.PutUint16(b, uint16(int16(v)))
+	})
+	if err := cfg.ReadDAT(bytes.NewReader(dat[:len(dat)-1])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.GetAnalogChannelData(1); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("got %v, want a truncated dat file error", err)
+	}
+}
+
+// Records written by SetSamples read back the same for every data file type,
+// NaN being written as the missing sample marker
+func TestSetSamplesDataFileTypes(t *testing.T) {
+	for _, fileType := range []string{FileTypeASCII, FileTypeBinary, FileTypeBinary32, FileTypeFloat32} {
+		t.Run(fileType, func(t *testing.T) {
+			rec := testRecord(t, fileType)
+			values, err := rec.GetAnalogChannelData(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFloats(t, "IA", values, testIA, 1e-3)
+			va, err := rec.GetAnalogChannelData(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFloats(t, "VA", va, testVA, 1e-2)
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ValleyZw/comgo"
+	"github.com/ValleyZw/comgo/library"
+)
+
+// Export formats by the extension of the output file
+var formatExtensions = map[string]string{
+	".csv":     "csv",
+	".json":    "json",
+	".ndjson":  "ndjson",
+	".jsonl":   "ndjson",
+	".parquet": "parquet",
+	".mat":     "mat",
+	".pqd":     "pqdif",
+	".pqdif":   "pqdif",
+	".lp":      "influx",
+}
+
+/*
+ * outputSummary - Result of a command writing a file
+ * @Output: Path of the file or record written
+ * @FileType: Data file type of a written record
+ * @Analog: Number of analog channels written
+ * @Digital: Number of digital channels written
+ * @Samples: Number of samples written
+ */
+type outputSummary struct {
+	Output   string `json:"output"`
+	FileType string `json:"file_type,omitempty"`
+	Analog   int    `json:"analog"`
+	Digital  int    `json:"digital"`
+	Samples  int    `json:"samples"`
+}
+
+// Prints the summary as text or JSON
+func (s outputSummary) print(asJSON bool) error {
+	if asJSON {
+		return printJSON(s)
+	}
+	fileType := ""
+	if s.FileType != "" {
+		fileType = " " + s.FileType
+	}
+	fmt.Printf("wrote %s:%s %d analog and %d digital channels, %d samples\n", s.Output, fileType, s.Analog, s.Digital, s.Samples)
+	return nil
+}
+
+// Counts the selected channels, nil selecting every channel of total
+func countChannels(selection []uint16, total uint16) int {
+	if selection == nil {
+		return int(total)
+	}
+	return len(selection)
+}
+
+// Returns the number of samples, the end sample of the last sampling rate
+func sampleCount(cfg *comgo.CFG) int {
+	rates := cfg.GetSampleDetail()
+	if len(rates) == 0 {
+		return 0
+	}
+	return rates[len(rates)-1].GetNumber()
+}
+
+// Returns the summary of the record saved as name
+func recordSummary(name string, cfg *comgo.CFG) outputSummary {
+	return outputSummary{
+		Output:   name + comgo.ExtCFG,
+		FileType: cfg.GetDataFileType(),
+		Analog:   int(cfg.GetAnalogDetail().GetChannelTotal()),
+		Digital:  int(cfg.GetDigitDetail().GetChannelTotal()),
+		Samples:  sampleCount(cfg),
+	}
+}
+
+// Returns the record name of an output path, without a record file extension
+func outputRecordName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case comgo.ExtCFG, comgo.ExtDAT:
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// Checks that saving as out does not overwrite the files being read
+func checkOverwrite(input, out string) error {
+	inputAbs, err := filepath.Abs(outputRecordName(input))
+	if err != nil {
+		return err
+	}
+	outAbs, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(inputAbs, outAbs) {
+		return usagef("output %s would overwrite the input", out)
+	}
+	return nil
+}
+
+func runExport(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	var format, output, scaling, timeColumn, delimiter, measurement string
+	var precision, batch int
+	var compress, jsonOutput bool
+	var channels channelFlags
+	tags := make(map[string]string)
+	fs.StringVar(&format, "f", "", "`format`: csv, json, ndjson, parquet, mat, pqdif or influx, from the output extension by default, else csv")
+	fs.StringVar(&format, "format", "", "`format`")
+	fs.StringVar(&output, "o", "-", "output `file`, - for stdout")
+	fs.StringVar(&output, "output", "-", "output `file`")
+	channels.define(fs)
+	fs.StringVar(&scaling, "s", "recorded", "`scaling` of analog values: recorded, primary, secondary or raw")
+	fs.StringVar(&scaling, "scaling", "recorded", "`scaling` of analog values")
+	fs.StringVar(&timeColumn, "time", "absolute", "csv time column: absolute, relative or index")
+	fs.StringVar(&delimiter, "delimiter", ",", "csv field delimiter")
+	fs.IntVar(&precision, "precision", -1, "csv decimal places, -1 for full precision")
+	fs.BoolVar(&compress, "compress", false, "compress parquet pages or pqdif records")
+	fs.StringVar(&measurement, "measurement", "comtrade", "influx measurement name")
+	fs.Func("tag", "influx `key=value` tag added to every point, may be repeated", func(s string) error {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("expected key=value, got %q", s)
+		}
+		tags[kv[0]] = kv[1]
+		return nil
+	})
+	fs.IntVar(&batch, "batch", comgo.DefaultBatchSize, "influx lines per write")
+	fs.BoolVar(&jsonOutput, "json", false, "print the summary as JSON")
+	name, err := parseRecordArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if format == "" {
+		format = "csv"
+		if f, ok := formatExtensions[strings.ToLower(filepath.Ext(output))]; ok {
+			format = f
+		}
+	}
+	format = strings.ToLower(format)
+	scale, err := parseScaling(scaling)
+	if err != nil {
+		return err
+	}
+	csvOpts := comgo.NewCSVOptions()
+	switch strings.ToLower(timeColumn) {
+	case "absolute":
+		csvOpts.Time = comgo.TimeAbsolute
+	case "relative":
+		csvOpts.Time = comgo.TimeRelative
+	case "index":
+		csvOpts.Time = comgo.TimeIndex
+	default:
+		return usagef("unknown time column %q, expected absolute, relative or index", timeColumn)
+	}
+	d := []rune(delimiter)
+	if len(d) != 1 {
+		return usagef("delimiter must be a single character")
+	}
+	csvOpts.Delimiter = d[0]
+
+	rec, err := openRecord(name)
+	if err != nil {
+		return err
+	}
+	analog, digital, err := channels.resolve(rec.CFG)
+	if err != nil {
+		return err
+	}
+	csvOpts.Analog, csvOpts.Digital, csvOpts.Scaling = analog, digital, scale
+	if precision >= 0 {
+		csvOpts.Decimals = &precision
+	}
+
+	var write func(w io.Writer) error
+	switch format {
+	case "csv":
+		write = func(w io.Writer) error { return rec.WriteCSV(w, csvOpts) }
+	case "json":
+		write = func(w io.Writer) error {
+			return rec.WriteJSON(w, comgo.JSONOptions{Analog: analog, Digital: digital, Scaling: scale})
+		}
+	case "ndjson":
+		write = func(w io.Writer) error {
+			return rec.WriteNDJSON(w, comgo.JSONOptions{Analog: analog, Digital: digital, Scaling: scale})
+		}
+	case "parquet":
+		write = func(w io.Writer) error {
+			return rec.WriteParquet(w, comgo.ParquetOptions{Analog: analog, Digital: digital, Scaling: scale, Compress: compress})
+		}
+	case "mat":
+		write = func(w io.Writer) error {
+			return rec.WriteMAT(w, comgo.MATOptions{Analog: analog, Digital: digital, Scaling: scale})
+		}
+	case "pqdif":
+		write = func(w io.Writer) error {
+			return rec.WritePQDIF(w, comgo.PQDIFOptions{Analog: analog, Digital: digital, Scaling: scale, Compress: compress})
+		}
+	case "influx":
+		write = func(w io.Writer) error {
+			return rec.WriteLineProtocol(w, comgo.LineProtocolOptions{
+				Analog:      analog,
+				Digital:     digital,
+				Scaling:     scale,
+				Measurement: measurement,
+				Tags:        tags,
+				BatchSize:   batch,
+			})
+		}
+	default:
+		return usagef("unknown format %q", format)
+	}
+
+	if err := writeOutput(output, write); err != nil {
+		return err
+	}
+	if output == "-" {
+		return nil
+	}
+	return outputSummary{
+		Output:  output,
+		Analog:  countChannels(analog, rec.GetAnalogDetail().GetChannelTotal()),
+		Digital: countChannels(digital, rec.GetDigitDetail().GetChannelTotal()),
+		Samples: sampleCount(rec.CFG),
+	}.print(jsonOutput)
+}
+
+func runConvert(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	var output, fileType, mapping string
+	var jsonOutput bool
+	fs.StringVar(&output, "o", "", "output `record`, written as record.cfg and record.dat")
+	fs.StringVar(&output, "output", "", "output `record`")
+	fs.StringVar(&fileType, "t", "", "data file `type`: ascii, binary, binary32 or float32, that of the input by default")
+	fs.StringVar(&fileType, "type", "", "data file `type`")
+	fs.StringVar(&mapping, "m", "", "JSON mapping `spec` of a CSV input")
+	fs.StringVar(&mapping, "mapping", "", "JSON mapping `spec` of a CSV input")
+	fs.BoolVar(&jsonOutput, "json", false, "print the summary as JSON")
+	name, err := parseRecordArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return usagef("missing output record (-o)")
+	}
+	output = outputRecordName(output)
+	if fileType, err = parseFileType(fileType); err != nil {
+		return err
+	}
+	if err := checkOverwrite(name, output); err != nil {
+		return err
+	}
+
+	var rec *comgo.Record
+	if library.FileExt(name) == ".csv" {
+		var m comgo.CSVMapping
+		if mapping != "" {
+			f, err := os.Open(mapping)
+			if err != nil {
+				return err
+			}
+			spec, err := comgo.ReadCSVMapping(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			m = *spec
+		}
+		if fileType != "" {
+			m.FileType = fileType
+		}
+		if rec, err = comgo.OpenCSV(name, m); err != nil {
+			return err
+		}
+	} else {
+		if mapping != "" {
+			return usagef("a mapping applies to CSV inputs only")
+		}
+		if rec, err = openRecord(name); err != nil {
+			return err
+		}
+	}
+
+	if fileType != "" && !strings.EqualFold(fileType, rec.GetDataFileType()) {
+		cfg, err := rec.Extract(comgo.ExtractOptions{FileType: fileType})
+		if err != nil {
+			return err
+		}
+		rec.CFG = cfg
+	}
+	if err := rec.Save(output); err != nil {
+		return err
+	}
+	return recordSummary(output, rec.CFG).print(jsonOutput)
+}
+
+// Parses an optional number of seconds
+func parseSeconds(name, value string) (float64, bool, error) {
+	if value == "" {
+		return 0, false, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false, usagef("invalid %s %q", name, value)
+	}
+	return f, true, nil
+}
+
+func runSlice(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	var from, to, output, fileType string
+	var jsonOutput bool
+	var channels channelFlags
+	fs.StringVar(&from, "from", "", "start of the window in `seconds` from the trigger, negative before it")
+	fs.StringVar(&to, "to", "", "end of the window in `seconds` from the trigger")
+	channels.define(fs)
+	fs.StringVar(&output, "o", "", "output `record`, written as record.cfg and record.dat")
+	fs.StringVar(&output, "output", "", "output `record`")
+	fs.StringVar(&fileType, "t", "", "data file `type`: ascii, binary, binary32 or float32, that of the input by default")
+	fs.StringVar(&fileType, "type", "", "data file `type`")
+	fs.BoolVar(&jsonOutput, "json", false, "print the summary as JSON")
+	name, err := parseRecordArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return usagef("missing output record (-o)")
+	}
+	output = outputRecordName(output)
+	if fileType, err = parseFileType(fileType); err != nil {
+		return err
+	}
+	fromSeconds, hasFrom, err := parseSeconds("--from", from)
+	if err != nil {
+		return err
+	}
+	toSeconds, hasTo, err := parseSeconds("--to", to)
+	if err != nil {
+		return err
+	}
+	if hasFrom && hasTo && toSeconds < fromSeconds {
+		return usagef("--to %s precedes --from %s", to, from)
+	}
+	if err := checkOverwrite(name, output); err != nil {
+		return err
+	}
+
+	rec, err := openRecord(name)
+	if err != nil {
+		return err
+	}
+	analog, digital, err := channels.resolve(rec.CFG)
+	if err != nil {
+		return err
+	}
+
+	// The window is given from the trigger, Extract expects seconds from the start time
+	opts := comgo.ExtractOptions{Analog: analog, Digital: digital, FileType: fileType}
+	trigger := rec.GetTriggerTime().Sub(rec.GetStartTime()).Seconds()
+	if hasFrom {
+		opts.From = fromSeconds + trigger
+	}
+	if hasTo {
+		if opts.To = toSeconds + trigger; opts.To <= 0 {
+			return fmt.Errorf("the window ends before the first sample")
+		}
+	}
+	cfg, err := rec.Extract(opts)
+	if err != nil {
+		return err
+	}
+	rec.CFG = cfg
+	if err := rec.Save(output); err != nil {
+		return err
+	}
+	return recordSummary(output, rec.CFG).print(jsonOutput)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValleyZw/comgo"
+)
+
+/*
+ * segmentInfo - A sampling rate segment of a record
+ * @Rate: Sampling rate in Hz, 0 when samples are time stamped
+ * @FirstSample: Number of the first sample of the segment
+ * @LastSample: Number of the last sample of the segment
+ * @Duration: Seconds from the first sample of the segment to the first of the next, or to the last sample
+ */
+type segmentInfo struct {
+	Rate        float64 `json:"rate"`
+	FirstSample int     `json:"first_sample"`
+	LastSample  int     `json:"last_sample"`
+	Duration    float64 `json:"duration"`
+}
+
+/*
+ * recordInfo - JSON summary of a record
+ * @Name: Path of the record without extension
+ * @Samples: Number of samples
+ * @Duration: Seconds from the first to the last sample
+ * @PreTrigger: Seconds from the first sample to the trigger
+ * @PostTrigger: Seconds from the trigger to the last sample
+ * @Segments: Sampling rate segments
+ * @Stats: Statistics of the channels
+ * @HeaderText: Content of the header file, if any
+ */
+type recordInfo struct {
+	*comgo.JSONRecord
+	Name        string        `json:"name"`
+	Samples     int           `json:"samples"`
+	Duration    float64       `json:"duration"`
+	PreTrigger  float64       `json:"pre_trigger"`
+	PostTrigger float64       `json:"post_trigger"`
+	Segments    []segmentInfo `json:"segments"`
+	Stats       *recordStats  `json:"stats"`
+	HeaderText  string        `json:"header_text,omitempty"`
+}
+
+// Formats a sampling rate, 0 meaning time stamped samples
+func formatRate(rate float64) string {
+	if rate == 0 {
+		return "time stamped"
+	}
+	return fmt.Sprintf("%g Hz", rate)
+}
+
+// Formats a number of seconds
+func formatSeconds(s float64) string {
+	return fmt.Sprintf("%.6f s", s)
+}
+
+// Formats the ratio of an analog channel, "-" without ratio
+func formatRatio(ch comgo.JSONAnalogChannel) string {
+	if ch.Primary == nil || ch.Secondary == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%g/%g", *ch.Primary, *ch.Secondary)
+}
+
+// Returns text with uniform line endings and without trailing blank lines
+func headerText(content []byte) string {
+	text := strings.Replace(string(content), "\r\n", "\n", -1)
+	return strings.TrimRight(text, "\r\n\t \x00\x1a")
+}
+
+// Splits the samples into the segments of the sampling rates, times being seconds
+// from the start time of each sample
+func recordSegments(cfg *comgo.CFG, times []float64) []segmentInfo {
+	var segments []segmentInfo
+	first := 0
+	for _, rate := range cfg.GetSampleDetail() {
+		last := rate.GetNumber()
+		if last > len(times) {
+			last = len(times)
+		}
+		if last <= first {
+			continue
+		}
+		// A segment ends where the next one starts, the last one on the last sample
+		// so that the durations add up to the duration of the record
+		end := times[last-1]
+		if last < len(times) {
+			end = times[last]
+		}
+		segments = append(segments, segmentInfo{
+			Rate:        rate.GetRate(),
+			FirstSample: first + 1,
+			LastSample:  last,
+			Duration:    end - times[first],
+		})
+		first = last
+	}
+	return segments
+}
+
+func runInfo(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	jsonOutput := fs.Bool("json", false, "print JSON")
+	var channels channelFlags
+	channels.define(fs)
+	name, err := parseRecordArg(fs, args)
+	if err != nil {
+		return err
+	}
+	rec, err := openRecord(name)
+	if err != nil {
+		return err
+	}
+	cfg := rec.CFG
+	analog, digital, err := channels.resolve(cfg)
+	if err != nil {
+		return err
+	}
+	m, err := cfg.ToJSON(comgo.JSONOptions{Analog: analog, Digital: digital, MetadataOnly: true})
+	if err != nil {
+		return err
+	}
+	stats, err := computeStats(rec, analog, digital, comgo.ScaleRecorded)
+	if err != nil {
+		return err
+	}
+	times, err := cfg.GetSampleTimes()
+	if err != nil {
+		return err
+	}
+
+	info := recordInfo{
+		JSONRecord: m,
+		Name:       rec.Name,
+		Samples:    len(times),
+		Segments:   recordSegments(cfg, times),
+		Stats:      stats,
+		HeaderText: headerText(rec.Header),
+	}
+	trigger := cfg.GetTriggerTime().Sub(cfg.GetStartTime()).Seconds()
+	if len(times) > 0 {
+		info.Duration = times[len(times)-1] - times[0]
+		info.PreTrigger = trigger - times[0]
+		info.PostTrigger = times[len(times)-1] - trigger
+	}
+	if *jsonOutput {
+		return printJSON(info)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Record:\t%s\n", rec.Name)
+	fmt.Fprintf(tw, "Station:\t%s\n", cfg.GetStationName())
+	fmt.Fprintf(tw, "Device:\t%s\n", cfg.GetRecordDeviceId())
+	fmt.Fprintf(tw, "Revision:\t%d\n", cfg.GetRevisionYear())
+	fmt.Fprintf(tw, "File type:\t%s\n", cfg.GetDataFileType())
+	fmt.Fprintf(tw, "Line frequency:\t%d Hz\n", cfg.GetLineFrequency())
+	if cfg.GetTimeCode() != "" || cfg.GetLocalCode() != "" {
+		fmt.Fprintf(tw, "Time code:\t%s (local code %s)\n", cfg.GetTimeCode(), cfg.GetLocalCode())
+	}
+	fmt.Fprintf(tw, "Start time:\t%s\n", cfg.GetStartTime().Format(comgo.ISOTimeFormat))
+	fmt.Fprintf(tw, "Trigger time:\t%s\n", cfg.GetTriggerTime().Format(comgo.ISOTimeFormat))
+	fmt.Fprintf(tw, "Duration:\t%s, %d samples\n", formatSeconds(info.Duration), info.Samples)
+	fmt.Fprintf(tw, "Pre-trigger:\t%s\n", formatSeconds(info.PreTrigger))
+	fmt.Fprintf(tw, "Post-trigger:\t%s\n", formatSeconds(info.PostTrigger))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println("\nSampling")
+	tw = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  #\tRATE\tSAMPLES\tDURATION")
+	for i, s := range info.Segments {
+		fmt.Fprintf(tw, "  %d\t%s\t%d-%d\t%s\n", i+1, formatRate(s.Rate), s.FirstSample, s.LastSample, formatSeconds(s.Duration))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(m.Analog) > 0 {
+		fmt.Printf("\nAnalog channels (%d)\n", len(m.Analog))
+		tw = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  #\tNAME\tPHASE\tCCBM\tUNIT\tRATIO\tPS\tMIN\tMAX")
+		for i, ch := range m.Analog {
+			s := stats.Analog[i]
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", ch.Index, ch.OriginalName, ch.Phase, ch.Component, ch.Unit,
+				formatRatio(ch), ch.PS, formatStat(s.Min), formatStat(s.Max))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(m.Digital) > 0 {
+		fmt.Printf("\nDigital channels (%d)\n", len(m.Digital))
+		tw = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  #\tNAME\tPHASE\tCCBM\tINITIAL\tCHANGED")
+		for i, ch := range m.Digital {
+			s := stats.Digital[i]
+			changed := "no"
+			if s.Changes > 0 {
+				changed = fmt.Sprintf("yes, %d times, first at %+.6f s", s.Changes, float64(s.FirstChange))
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%d\t%s\n", ch.Index, ch.OriginalName, ch.Phase, ch.Component, ch.InitialState, changed)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if info.HeaderText != "" {
+		fmt.Println("\nHeader")
+		for _, line := range strings.Split(info.HeaderText, "\n") {
+			fmt.Println("  " + line)
+		}
+	}
+	return nil
+}
+
+func runChannels(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	jsonOutput := fs.Bool("json", false, "print JSON")
+	var channels channelFlags
+	channels.define(fs)
+	name, err := parseRecordArg(fs, args)
+	if err != nil {
+		return err
+	}
+	rec, err := openRecord(name)
+	if err != nil {
+		return err
+	}
+	analog, digital, err := channels.resolve(rec.CFG)
+	if err != nil {
+		return err
+	}
+	m, err := rec.ToJSON(comgo.JSONOptions{Analog: analog, Digital: digital, MetadataOnly: true})
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return printJSON(struct {
+			Analog  []comgo.JSONAnalogChannel  `json:"analog"`
+			Digital []comgo.JSONDigitalChannel `json:"digital"`
+		}{m.Analog, m.Digital})
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if len(m.Analog) > 0 {
+		fmt.Fprintln(tw, "ANALOG\tNAME\tPHASE\tCCBM\tUNIT\tPS")
+		for _, ch := range m.Analog {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", ch.Index, ch.OriginalName, ch.Phase, ch.Component, ch.Unit, ch.PS)
+		}
+	}
+	if len(m.Digital) > 0 {
+		if len(m.Analog) > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, "DIGITAL\tNAME\tPHASE\tCCBM\tINITIAL")
+		for _, ch := range m.Digital {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\n", ch.Index, ch.OriginalName, ch.Phase, ch.Component, ch.InitialState)
+		}
+	}
+	return tw.Flush()
+}
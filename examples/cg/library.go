@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValleyZw/comgo/library"
+)
+
+// Environment variable naming the default library directory
+const libraryEnv = "COMGO_LIBRARY"
+
+// Defines the library directory option of fs
+func defineLibrary(fs *flag.FlagSet) *string {
+	return fs.String("lib", os.Getenv(libraryEnv), "library `directory`, $"+libraryEnv+" by default")
+}
+
+// Opens the library dir
+func openLibrary(dir string) (*library.Library, error) {
+	if dir == "" {
+		return nil, usagef("missing library directory, set --lib or $%s", libraryEnv)
+	}
+	return library.Open(dir)
+}
+
+/*
+ * ingestResult - Result of adding a record to the library
+ * @Record: Path of the record given
+ * @ID: Identifier of the record in the library
+ * @Status: added, exists or failed
+ * @Error: Error adding the record, if any
+ */
+type ingestResult struct {
+	Record string `json:"record"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func runIngest(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	dir := defineLibrary(fs)
+	jsonOutput := fs.Bool("json", false, "print JSON")
+	paths, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return usagef("missing record or directory")
+	}
+	lib, err := openLibrary(*dir)
+	if err != nil {
+		return err
+	}
+
+	// Directories are searched for records, files are added as given
+	var names []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			names = append(names, path)
+			continue
+		}
+		found, err := findRecords(path)
+		if err != nil {
+			return err
+		}
+		names = append(names, found...)
+	}
+
+	results := []ingestResult{}
+	failed := false
+	for _, name := range names {
+		result := ingestResult{Record: name, Status: "added"}
+		e, err := lib.Import(name)
+		switch {
+		case err == library.ErrExists:
+			result.ID, result.Status = e.ID, "exists"
+		case err != nil:
+			result.Status, result.Error = "failed", err.Error()
+			failed = true
+		default:
+			result.ID = e.ID
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Fprintf(os.Stderr, "cg %s: %s\n", cmd.name, r.Error)
+				continue
+			}
+			fmt.Printf("%-7s %s %s\n", r.Status, r.ID, r.Record)
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// Splits a comma separated list, empty items skipped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+/*
+ * searchResult - A record found in the library
+ * @Entry: Index entry of the record
+ * @Path: Path of the .cfg or .cff file, to open the record
+ */
+type searchResult struct {
+	*library.Entry
+	Path string `json:"path"`
+}
+
+func runSearch(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	dir := defineLibrary(fs)
+	jsonOutput := fs.Bool("json", false, "print JSON")
+	paths := fs.Bool("paths", false, "print the path of each record only")
+	var q library.Query
+	var from, to, channels, operated string
+	fs.StringVar(&q.Station, "station", "", "station `name`")
+	fs.StringVar(&q.Device, "device", "", "recording device `id`")
+	fs.StringVar(&from, "from", "", "earliest trigger `time` in UTC, a date or RFC 3339 time")
+	fs.StringVar(&to, "to", "", "latest trigger `time` in UTC, a date standing for the whole day")
+	fs.StringVar(&channels, "channel", "", "comma separated analog or digital `channels` the records have")
+	fs.StringVar(&operated, "operated", "", "comma separated digital `channels` changing state")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected arguments %s", strings.Join(positional, " "))
+	}
+	if from != "" {
+		if q.From, err = library.ParseTime(from, false); err != nil {
+			return usagef("--from: %v", err)
+		}
+	}
+	if to != "" {
+		if q.To, err = library.ParseTime(to, true); err != nil {
+			return usagef("--to: %v", err)
+		}
+	}
+	q.Channels, q.Operated = splitList(channels), splitList(operated)
+
+	lib, err := openLibrary(*dir)
+	if err != nil {
+		return err
+	}
+	entries, err := lib.Search(q)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *jsonOutput:
+		results := make([]searchResult, 0, len(entries))
+		for _, e := range entries {
+			results = append(results, searchResult{e, lib.Path(e)})
+		}
+		return printJSON(results)
+	case *paths:
+		for _, e := range entries {
+			fmt.Println(lib.Path(e))
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTRIGGER (UTC)\tSTATION\tDEVICE\tDURATION\tNAME\tOPERATED")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.TriggerTimeUTC.Format("2006-01-02 15:04:05.000000"),
+			e.Station, e.Device, formatSeconds(e.Duration), e.Name, strings.Join(e.Changed, ","))
+	}
+	return tw.Flush()
+}
@@ -1,114 +1,105 @@
 package main
 
 import (
-	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/ValleyZw/comgo"
-	"log"
 	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
-	"time"
 )
 
-var data [][]string
-var (
-	flagFile    string
-	flagHelp    bool
-	flagChannel uint
-	flagDetail  bool
-	flagVersion bool
+// Exit codes of cg
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
 )
 
-func init() {
-	flag.StringVar(&flagFile, "f", "", "")
-	flag.StringVar(&flagFile, "file", "", "")
-	flag.BoolVar(&flagHelp, "h", false, "")
-	flag.BoolVar(&flagHelp, "help", false, "")
-	flag.UintVar(&flagChannel, "c", 1, "")
-	flag.UintVar(&flagChannel, "channel", 1, "")
-	flag.BoolVar(&flagDetail, "d", false, "")
-	flag.BoolVar(&flagDetail, "detail", false, "")
-	flag.BoolVar(&flagVersion, "v", false, "")
-	flag.BoolVar(&flagVersion, "version", false, "")
+/*
+ * command - A cg subcommand
+ * @name: Name given on the command line
+ * @usage: Arguments of the command
+ * @summary: One line description
+ * @run: Runs the command with the arguments following its name
+ */
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(cmd *command, args []string) error
+}
 
-	setFlag(flag.CommandLine)
+var commands = []*command{
+	{name: "info", usage: "[--json] record", summary: "summarize a record", run: runInfo},
+	{name: "channels", usage: "[--json] [-a channels] [-d channels] record", summary: "list analog and digital channels", run: runChannels},
+	{name: "export", usage: "[-f format] [-o file] [-a channels] [-d channels] [-s scaling] record", summary: "export channels to CSV, JSON, NDJSON, Parquet, MAT, PQDIF or line protocol", run: runExport},
+	{name: "convert", usage: "[-t type] [-m mapping] -o record input", summary: "convert a record, CEV, PQDIF or CSV file to a COMTRADE record", run: runConvert},
+	{name: "slice", usage: "[--from s] [--to s] [-a channels] [-d channels] [-t type] -o record record", summary: "extract a time window and channels to a new record", run: runSlice},
+	{name: "validate", usage: "[--json] record...", summary: "check records against the standard", run: runValidate},
+	{name: "plot", usage: "[-a channels] [-d channels] [--from s] [--to s] [--width n] [--height n] [-o image] record", summary: "draw channels in the terminal or to an SVG or PNG image", run: runPlot},
+	{name: "stats", usage: "[--json] [-a channels] [-d channels] [-s scaling] record", summary: "print per channel statistics", run: runStats},
+	{name: "ingest", usage: "[--lib dir] [--json] record...", summary: "add records and directories of records to a library", run: runIngest},
+	{name: "search", usage: "[--lib dir] [--station s] [--device s] [--from time] [--to time] [--channel names] [--operated names] [--json | --paths]", summary: "search the records of a library", run: runSearch},
 }
 
-func setFlag(flag *flag.FlagSet) {
-	flag.Usage = func() {
-		Help()
+// Returns the command called name, nil if there is none
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
 	}
+	return nil
 }
 
 func main() {
-	args := os.Args[1:]
-	arg, err := CommandLine(args)
+	args, err := CommandLine(os.Args[1:])
 	CheckError(err)
-	flag.CommandLine.Parse(arg)
-
-	if flagVersion {
-		Version()
-	}
+	os.Exit(run(args))
+}
 
-	if flagHelp {
+// Runs the command line and returns the exit code
+func run(args []string) int {
+	if len(args) == 0 {
 		Help()
+		return exitUsage
 	}
-
-	file, err := os.Open(flagFile)
-	defer file.Close()
-	CheckError(err)
-
-	cfg := comgo.New()
-	err = cfg.ReadCFG(file)
-	CheckError(err)
-
-	if flagDetail {
-		fmt.Println(cfg.GetAnalogChannelNames())
-		os.Exit(1)
-	}
-
-	var filename string
-
-	name := strings.TrimSuffix(flagFile, filepath.Ext(flagFile))
-	if exist := PathExists(name + ".dat"); exist {
-		filename = name + ".dat"
-	} else if exist := PathExists(name + ".DAT"); exist {
-		filename = name + ".DAT"
-	} else {
-		log.Fatal("Data file File not found.")
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		if len(args) > 1 {
+			if cmd := findCommand(args[1]); cmd != nil {
+				cmd.run(cmd, []string{"-h"})
+				return exitOK
+			}
+			fmt.Fprintf(os.Stderr, "cg: unknown command %q\n", args[1])
+			return exitUsage
+		}
+		Help()
+		return exitOK
+	case "-v", "-version", "--version", "version":
+		Version()
+		return exitOK
 	}
 
-	file, err = os.Open(filename)
-	defer file.Close()
-	CheckError(err)
-	err = cfg.ReadDAT(file)
-	CheckError(err)
-
-	res, err := cfg.GetAnalogChannelData(uint16(flagChannel))
-	CheckError(err)
-
-	ra := cfg.GetSamplingRate()
-	ti := cfg.GetStartTime()
-
-	for i := 0; i < cfg.GetSamplingNumber(); i++ {
-		s, _ := time.ParseDuration(strconv.FormatFloat(float64(i)/float64(ra), 'g', 1, 64) + "s")
-		x := ti.Add(s).Format(AxisFormat)
-		y := strconv.FormatFloat(res[i], 'f', -1, 32)
-		data = append(data, []string{x, y})
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "cg: unknown command %q\nRun 'cg help' for usage.\n", args[0])
+		return exitUsage
 	}
-
-	file, err = os.OpenFile(name+".csv", os.O_CREATE|os.O_WRONLY, 0777)
-	defer file.Close()
-	CheckError(err)
-
-	w := csv.NewWriter(file)
-	w.WriteAll(data) // calls Flush internally
-
-	if err := w.Error(); err != nil {
-		log.Fatalln("error writing csv:", err)
+	err := cmd.run(cmd, args[1:])
+	var usage *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errFailed):
+		return exitFailure
+	case errors.As(err, &usage):
+		if usage.msg != "" {
+			fmt.Fprintf(os.Stderr, "cg %s: %s\nRun 'cg help %s' for usage.\n", cmd.name, usage.msg, cmd.name)
+		}
+		return exitUsage
 	}
-	log.Println("success!")
+	fmt.Fprintf(os.Stderr, "cg %s: %v\n", cmd.name, err)
+	return exitFailure
 }
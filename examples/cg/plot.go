@@ -0,0 +1,512 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ValleyZw/comgo"
+	"github.com/ValleyZw/comgo/plot"
+)
+
+// Width of the value labels left of the charts
+const plotLabelWidth = 11
+
+/*
+ * canvas - Character grid plotting dots, several dots per character
+ * @cols: Number of characters per row
+ * @rows: Number of rows
+ * @xres: Dots per character horizontally
+ * @yres: Dots per character vertically
+ * @dots: Whether each dot is set, row by row
+ */
+type canvas struct {
+	cols, rows int
+	xres, yres int
+	dots       []bool
+}
+
+// Returns a canvas of cols by rows characters, made of braille patterns (2 by 4 dots)
+// or of half blocks (1 by 2 dots)
+func newCanvas(cols, rows int, braille bool) *canvas {
+	c := &canvas{cols: cols, rows: rows, xres: 1, yres: 2}
+	if braille {
+		c.xres, c.yres = 2, 4
+	}
+	c.dots = make([]bool, cols*c.xres*rows*c.yres)
+	return c
+}
+
+// Returns the canvas size in dots
+func (c *canvas) size() (int, int) {
+	return c.cols * c.xres, c.rows * c.yres
+}
+
+// Sets the dot at x, y, y going down
+func (c *canvas) set(x, y int) {
+	w, h := c.size()
+	if x >= 0 && x < w && y >= 0 && y < h {
+		c.dots[y*w+x] = true
+	}
+}
+
+// Sets the dots of column x from y0 to y1
+func (c *canvas) vline(x, y0, y1 int) {
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	for y := y0; y <= y1; y++ {
+		c.set(x, y)
+	}
+}
+
+// Braille dot bits by position in the 2 by 4 pattern
+var brailleBits = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// Returns the character at col, row, 0 when no dot is set
+func (c *canvas) char(col, row int) rune {
+	w, _ := c.size()
+	dot := func(dx, dy int) bool {
+		return c.dots[(row*c.yres+dy)*w+col*c.xres+dx]
+	}
+	if c.xres == 1 {
+		switch top, bottom := dot(0, 0), dot(0, 1); {
+		case top && bottom:
+			return '█'
+		case top:
+			return '▀'
+		case bottom:
+			return '▄'
+		}
+		return 0
+	}
+	var bits rune
+	for dy := 0; dy < 4; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			if dot(dx, dy) {
+				bits |= brailleBits[dy][dx]
+			}
+		}
+	}
+	if bits == 0 {
+		return 0
+	}
+	return 0x2800 + bits
+}
+
+/*
+ * plotWindow - Samples of a record shown by a plot
+ * @times: Time of the samples in seconds from the trigger
+ * @first: Index of the first sample shown
+ * @last: Index following the last sample shown
+ * @from: Time at the left edge
+ * @to: Time at the right edge
+ */
+type plotWindow struct {
+	times       []float64
+	first, last int
+	from, to    float64
+}
+
+// Returns the column of time t on a plot width dots wide, -1 outside of the window
+func (p *plotWindow) column(t float64, width int) int {
+	if t < p.from || t > p.to {
+		return -1
+	}
+	if p.to == p.from {
+		return 0
+	}
+	x := int((t - p.from) / (p.to - p.from) * float64(width))
+	if x >= width {
+		x = width - 1
+	}
+	return x
+}
+
+// Returns the lines of an analog chart of values: min-max of the samples of each dot column,
+// joined to the previous column, with the trigger marked where no dot is set
+func (p *plotWindow) analogChart(values []float64, cols, rows int, braille bool) ([]string, float64, float64) {
+	c := newCanvas(cols, rows, braille)
+	width, height := c.size()
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values[p.first:p.last] {
+		if !math.IsNaN(v) {
+			low, high = math.Min(low, v), math.Max(high, v)
+		}
+	}
+	if low > high {
+		low, high = 0, 0
+	}
+	y := func(v float64) int {
+		if high == low {
+			return height / 2
+		}
+		return int(math.Round((high - v) / (high - low) * float64(height-1)))
+	}
+
+	type span struct {
+		min, max, last float64
+		set            bool
+	}
+	spans := make([]span, width)
+	for i := p.first; i < p.last; i++ {
+		v := values[i]
+		x := p.column(p.times[i], width)
+		if x < 0 || math.IsNaN(v) {
+			continue
+		}
+		s := &spans[x]
+		if !s.set {
+			s.min, s.max, s.set = v, v, true
+		}
+		s.min, s.max, s.last = math.Min(s.min, v), math.Max(s.max, v), v
+	}
+	previous := -1
+	for x, s := range spans {
+		if !s.set {
+			continue
+		}
+		y0, y1 := y(s.max), y(s.min)
+		if previous >= 0 {
+			joint := y(spans[previous].last)
+			if joint < y0 {
+				y0 = joint
+			}
+			if joint > y1 {
+				y1 = joint
+			}
+		}
+		c.vline(x, y0, y1)
+		previous = x
+	}
+
+	trigger := p.column(0, width)
+	if trigger >= 0 {
+		trigger /= c.xres
+	}
+	lines := make([]string, rows)
+	for row := range lines {
+		var b strings.Builder
+		for col := 0; col < cols; col++ {
+			switch r := c.char(col, row); {
+			case r != 0:
+				b.WriteRune(r)
+			case col == trigger:
+				b.WriteRune('┊')
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		lines[row] = b.String()
+	}
+	return lines, low, high
+}
+
+// Returns the step lane of a digital channel: low, high, or a transition in the column
+func (p *plotWindow) digitalLane(states []uint8, cols int) string {
+	// State at the end of each column, -1 without sample, and whether it changes in the column
+	end := make([]int, cols)
+	for x := range end {
+		end[x] = -1
+	}
+	changed := make([]bool, cols)
+	for i := p.first; i < p.last; i++ {
+		x := p.column(p.times[i], cols)
+		if x < 0 {
+			continue
+		}
+		if end[x] >= 0 && end[x] != int(states[i]) {
+			changed[x] = true
+		}
+		end[x] = int(states[i])
+	}
+
+	trigger := p.column(0, cols)
+	var b strings.Builder
+	previous := -1
+	for x, s := range end {
+		if s < 0 {
+			// Columns between sparse samples keep the state
+			s = previous
+		} else if previous >= 0 && s != previous {
+			changed[x] = true
+		}
+		switch {
+		case changed[x]:
+			b.WriteRune('▐')
+		case s == 1:
+			b.WriteRune('█')
+		case x == trigger:
+			b.WriteRune('┊')
+		case s == 0:
+			b.WriteRune('▁')
+		default:
+			b.WriteByte(' ')
+		}
+		previous = s
+	}
+	return b.String()
+}
+
+// Returns the time axis: a rule with ticks, the trigger marked by ▲, and the tick labels
+func (p *plotWindow) axis(cols int) (string, string) {
+	rule := []rune(strings.Repeat("─", cols))
+	labels := []rune(strings.Repeat(" ", cols+12))
+	ticks := 4
+	if cols < 40 {
+		ticks = 2
+	}
+	for i := 0; i <= ticks; i++ {
+		x := i * (cols - 1) / ticks
+		rule[x] = '┬'
+		label := []rune(strconv.FormatFloat(p.from+(p.to-p.from)*float64(i)/float64(ticks), 'f', 3, 64) + "s")
+		start := x - len(label)/2
+		if start < 0 {
+			start = 0
+		}
+		if i == ticks {
+			start = x - len(label) + 1
+		}
+		free := true
+		for j := start - 1; j <= start+len(label) && j < len(labels); j++ {
+			if j >= 0 && labels[j] != ' ' {
+				free = false
+			}
+		}
+		if free {
+			copy(labels[start:], label)
+		}
+	}
+	if trigger := p.column(0, cols); trigger >= 0 {
+		rule[trigger] = '▲'
+	}
+	return string(rule), strings.TrimRight(string(labels), " ")
+}
+
+// Pads or truncates s to width characters
+func fitLabel(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n > width {
+		return string([]rune(s)[:width-1]) + "…"
+	} else if n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// Returns the terminal width from $COLUMNS, 100 when unknown
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 100
+}
+
+func runPlot(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	var analogSpec, digitalSpec, from, to, scaling, output string
+	var width, height int
+	var block bool
+	fs.StringVar(&analogSpec, "a", "", "analog `channels`, e.g. 1,3-5,IA, the first 4 by default")
+	fs.StringVar(&analogSpec, "analog", "", "analog `channels`")
+	fs.StringVar(&digitalSpec, "d", "changed", "digital `channels`, \"changed\" for those changing in the window")
+	fs.StringVar(&digitalSpec, "digital", "changed", "digital `channels`")
+	fs.StringVar(&from, "from", "", "start of the window in `seconds` from the trigger, negative before it")
+	fs.StringVar(&to, "to", "", "end of the window in `seconds` from the trigger")
+	fs.StringVar(&scaling, "s", "recorded", "`scaling` of analog values: recorded, primary, secondary or raw")
+	fs.StringVar(&scaling, "scaling", "recorded", "`scaling` of analog values")
+	fs.IntVar(&width, "width", 0, "plot width in `characters`, or pixels with -o, $COLUMNS or 100 characters and 960 pixels by default")
+	fs.IntVar(&height, "height", 0, "chart height in `rows`, or pixels with -o, 6 rows and 120 pixels by default")
+	fs.BoolVar(&block, "block", false, "draw with block characters instead of braille")
+	fs.StringVar(&output, "o", "", "write an SVG or PNG image to `file` instead of drawing in the terminal")
+	fs.StringVar(&output, "output", "", "image `file`")
+	name, err := parseRecordArg(fs, args)
+	if err != nil {
+		return err
+	}
+	scale, err := parseScaling(scaling)
+	if err != nil {
+		return err
+	}
+	fromSeconds, hasFrom, err := parseSeconds("--from", from)
+	if err != nil {
+		return err
+	}
+	toSeconds, hasTo, err := parseSeconds("--to", to)
+	if err != nil {
+		return err
+	}
+	format := strings.ToLower(filepath.Ext(output))
+	if output != "" && format != ".svg" && format != ".png" {
+		return usagef("unknown image format of %q, expected .svg or .png", output)
+	}
+	if height < 0 {
+		return usagef("negative --height %d", height)
+	}
+	if output == "" && width <= 0 {
+		width = terminalWidth()
+	}
+	if output == "" && height == 0 {
+		height = 6
+	}
+	cols := width - plotLabelWidth - 2
+	if output == "" && cols < 20 {
+		return usagef("plot too small, use --width 40 or more")
+	}
+
+	rec, err := openRecord(name)
+	if err != nil {
+		return err
+	}
+	total := rec.GetAnalogDetail().GetChannelTotal()
+	if analogSpec == "" {
+		analogSpec = "none"
+		if total > 0 {
+			analogSpec = fmt.Sprintf("1-%d", total)
+		}
+		if total > 4 {
+			analogSpec = "1-4"
+		}
+	}
+	analog, err := rec.SelectAnalogChannels(analogSpec)
+	if err != nil {
+		return err
+	}
+	if analog == nil {
+		analog = allChannels(total)
+	}
+	changedOnly := strings.EqualFold(digitalSpec, "changed")
+	if changedOnly {
+		digitalSpec = "all"
+	}
+	digital, err := rec.SelectDigitalChannels(digitalSpec)
+	if err != nil {
+		return err
+	}
+	if digital == nil {
+		digital = allChannels(rec.GetDigitDetail().GetChannelTotal())
+	}
+
+	if output != "" {
+		opts := plot.Options{
+			Analog:      analog,
+			Digital:     digital,
+			ChangedOnly: changedOnly,
+			Scaling:     scale,
+			From:        math.Inf(-1),
+			To:          math.Inf(1),
+			Width:       width,
+			PanelHeight: height,
+		}
+		if hasFrom {
+			opts.From = fromSeconds
+		}
+		if hasTo {
+			opts.To = toSeconds
+		}
+		if opts.To <= opts.From {
+			return usagef("empty time window %g..%g s", opts.From, opts.To)
+		}
+		chart, err := plot.New(rec.CFG, opts)
+		if err != nil {
+			return err
+		}
+		return writeOutput(output, func(w io.Writer) error {
+			if format == ".png" {
+				return chart.WritePNG(w)
+			}
+			return chart.WriteSVG(w)
+		})
+	}
+
+	times, err := rec.GetSampleTimes()
+	if err != nil {
+		return err
+	}
+	if len(times) == 0 {
+		return fmt.Errorf("%s: no sample", name)
+	}
+	trigger := rec.GetTriggerTime().Sub(rec.GetStartTime()).Seconds()
+	for i := range times {
+		times[i] -= trigger
+	}
+	p := &plotWindow{times: times, from: times[0], to: times[len(times)-1]}
+	if hasFrom {
+		p.from = fromSeconds
+	}
+	if hasTo {
+		p.to = toSeconds
+	}
+	if p.to <= p.from {
+		return usagef("empty time window %g..%g s", p.from, p.to)
+	}
+	for p.first < len(times) && times[p.first] < p.from {
+		p.first++
+	}
+	p.last = p.first
+	for p.last < len(times) && times[p.last] <= p.to {
+		p.last++
+	}
+	if p.first == p.last {
+		return fmt.Errorf("no sample between %g and %g s from the trigger", p.from, p.to)
+	}
+
+	fmt.Printf("%s  %s  %s\n", rec.GetStationName(), rec.GetRecordDeviceId(), rec.GetTriggerTime().Format(comgo.ISOTimeFormat))
+	indent := strings.Repeat(" ", plotLabelWidth)
+	for _, num := range analog {
+		ch, err := rec.GetAnalogChannel(num)
+		if err != nil {
+			return err
+		}
+		values, err := rec.GetAnalogChannelDataScaled(num, scale)
+		if err != nil {
+			return err
+		}
+		lines, low, high := p.analogChart(values, cols, height, !block)
+		title := fmt.Sprintf("%d %s", ch.GetIndex(), ch.GetOriginalName())
+		if ch.GetUnit() != "" {
+			title += " [" + ch.GetUnit() + "]"
+		}
+		fmt.Printf("\n%s %s\n", indent, title)
+		for row, line := range lines {
+			label := ""
+			switch row {
+			case 0:
+				label = strconv.FormatFloat(high, 'g', 5, 64)
+			case len(lines) - 1:
+				label = strconv.FormatFloat(low, 'g', 5, 64)
+			}
+			fmt.Printf("%*s ┤%s\n", plotLabelWidth-1, label, line)
+		}
+	}
+
+	lanes := 0
+	for _, num := range digital {
+		ch, err := rec.GetDigitalChannel(num)
+		if err != nil {
+			return err
+		}
+		states, err := rec.GetDigitalChannelData(num)
+		if err != nil {
+			return err
+		}
+		if changedOnly && !plot.Changes(states[p.first:p.last]) {
+			continue
+		}
+		if lanes == 0 {
+			fmt.Println()
+		}
+		lanes++
+		fmt.Printf("%s ┤%s\n", fitLabel(ch.GetOriginalName(), plotLabelWidth-1), p.digitalLane(states, cols))
+	}
+
+	rule, labels := p.axis(cols)
+	fmt.Printf("%s └%s\n%s %s\n", indent[1:], rule, indent, labels)
+	fmt.Printf("%s time from the trigger (▲), %d samples shown\n", indent, p.last-p.first)
+	return nil
+}
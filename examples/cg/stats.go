@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValleyZw/comgo"
+)
+
+/*
+ * analogStats - Statistics of an analog channel
+ * @Index: Channel number
+ * @Name: Channel name
+ * @Unit: Channel units
+ * @Samples: Number of samples, missing ones included
+ * @Missing: Number of missing samples
+ * @Min: Smallest value
+ * @Max: Largest value
+ * @Mean: Average value
+ * @RMS: Root mean square value
+ */
+type analogStats struct {
+	Index   uint16          `json:"index"`
+	Name    string          `json:"name"`
+	Unit    string          `json:"unit"`
+	Samples int             `json:"samples"`
+	Missing int             `json:"missing"`
+	Min     comgo.JSONFloat `json:"min"`
+	Max     comgo.JSONFloat `json:"max"`
+	Mean    comgo.JSONFloat `json:"mean"`
+	RMS     comgo.JSONFloat `json:"rms"`
+}
+
+/*
+ * digitalStats - Statistics of a digital channel
+ * @Index: Channel number
+ * @Name: Channel name
+ * @Initial: Status of the first sample
+ * @Final: Status of the last sample
+ * @Changes: Number of status changes
+ * @FirstChange: Time of the first change in seconds from the trigger, null when unchanged
+ */
+type digitalStats struct {
+	Index       uint16          `json:"index"`
+	Name        string          `json:"name"`
+	Initial     uint8           `json:"initial"`
+	Final       uint8           `json:"final"`
+	Changes     int             `json:"changes"`
+	FirstChange comgo.JSONFloat `json:"first_change"`
+}
+
+// Computes the statistics of values, missing samples left out
+func computeAnalogStats(ch *comgo.AnalogChannel, values []float64) analogStats {
+	s := analogStats{Index: ch.GetIndex(), Name: ch.GetOriginalName(), Unit: ch.GetUnit(), Samples: len(values)}
+	min, max := math.Inf(1), math.Inf(-1)
+	var sum, squares float64
+	for _, v := range values {
+		if comgo.IsMissing(v) || math.IsNaN(v) {
+			s.Missing++
+			continue
+		}
+		min, max = math.Min(min, v), math.Max(max, v)
+		sum += v
+		squares += v * v
+	}
+	if n := float64(len(values) - s.Missing); n > 0 {
+		s.Min, s.Max = comgo.JSONFloat(min), comgo.JSONFloat(max)
+		s.Mean, s.RMS = comgo.JSONFloat(sum/n), comgo.JSONFloat(math.Sqrt(squares/n))
+	} else {
+		s.Min, s.Max, s.Mean, s.RMS = comgo.JSONFloat(math.NaN()), comgo.JSONFloat(math.NaN()), comgo.JSONFloat(math.NaN()), comgo.JSONFloat(math.NaN())
+	}
+	return s
+}
+
+// Computes the statistics of states, times being seconds from the trigger
+func computeDigitalStats(ch *comgo.DigitalChannel, states []uint8, times []float64) digitalStats {
+	s := digitalStats{Index: ch.GetIndex(), Name: ch.GetOriginalName(), FirstChange: comgo.JSONFloat(math.NaN())}
+	if len(states) == 0 {
+		return s
+	}
+	s.Initial, s.Final = states[0], states[len(states)-1]
+	for i := 1; i < len(states); i++ {
+		if states[i] != states[i-1] {
+			if s.Changes == 0 {
+				s.FirstChange = comgo.JSONFloat(times[i])
+			}
+			s.Changes++
+		}
+	}
+	return s
+}
+
+/*
+ * recordStats - Statistics of the selected channels of a record
+ * @Analog: Statistics of each analog channel
+ * @Digital: Statistics of each digital channel
+ */
+type recordStats struct {
+	Analog  []analogStats  `json:"analog"`
+	Digital []digitalStats `json:"digital"`
+}
+
+// Computes the statistics of the selected channels, nil selecting every channel of a kind
+func computeStats(rec *comgo.Record, analog, digital []uint16, scale comgo.Scaling) (*recordStats, error) {
+	if analog == nil {
+		analog = allChannels(rec.GetAnalogDetail().GetChannelTotal())
+	}
+	if digital == nil {
+		digital = allChannels(rec.GetDigitDetail().GetChannelTotal())
+	}
+
+	times, err := rec.GetSampleTimes()
+	if err != nil {
+		return nil, err
+	}
+	trigger := rec.GetTriggerTime().Sub(rec.GetStartTime()).Seconds()
+	for i := range times {
+		times[i] -= trigger
+	}
+
+	result := &recordStats{Analog: []analogStats{}, Digital: []digitalStats{}}
+	for _, num := range analog {
+		ch, err := rec.GetAnalogChannel(num)
+		if err != nil {
+			return nil, err
+		}
+		values, err := rec.GetAnalogChannelDataScaled(num, scale)
+		if err != nil {
+			return nil, err
+		}
+		result.Analog = append(result.Analog, computeAnalogStats(ch, values))
+	}
+	for _, num := range digital {
+		ch, err := rec.GetDigitalChannel(num)
+		if err != nil {
+			return nil, err
+		}
+		states, err := rec.GetDigitalChannelData(num)
+		if err != nil {
+			return nil, err
+		}
+		result.Digital = append(result.Digital, computeDigitalStats(ch, states, times))
+	}
+	return result, nil
+}
+
+// Formats a statistic, "-" when undefined
+func formatStat(v comgo.JSONFloat) string {
+	if math.IsNaN(float64(v)) {
+		return "-"
+	}
+	return fmt.Sprintf("%.6g", float64(v))
+}
+
+func runStats(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	jsonOutput := fs.Bool("json", false, "print JSON")
+	var channels channelFlags
+	channels.define(fs)
+	var scaling string
+	fs.StringVar(&scaling, "s", "recorded", "`scaling` of analog values: recorded, primary, secondary or raw")
+	fs.StringVar(&scaling, "scaling", "recorded", "`scaling` of analog values")
+	name, err := parseRecordArg(fs, args)
+	if err != nil {
+		return err
+	}
+	scale, err := parseScaling(scaling)
+	if err != nil {
+		return err
+	}
+	rec, err := openRecord(name)
+	if err != nil {
+		return err
+	}
+	analog, digital, err := channels.resolve(rec.CFG)
+	if err != nil {
+		return err
+	}
+	result, err := computeStats(rec, analog, digital, scale)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return printJSON(result)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	if len(result.Analog) > 0 {
+		fmt.Fprintln(tw, "ANALOG\tNAME\tUNIT\tMIN\tMAX\tMEAN\tRMS\tMISSING\t")
+		for _, s := range result.Analog {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t\n", s.Index, s.Name, s.Unit,
+				formatStat(s.Min), formatStat(s.Max), formatStat(s.Mean), formatStat(s.RMS), s.Missing)
+		}
+	}
+	if len(result.Digital) > 0 {
+		if len(result.Analog) > 0 {
+			fmt.Fprintln(tw, "\t")
+		}
+		fmt.Fprintln(tw, "DIGITAL\tNAME\tINITIAL\tFINAL\tCHANGES\tFIRST CHANGE (s)\t")
+		for _, s := range result.Digital {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%s\t\n", s.Index, s.Name, s.Initial, s.Final, s.Changes, formatStat(s.FirstChange))
+		}
+	}
+	return tw.Flush()
+}
@@ -2,20 +2,18 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
-)
-
-const AxisFormat = "2006-01-02T15:04:05.000Z"
 
-func PathExists(filePath string) bool {
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return false
-	}
-	return true
-}
+	"github.com/ValleyZw/comgo"
+	"github.com/ValleyZw/comgo/library"
+)
 
 func CommandLine(args []string) ([]string, error) {
 	// command line
@@ -42,36 +40,222 @@ func CheckError(err error) {
 }
 
 func Header() {
-	fmt.Println(`
-   ____   U  ___ u  __  __     ____    U  ___ u 
-U /"___|   \/"_ \/U|' \/ '|uU /"___|u   \/"_ \/ 
-\| | u     | | | |\| |\/| |/\| |  _ /   | | | | 
- | |/__.-,_| |_| | | |  | |  | |_| |.-,_| |_| | 
-  \____|\_)-\___/  |_|  |_|   \____| \_)-\___/  
- _// \\      \\   <<,-,,-.    _)(|_       \\    
-(__)(__)    (__)   (./  \.)  (__)__)     (__) 
+	fmt.Print(`
+   ____   U  ___ u  __  __     ____    U  ___ u
+U /"___|   \/"_ \/U|' \/ '|uU /"___|u   \/"_ \/
+\| | u     | | | |\| |\/| |/\| |  _ /   | | | |
+ | |/__.-,_| |_| | | |  | |  | |_| |.-,_| |_| |
+  \____|\_)-\___/  |_|  |_|   \____| \_)-\___/
+ _// \\      \\   <<,-,,-.    _)(|_       \\
+(__)(__)    (__)   (./  \.)  (__)__)     (__)
+
 `)
 }
 
-// Print ng help and exit
+// Print cg help
 func Help() {
-	fmt.Println(`comgo is a comtrade file parser.
+	fmt.Println(`cg is a comtrade file tool.
 
 Usage:
-	detail:  cg [-f] filepath [-d]
-	parse:   cg [-f] filepath [-c] channel No.
+	cg <command> [options] <record>
 
-options:
-	-f	--file		 cfg file path
+Commands:`)
+	for _, cmd := range commands {
+		fmt.Printf("\t%-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Println(`
+Records are named by their .cfg, .dat or .cff file, or without extension.
+SEL .cev, PQDIF .pqd and .zip archives are read as well.
+Channels are selected by number, range or name, e.g. -a 1,3-5,IA; "all" or "none".
+Records are kept in a library with ingest and found with search, the library being
+--lib or $COMGO_LIBRARY.
+
+Run 'cg help <command>' for the options of a command.
 	-h	--help		 information about the commands
-	-c	--channel	 channel No. to save
-	-d	--detail	 provide analog channel names
-	-v	--version	 print netgo version`)
-	os.Exit(1)
+	-v	--version	 print cg version`)
 }
 
-// Print ng version and exit
+// Print cg version
 func Version() {
-	fmt.Println(`comgo version cg[0.0.1]`)
-	os.Exit(1)
+	fmt.Println(`comgo version cg[0.1.0]`)
+}
+
+// errFailed reports a failure the command already printed, e.g. a failed validation
+var errFailed = errors.New("failed")
+
+// usageError reports a command line the command cannot run
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// Returns a usage error with a formatted message
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Returns the flag set of cmd, printing its usage and options on -h
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet("cg "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cg %s %s\n\n%s.\n\nOptions:\n", cmd.name, cmd.usage, strings.ToUpper(cmd.summary[:1])+cmd.summary[1:])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Parses args, flags may follow the positional arguments which are returned
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, err
+			}
+			// The flag package already printed the error and the usage
+			return nil, &usageError{}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Parses args expecting a single record name
+func parseRecordArg(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return "", err
+	}
+	switch len(positional) {
+	case 0:
+		return "", usagef("missing record")
+	case 1:
+		return positional[0], nil
+	}
+	return "", usagef("unexpected arguments %s", strings.Join(positional[1:], " "))
+}
+
+// Opens a COMTRADE record, a SEL compressed event report, a PQDIF file or a zip archive,
+// the first observation or record is used when the file holds several
+func openRecord(name string) (*comgo.Record, error) {
+	var records []*comgo.Record
+	var err error
+	switch library.FileExt(name) {
+	case ".cev":
+		return comgo.OpenCEV(name)
+	case ".pqd", ".pqdif":
+		records, err = comgo.OpenPQDIF(name)
+	case ".zip":
+		records, err = comgo.OpenZip(name)
+	default:
+		return comgo.Open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: no record found", name)
+	}
+	return records[0], nil
+}
+
+/*
+ * channelFlags - Channel selection options shared by the commands
+ * @analog: Analog channels, "all", "none" or a list of numbers, ranges and names
+ * @digital: Digital channels, same syntax
+ */
+type channelFlags struct {
+	analog  string
+	digital string
+}
+
+// Defines the -a and -d options, selecting every channel by default
+func (f *channelFlags) define(fs *flag.FlagSet) {
+	fs.StringVar(&f.analog, "a", "all", "analog `channels`, e.g. 1,3-5,IA")
+	fs.StringVar(&f.analog, "analog", "all", "analog `channels`")
+	fs.StringVar(&f.digital, "d", "all", "digital `channels`, e.g. 1,TRIP")
+	fs.StringVar(&f.digital, "digital", "all", "digital `channels`")
+}
+
+// Resolves the selection against cfg, nil selects every channel and an empty slice none
+func (f *channelFlags) resolve(cfg *comgo.CFG) (analog, digital []uint16, err error) {
+	analog, err = cfg.SelectAnalogChannels(f.analog)
+	if err != nil {
+		return nil, nil, err
+	}
+	digital, err = cfg.SelectDigitalChannels(f.digital)
+	if err != nil {
+		return nil, nil, err
+	}
+	return analog, digital, nil
+}
+
+// Returns the numbers of every channel of a kind
+func allChannels(total uint16) []uint16 {
+	nums := make([]uint16, total)
+	for i := range nums {
+		nums[i] = uint16(i + 1)
+	}
+	return nums
+}
+
+// Parses the name of a scaling
+func parseScaling(name string) (comgo.Scaling, error) {
+	scaling, err := comgo.ParseScaling(name)
+	if err != nil {
+		return 0, usagef("%v", err)
+	}
+	return scaling, nil
+}
+
+// Parses the name of a data file type, empty keeps the type of the record
+func parseFileType(name string) (string, error) {
+	switch strings.ToUpper(name) {
+	case "":
+		return "", nil
+	case comgo.FileTypeASCII, comgo.FileTypeBinary, comgo.FileTypeBinary32, comgo.FileTypeFloat32:
+		return strings.ToUpper(name), nil
+	}
+	return "", usagef("unknown file type %q, expected ascii, binary, binary32 or float32", name)
+}
+
+// Writes v as indented JSON to stdout
+func printJSON(v interface{}) error {
+	return writeJSON(os.Stdout, v)
+}
+
+// Writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Hands the file name, or stdout when name is "-", to write through a buffer
+func writeOutput(name string, write func(w io.Writer) error) error {
+	f := os.Stdout
+	if name != "-" {
+		var err error
+		if f, err = os.Create(name); err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriter(f)
+	err := write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if f != os.Stdout {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+	"github.com/ValleyZw/comgo/library"
+)
+
+/*
+ * jsonFinding - JSON encoding of a validation finding
+ * @Severity: info, warning or error
+ * @Code: Stable identifier of the check
+ * @Message: Human readable description
+ */
+type jsonFinding struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+/*
+ * recordResult - Validation result of a record
+ * @Record: Path of the file checked
+ * @OK: Whether the record passed
+ * @Error: Error opening the record, e.g. a parse error, if any
+ * @Findings: Findings of the validation
+ * @Duration: Seconds spent checking the record
+ */
+type recordResult struct {
+	Record   string        `json:"record"`
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Findings []jsonFinding `json:"findings"`
+	Duration float64       `json:"duration"`
+}
+
+/*
+ * validationReport - Validation results of every record checked
+ * @Records: Number of records checked
+ * @Failed: Number of records failing
+ * @Results: Result of each record in path order
+ */
+type validationReport struct {
+	Records int            `json:"records"`
+	Failed  int            `json:"failed"`
+	Results []recordResult `json:"results"`
+}
+
+// Opens and validates the record name, failing on findings of severity failOn or above
+func validateRecord(name string, failOn comgo.Severity) recordResult {
+	start := time.Now()
+	result := recordResult{Record: name, Findings: []jsonFinding{}}
+
+	rec, err := openRecord(name)
+	if err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start).Seconds()
+		return result
+	}
+	result.OK = true
+	for _, f := range rec.Validate().GetFindings() {
+		result.Findings = append(result.Findings, jsonFinding{f.Severity.String(), f.Code, f.Message})
+		if f.Severity >= failOn {
+			result.OK = false
+		}
+	}
+	result.Duration = time.Since(start).Seconds()
+	return result
+}
+
+// Returns the record files found under root: every .cfg and .cff file, and .dat files
+// without a .cfg file so that they are reported, compressed files included
+func findRecords(root string) ([]string, error) {
+	var cfgs, dats []string
+	hasCFG := make(map[string]bool)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		base := strings.ToLower(library.Stem(path))
+		switch library.FileExt(path) {
+		case comgo.ExtCFG:
+			hasCFG[base] = true
+			cfgs = append(cfgs, path)
+		case comgo.ExtCFF:
+			cfgs = append(cfgs, path)
+		case comgo.ExtDAT:
+			dats = append(dats, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range dats {
+		if !hasCFG[strings.ToLower(library.Stem(path))] {
+			cfgs = append(cfgs, path)
+		}
+	}
+	sort.Strings(cfgs)
+	return cfgs, nil
+}
+
+// Writes the report as text, one line per finding under each record
+func (r *validationReport) writeText(w io.Writer, verbose bool) {
+	for _, result := range r.Results {
+		switch {
+		case result.Error != "":
+			fmt.Fprintf(w, "FAIL %s\n\t%s\n", result.Record, result.Error)
+			continue
+		case !result.OK:
+			fmt.Fprintf(w, "FAIL %s\n", result.Record)
+		default:
+			fmt.Fprintf(w, "ok   %s\n", result.Record)
+			if !verbose {
+				continue
+			}
+		}
+		for _, f := range result.Findings {
+			fmt.Fprintf(w, "\t%-7s [%s] %s\n", f.Severity, f.Code, f.Message)
+		}
+	}
+	fmt.Fprintf(w, "%d records, %d failed\n", r.Records, r.Failed)
+}
+
+/*
+ * junitFailure - JUnit failure or error of a test case
+ * @Message: Short description
+ * @Type: Finding code or error kind
+ * @Text: Details
+ */
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+/*
+ * junitTestCase - JUnit test case, one per record
+ * @Name: Path of the record
+ * @ClassName: Folder of the record
+ * @Time: Seconds spent checking the record
+ * @Failure: Findings failing the record
+ * @Error: Error opening the record
+ * @SystemOut: Findings not failing the record
+ */
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+/*
+ * junitTestSuite - JUnit test suite of a validation
+ * @Name: Suite name
+ * @Tests: Number of records
+ * @Failures: Number of records with failing findings
+ * @Errors: Number of records that could not be read
+ * @Time: Seconds spent checking every record
+ * @TestCases: Result of each record
+ */
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// Writes the report as a JUnit XML test suite, one test case per record
+func (r *validationReport) writeJUnit(w io.Writer, failOn comgo.Severity) error {
+	suite := junitTestSuite{Name: "cg validate", Tests: r.Records}
+	var total float64
+	for _, result := range r.Results {
+		total += result.Duration
+		tc := junitTestCase{
+			Name:      result.Record,
+			ClassName: filepath.ToSlash(filepath.Dir(result.Record)),
+			Time:      fmt.Sprintf("%.3f", result.Duration),
+		}
+		var failing, other []string
+		var failingCodes []string
+		for _, f := range result.Findings {
+			line := fmt.Sprintf("%s [%s] %s", f.Severity, f.Code, f.Message)
+			if severity, ok := parseSeverity(f.Severity); ok && severity >= failOn {
+				failing = append(failing, line)
+				failingCodes = append(failingCodes, f.Code)
+			} else {
+				other = append(other, line)
+			}
+		}
+		switch {
+		case result.Error != "":
+			suite.Errors++
+			tc.Error = &junitFailure{Message: result.Error, Type: "parse-error", Text: result.Error}
+		case len(failing) > 0:
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: failing[0],
+				Type:    strings.Join(failingCodes, ","),
+				Text:    strings.Join(failing, "\n"),
+			}
+		}
+		tc.SystemOut = strings.Join(other, "\n")
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Parses the name of a severity
+func parseSeverity(name string) (comgo.Severity, bool) {
+	for _, s := range []comgo.Severity{comgo.SeverityInfo, comgo.SeverityWarning, comgo.SeverityError} {
+		if strings.EqualFold(name, s.String()) {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func runValidate(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	var format, output, failOn string
+	var jsonOutput, verbose bool
+	fs.StringVar(&format, "f", "text", "report `format`: text, junit or json")
+	fs.StringVar(&format, "format", "text", "report `format`")
+	fs.BoolVar(&jsonOutput, "json", false, "print the report as JSON, same as -f json")
+	fs.StringVar(&output, "o", "-", "report `file`, - for stdout")
+	fs.StringVar(&output, "output", "-", "report `file`")
+	fs.StringVar(&failOn, "fail-on", "error", "lowest `severity` failing a record: error, warning or info")
+	fs.BoolVar(&verbose, "verbose", false, "list the findings of passing records")
+	paths, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return usagef("missing record or directory")
+	}
+	if jsonOutput {
+		format = "json"
+	}
+	format = strings.ToLower(format)
+	switch format {
+	case "text", "junit", "json":
+	default:
+		return usagef("unknown format %q, expected text, junit or json", format)
+	}
+	severity, ok := parseSeverity(failOn)
+	if !ok {
+		return usagef("unknown severity %q, expected error, warning or info", failOn)
+	}
+
+	// Directories are searched for records, files are checked as given
+	var names []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			names = append(names, path)
+			continue
+		}
+		found, err := findRecords(path)
+		if err != nil {
+			return err
+		}
+		names = append(names, found...)
+	}
+
+	report := &validationReport{Results: []recordResult{}}
+	for _, name := range names {
+		result := validateRecord(name, severity)
+		report.Records++
+		if !result.OK {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	write := func(w io.Writer) error {
+		switch format {
+		case "json":
+			return writeJSON(w, report)
+		case "junit":
+			return report.writeJUnit(w, severity)
+		}
+		report.writeText(w, verbose)
+		return nil
+	}
+	if err := writeOutput(output, write); err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+	"github.com/ValleyZw/comgo/library"
+	"github.com/ValleyZw/comgo/plot"
+)
+
+// Largest upload kept in memory, larger files are buffered on disk
+const maxUploadMemory = 100 << 20
+
+// Largest upload accepted
+const maxUploadSize = 1 << 30
+
+/*
+ * recordSummary - JSON summary of a stored record
+ * @ID: Identifier of the record in the API
+ * @Name: File name of the record without extension
+ * @Station: Name of the station
+ * @Device: Identification of the recording device
+ * @StartTime: Date and time of the first sample
+ * @TriggerTime: Date and time of the trigger
+ * @Duration: Seconds from the first to the last sample
+ * @Samples: Number of samples
+ * @Analog: Number of analog channels
+ * @Digital: Number of digital channels
+ * @Origin: Milliseconds since the Unix epoch of the trigger in UTC
+ * @Uploaded: Time of the upload
+ */
+type recordSummary struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Station     string    `json:"station"`
+	Device      string    `json:"device"`
+	StartTime   time.Time `json:"start_time"`
+	TriggerTime time.Time `json:"trigger_time"`
+	Duration    float64   `json:"duration"`
+	Samples     int       `json:"samples"`
+	Analog      int       `json:"analog"`
+	Digital     int       `json:"digital"`
+	Origin      float64   `json:"origin"`
+	Uploaded    time.Time `json:"uploaded"`
+}
+
+/*
+ * recordDetail - JSON metadata of a stored record
+ * @ID: Identifier of the record in the API
+ * @Name: File name of the record without extension
+ * @Samples: Number of samples
+ * @From: Time of the first sample in seconds from the trigger
+ * @To: Time of the last sample in seconds from the trigger
+ * @ChangedDigital: Digital channels changing state during the record
+ * @Origin: Milliseconds since the Unix epoch of the trigger in UTC
+ * @Header: Content of the header file, if any
+ * @Uploaded: Time of the upload
+ */
+type recordDetail struct {
+	*comgo.JSONRecord
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Samples        int       `json:"samples"`
+	From           float64   `json:"from"`
+	To             float64   `json:"to"`
+	ChangedDigital []uint16  `json:"changed_digital"`
+	Origin         float64   `json:"origin"`
+	Header         string    `json:"header,omitempty"`
+	Uploaded       time.Time `json:"uploaded"`
+}
+
+/*
+ * analogSeries - Values of an analog channel
+ * @Index: Channel number
+ * @Name: Channel name as written in the .cfg file
+ * @Phase: Phase identification
+ * @Unit: Channel units
+ * @Times: Time of each value in seconds from the trigger when the channel has its own, after LTTB
+ * @Values: Value of each sample, null when missing
+ */
+type analogSeries struct {
+	Index  uint16            `json:"index"`
+	Name   string            `json:"name"`
+	Phase  string            `json:"phase"`
+	Unit   string            `json:"unit"`
+	Times  []float64         `json:"times,omitempty"`
+	Values []comgo.JSONFloat `json:"values"`
+}
+
+/*
+ * digitalSeries - States of a digital channel
+ * @Index: Channel number
+ * @Name: Channel name as written in the .cfg file
+ * @InitialState: Normal state of the channel
+ * @States: State of each sample
+ */
+type digitalSeries struct {
+	Index        uint16           `json:"index"`
+	Name         string           `json:"name"`
+	InitialState uint8            `json:"initial_state"`
+	States       comgo.JSONStates `json:"states"`
+}
+
+/*
+ * seriesData - Samples of a record in a time window
+ * @ID: Identifier of the record in the API
+ * @TriggerTime: Date and time of the trigger
+ * @Origin: Milliseconds since the Unix epoch of the trigger, in UTC with the offset of the request
+ * added, times on the axis shared by the records being Origin + 1000 * Times
+ * @Samples: Number of samples in the window
+ * @Reduced: Downsampling method applied, empty when every sample is returned
+ * @Times: Time of each value in seconds from the trigger, null when each channel has its own
+ * @Analog: Values of the analog channels requested, empty for digital series
+ * @Digital: States of the digital channels requested, empty for analog series
+ */
+type seriesData struct {
+	ID          string          `json:"id"`
+	TriggerTime time.Time       `json:"trigger_time"`
+	Origin      float64         `json:"origin"`
+	Samples     int             `json:"samples"`
+	Reduced     string          `json:"reduced"`
+	Times       []float64       `json:"times"`
+	Analog      []analogSeries  `json:"analog"`
+	Digital     []digitalSeries `json:"digital"`
+}
+
+// api - JSON REST API over the records of a store
+type api struct {
+	store *recordStore
+}
+
+// Writes v as JSON with the status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+// Writes the error as JSON with the status code
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// Answers requests with a method other than those allowed
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed, use %s", strings.Join(allowed, " or ")))
+}
+
+// Routes the requests under /api/records:
+//
+//	GET    /api/records                  list the records, ?station=&device=&from=2007-01-01&to=&channel=&operated=86_GC1
+//	                                     lists those matching
+//	POST   /api/records                  upload a record, multipart form of .cfg and .dat files or a .cff file
+//	GET    /api/records/{id}             metadata of a record
+//	DELETE /api/records/{id}             delete a record
+//	GET    /api/records/{id}/analog      analog values, ?channels=1,IA&from=-0.1&to=0.2&scaling=primary,
+//	                                     &width=800&method=lttb reduces windows of more than 2 samples per pixel,
+//	                                     &offset=0.012 shifts the origin of the record by seconds for this view
+//	GET    /api/records/{id}/digital     digital states, ?channels=&from=&to=&changed=true&width=&offset=
+//	GET    /api/records/{id}/plot.svg    chart image, also plot.png, ?analog=&digital=&from=&to=&width=,
+//	                                     digital channels changing in the window by default
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/records"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			a.handleList(w, r)
+		case http.MethodPost:
+			a.handleUpload(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	rec, err := a.store.get(parts[0])
+	if err != nil && err != library.ErrNotFound {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err == library.ErrNotFound || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no record %s", path))
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			a.handleRecord(w, rec)
+		case http.MethodDelete:
+			a.handleDelete(w, rec)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	switch parts[1] {
+	case "analog":
+		a.handleAnalog(w, r, rec)
+	case "digital":
+		a.handleDigital(w, r, rec)
+	case "plot.svg", "plot.png":
+		a.handlePlot(w, r, rec, filepath.Ext(parts[1]))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no resource %s", path))
+	}
+}
+
+// Returns the summary of a record from its index entry
+func summarize(e *library.Entry) recordSummary {
+	return recordSummary{
+		ID:          e.ID,
+		Name:        e.Name,
+		Station:     e.Station,
+		Device:      e.Device,
+		StartTime:   e.StartTime,
+		TriggerTime: e.TriggerTime,
+		Duration:    e.Duration,
+		Samples:     e.Samples,
+		Analog:      len(e.Analog),
+		Digital:     len(e.Digital),
+		Origin:      float64(e.TriggerTimeUTC.UnixNano()) / 1e6,
+		Uploaded:    e.Added,
+	}
+}
+
+// Parses the search criteria of a query, times being dates or RFC 3339 times in UTC
+// and channels comma separated
+func parseQuery(query url.Values) (library.Query, error) {
+	q := library.Query{Station: query.Get("station"), Device: query.Get("device")}
+	var err error
+	if from := query.Get("from"); from != "" {
+		if q.From, err = library.ParseTime(from, false); err != nil {
+			return q, fmt.Errorf("from: %v", err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if q.To, err = library.ParseTime(to, true); err != nil {
+			return q, fmt.Errorf("to: %v", err)
+		}
+	}
+	for _, c := range []struct {
+		param string
+		names *[]string
+	}{{"channel", &q.Channels}, {"operated", &q.Operated}} {
+		for _, name := range strings.Split(query.Get(c.param), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				*c.names = append(*c.names, name)
+			}
+		}
+	}
+	return q, nil
+}
+
+func (a *api) handleList(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	entries, err := a.store.search(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	summaries := []recordSummary{}
+	for _, e := range entries {
+		summaries = append(summaries, summarize(e))
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+// Stores an upload, a record already in the library is answered with 200 instead of 201
+func (a *api) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > maxUploadSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("upload of %d bytes too large, at most %d bytes", r.ContentLength, int64(maxUploadSize)))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	rec, files, err := readUpload(r.MultipartForm)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	stored, created, err := a.store.add(rec, files)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", "/api/records/"+stored.ID)
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, summarize(stored.entry))
+}
+
+func (a *api) handleDelete(w http.ResponseWriter, rec *storedRecord) {
+	ok, err := a.store.remove(rec.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no record %s", rec.ID))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) handleRecord(w http.ResponseWriter, rec *storedRecord) {
+	m, err := rec.ToJSON(comgo.JSONOptions{MetadataOnly: true})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	detail := recordDetail{
+		JSONRecord:     m,
+		ID:             rec.ID,
+		Name:           rec.Name,
+		Samples:        len(rec.times),
+		ChangedDigital: rec.changed,
+		Origin:         rec.origin(0),
+		Header:         string(rec.Header),
+		Uploaded:       rec.Uploaded,
+	}
+	if len(rec.times) > 0 {
+		detail.From, detail.To = rec.times[0], rec.times[len(rec.times)-1]
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// Parses a number of seconds from the query, def when absent
+func parseSeconds(query url.Values, key string, def float64) (float64, error) {
+	s := query.Get(key)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, fmt.Errorf("invalid %s %q, expected seconds from the trigger", key, s)
+	}
+	return v, nil
+}
+
+// Parses the offset of the query, seconds added to the times of the record correcting the clock
+// of the recorder in the view of the client, 0 when absent
+func parseOffset(query url.Values) (float64, error) {
+	s := query.Get("offset")
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid offset %q, expected seconds", s)
+	}
+	return v, nil
+}
+
+// Returns the indexes of the first sample and following the last sample of the window
+// given by the from and to query values, in seconds from the trigger
+func (rec *storedRecord) window(query url.Values) (int, int, error) {
+	from, err := parseSeconds(query, "from", math.Inf(-1))
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseSeconds(query, "to", math.Inf(1))
+	if err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		return 0, 0, fmt.Errorf("empty time window %g..%g s", from, to)
+	}
+	first := 0
+	for first < len(rec.times) && rec.times[first] < from {
+		first++
+	}
+	last := first
+	for last < len(rec.times) && rec.times[last] <= to {
+		last++
+	}
+	return first, last, nil
+}
+
+// Parses the width in pixels the samples are drawn on and the downsampling method,
+// width 0 returning every sample
+func parseReduction(query url.Values) (int, string, error) {
+	width := 0
+	if s := query.Get("width"); s != "" {
+		var err error
+		if width, err = strconv.Atoi(s); err != nil || width < 0 {
+			return 0, "", fmt.Errorf("invalid width %q, expected pixels", s)
+		}
+	}
+	method := strings.ToLower(query.Get("method"))
+	switch method {
+	case "":
+		method = methodMinMax
+	case methodMinMax, methodLTTB:
+	default:
+		return 0, "", fmt.Errorf("unknown method %q, expected %s or %s", method, methodMinMax, methodLTTB)
+	}
+	return width, method, nil
+}
+
+// Returns JSON encodings of values
+func jsonFloats(values []float64) []comgo.JSONFloat {
+	result := make([]comgo.JSONFloat, len(values))
+	for i, v := range values {
+		result[i] = comgo.JSONFloat(v)
+	}
+	return result
+}
+
+func (a *api) handleAnalog(w http.ResponseWriter, r *http.Request, rec *storedRecord) {
+	query := r.URL.Query()
+	channels, err := rec.SelectAnalogChannels(query.Get("channels"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	scaling, err := comgo.ParseScaling(query.Get("scaling"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	first, last, err := rec.window(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	width, method, err := parseReduction(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, err := parseOffset(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if channels == nil {
+		for _, ch := range rec.GetAnalogChannels() {
+			channels = append(channels, ch.GetIndex())
+		}
+	}
+
+	// Windows of more samples than two per pixel are reduced, zooming in returns every sample
+	times := rec.times[first:last]
+	data := seriesData{ID: rec.ID, TriggerTime: rec.GetTriggerTime(), Origin: rec.origin(offset), Samples: len(times), Times: times, Analog: []analogSeries{}, Digital: []digitalSeries{}}
+	var buckets []bucket
+	if width > 0 && len(times) > 2*width {
+		data.Reduced = method
+		data.Times = nil
+		if method == methodMinMax {
+			buckets = timeBuckets(times, width)
+			data.Times = minMaxTimes(times, buckets)
+		}
+	}
+	columns, err := rec.analog(scaling)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, num := range channels {
+		ch, err := rec.GetAnalogChannel(num)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		values := columns[num-1]
+		s := analogSeries{Index: ch.GetIndex(), Name: ch.GetOriginalName(), Phase: ch.GetPhase(), Unit: ch.GetUnit()}
+		switch values = values[first:last]; data.Reduced {
+		case methodMinMax:
+			s.Values = jsonFloats(minMaxValues(values, buckets))
+		case methodLTTB:
+			var reduced []float64
+			s.Times, reduced = lttb(times, values, 2*width)
+			s.Values = jsonFloats(reduced)
+		default:
+			s.Values = jsonFloats(values)
+		}
+		data.Analog = append(data.Analog, s)
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+func (a *api) handleDigital(w http.ResponseWriter, r *http.Request, rec *storedRecord) {
+	query := r.URL.Query()
+	channels, err := rec.SelectDigitalChannels(query.Get("channels"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	changedOnly, _ := strconv.ParseBool(query.Get("changed"))
+	first, last, err := rec.window(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	width, _, err := parseReduction(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, err := parseOffset(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if channels == nil {
+		for _, ch := range rec.GetDigitalChannels() {
+			channels = append(channels, ch.GetIndex())
+		}
+	}
+
+	// States are always reduced by min-max, keeping pulses shorter than a pixel
+	times := rec.times[first:last]
+	data := seriesData{ID: rec.ID, TriggerTime: rec.GetTriggerTime(), Origin: rec.origin(offset), Samples: len(times), Times: times, Analog: []analogSeries{}, Digital: []digitalSeries{}}
+	var buckets []bucket
+	if width > 0 && len(times) > 2*width {
+		data.Reduced = methodMinMax
+		buckets = timeBuckets(times, width)
+		data.Times = minMaxTimes(times, buckets)
+	}
+	for _, num := range channels {
+		ch, err := rec.GetDigitalChannel(num)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		states := rec.states[num-1][first:last]
+		if changedOnly && !plot.Changes(states) {
+			continue
+		}
+		if data.Reduced != "" {
+			states = minMaxStates(states, buckets)
+		}
+		data.Digital = append(data.Digital, digitalSeries{
+			Index:        ch.GetIndex(),
+			Name:         ch.GetOriginalName(),
+			InitialState: ch.GetInitialState(),
+			States:       comgo.JSONStates(states),
+		})
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+func (a *api) handlePlot(w http.ResponseWriter, r *http.Request, rec *storedRecord, format string) {
+	query := r.URL.Query()
+	opts := plot.Options{ChangedOnly: query.Get("digital") == ""}
+	var err error
+	if opts.Analog, err = rec.SelectAnalogChannels(query.Get("analog")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.Digital, err = rec.SelectDigitalChannels(query.Get("digital")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.Scaling, err = comgo.ParseScaling(query.Get("scaling")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.From, err = parseSeconds(query, "from", math.Inf(-1)); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.To, err = parseSeconds(query, "to", math.Inf(1)); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.To <= opts.From {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("empty time window %g..%g s", opts.From, opts.To))
+		return
+	}
+	if s := query.Get("width"); s != "" {
+		if opts.Width, err = strconv.Atoi(s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid width %q", s))
+			return
+		}
+	}
+	chart, err := plot.New(rec.CFG, opts)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if format == ".png" {
+		w.Header().Set("Content-Type", "image/png")
+		err = chart.WritePNG(w)
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = chart.WriteSVG(w)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
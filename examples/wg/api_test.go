@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+	"github.com/ValleyZw/comgo/library"
+)
+
+// Returns a record of station with an analog and a digital channel, and its .cfg and .dat files
+func testRecord(t *testing.T, name, station string) (*comgo.Record, []library.File) {
+	t.Helper()
+	cfg := comgo.NewCFG()
+	cfg.StationName, cfg.RecordDeviceId = station, "Relay 7"
+	cfg.LineFrequency = 50
+	cfg.DataFileType = comgo.FileTypeASCII
+	cfg.StartTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.TriggerTime = cfg.StartTime.Add(time.Millisecond)
+	cfg.AnalogDetail, cfg.DigitDetail = &comgo.ChannelA{}, &comgo.ChannelD{}
+	cfg.AnalogDetail.AddChannel(comgo.AnalogChannel{Number: 1, Name: "VA", OriginalName: "VA", Phase: "A", Unit: "V", Primary: 1, Secondary: 1, HasRatio: true})
+	cfg.DigitDetail.AddChannel(comgo.DigitalChannel{Number: 1, Name: "TRIP", OriginalName: "TRIP"})
+	if err := cfg.SetSamples([]float64{0, 0.001, 0.002}, [][]float64{{0, 1, 2}}, [][]uint8{{0, 1, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	var cfgFile, datFile bytes.Buffer
+	if err := cfg.WriteCFG(&cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.WriteDAT(&datFile); err != nil {
+		t.Fatal(err)
+	}
+	return &comgo.Record{CFG: &cfg, Name: name}, []library.File{
+		{Name: name + ".cfg", Content: cfgFile.Bytes()},
+		{Name: name + ".dat", Content: datFile.Bytes()},
+	}
+}
+
+// Returns a store keeping max records in memory over a library in a temporary directory,
+// removed by the returned function
+func testStore(t *testing.T, max int) (*recordStore, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "wg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib, err := library.Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return newRecordStore(lib, max), func() { os.RemoveAll(dir) }
+}
+
+// Sends a request to h, files being uploaded as a multipart form
+func serve(t *testing.T, h http.Handler, method, target string, files []library.File) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	var contentType string
+	if files != nil {
+		mw := multipart.NewWriter(&body)
+		for _, f := range files {
+			part, err := mw.CreateFormFile("files", f.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(f.Content)
+		}
+		if err := mw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		contentType = mw.FormDataContentType()
+	}
+	r := httptest.NewRequest(method, target, &body)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestServeHTTP(t *testing.T) {
+	store, cleanup := testStore(t, 4)
+	defer cleanup()
+	h := &api{store: store}
+	_, files := testRecord(t, "fault", "North")
+
+	w := serve(t, h, http.MethodPost, "/api/records", files)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status %d, want 201: %s", w.Code, w.Body)
+	}
+	var created recordSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Station != "North" || created.Analog != 1 || created.Digital != 1 {
+		t.Errorf("upload summary %+v", created)
+	}
+	if loc := w.Header().Get("Location"); loc != "/api/records/"+created.ID {
+		t.Errorf("Location %q", loc)
+	}
+
+	// The same files again are answered with the record stored first
+	w = serve(t, h, http.MethodPost, "/api/records", files)
+	var again recordSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &again); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || again.ID != created.ID {
+		t.Errorf("duplicate upload: status %d, ID %q, want 200 and %q", w.Code, again.ID, created.ID)
+	}
+
+	record := "/api/records/" + created.ID
+	for _, tc := range []struct {
+		method, target string
+		status         int
+		allow          string
+	}{
+		{http.MethodGet, "/api/records", http.StatusOK, ""},
+		{http.MethodGet, "/api/records?station=north&operated=TRIP", http.StatusOK, ""},
+		{http.MethodGet, "/api/records?from=yesterday", http.StatusBadRequest, ""},
+		{http.MethodPut, "/api/records", http.StatusMethodNotAllowed, "GET, POST"},
+		{http.MethodGet, record, http.StatusOK, ""},
+		{http.MethodPatch, record, http.StatusMethodNotAllowed, "GET, DELETE"},
+		{http.MethodGet, record + "/analog?channels=VA", http.StatusOK, ""},
+		{http.MethodGet, record + "/digital", http.StatusOK, ""},
+		{http.MethodGet, record + "/plot.svg", http.StatusOK, ""},
+		{http.MethodPost, record + "/analog", http.StatusMethodNotAllowed, "GET"},
+		{http.MethodGet, record + "/samples", http.StatusNotFound, ""},
+		{http.MethodGet, record + "/analog/1", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/records/0123456789abcdef", http.StatusNotFound, ""},
+		{http.MethodDelete, "/api/records/0123456789abcdef", http.StatusNotFound, ""},
+	} {
+		w := serve(t, h, tc.method, tc.target, nil)
+		if w.Code != tc.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.target, w.Code, tc.status, w.Body)
+		}
+		if allow := w.Header().Get("Allow"); allow != tc.allow {
+			t.Errorf("%s %s: Allow %q, want %q", tc.method, tc.target, allow, tc.allow)
+		}
+	}
+
+	if w := serve(t, h, http.MethodPost, "/api/records", files[:1]); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "missing .dat file") {
+		t.Errorf("upload without .dat file: status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(t, h, http.MethodDelete, record, nil); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d, want 204: %s", w.Code, w.Body)
+	}
+	if w := serve(t, h, http.MethodGet, record, nil); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status %d, want 404", w.Code)
+	}
+}
+
+func TestStoreAdd(t *testing.T) {
+	// In memory, records beyond max are refused
+	memory := newRecordStore(nil, 1)
+	rec, files := testRecord(t, "first", "North")
+	stored, created, err := memory.add(rec, files)
+	if err != nil || !created || stored.ID == "" || stored.Name != "first" {
+		t.Fatalf("add = %+v, %v, %v", stored, created, err)
+	}
+	if got, err := memory.get(stored.ID); err != nil || got != stored {
+		t.Errorf("get(%q) = %v, %v", stored.ID, got, err)
+	}
+	rec, files = testRecord(t, "second", "South")
+	if _, _, err := memory.add(rec, files); err == nil {
+		t.Error("record beyond the memory limit accepted")
+	}
+
+	// With a library, records dropped from memory are read again
+	store, cleanup := testStore(t, 1)
+	defer cleanup()
+	rec, files = testRecord(t, "first", "North")
+	first, created, err := store.add(rec, files)
+	if err != nil || !created {
+		t.Fatalf("add = %v, %v", created, err)
+	}
+	rec, files = testRecord(t, "second", "South")
+	if _, created, err := store.add(rec, files); err != nil || !created {
+		t.Fatalf("add = %v, %v", created, err)
+	}
+	if store.cached(first.ID) != nil {
+		t.Error("least recently used record kept beyond max")
+	}
+	rec, files = testRecord(t, "first", "North")
+	again, created, err := store.add(rec, files)
+	if err != nil || created || again.ID != first.ID {
+		t.Errorf("add of the same files = %v, %v, want %q not created", again, created, first.ID)
+	}
+	if len(again.changed) != 1 || again.GetStationName() != "North" {
+		t.Errorf("record read from the library: changed %v, station %q", again.changed, again.GetStationName())
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"math"
+)
+
+// Downsampling methods of the API
+const (
+	methodMinMax = "minmax"
+	methodLTTB   = "lttb"
+)
+
+// bucket - Samples drawn in the same pixel column, from start to end excluded
+type bucket struct {
+	start, end int
+}
+
+// Splits times, sorted, into the pixel columns of a plot width pixels wide
+func timeBuckets(times []float64, width int) []bucket {
+	if len(times) == 0 || width <= 0 {
+		return nil
+	}
+	from, to := times[0], times[len(times)-1]
+	column := func(t float64) int {
+		if to == from {
+			return 0
+		}
+		c := int((t - from) / (to - from) * float64(width))
+		if c >= width {
+			c = width - 1
+		}
+		return c
+	}
+	var buckets []bucket
+	start := 0
+	for i := 1; i <= len(times); i++ {
+		if i < len(times) && column(times[i]) == column(times[start]) {
+			continue
+		}
+		buckets = append(buckets, bucket{start, i})
+		start = i
+	}
+	return buckets
+}
+
+// Returns the times of a min-max reduction: the first sample of buckets holding one,
+// else the first and the last sample of the bucket
+func minMaxTimes(times []float64, buckets []bucket) []float64 {
+	result := make([]float64, 0, 2*len(buckets))
+	for _, b := range buckets {
+		result = append(result, times[b.start])
+		if b.end-b.start > 1 {
+			result = append(result, times[b.end-1])
+		}
+	}
+	return result
+}
+
+// Returns the positions of the lowest and highest value of the bucket in the order they occur,
+// -1 when every value is missing
+func extremes(b bucket, less func(i, j int) bool, missing func(i int) bool) (int, int) {
+	low, high := -1, -1
+	for i := b.start; i < b.end; i++ {
+		if missing(i) {
+			continue
+		}
+		if low < 0 || less(i, low) {
+			low = i
+		}
+		if high < 0 || less(high, i) {
+			high = i
+		}
+	}
+	if high < low {
+		return high, low
+	}
+	return low, high
+}
+
+// Returns the values of a min-max reduction, following minMaxTimes: the lowest and highest
+// value of each bucket in the order they occur, so that peaks are kept
+func minMaxValues(values []float64, buckets []bucket) []float64 {
+	less := func(i, j int) bool { return values[i] < values[j] }
+	missing := func(i int) bool { return math.IsNaN(values[i]) || math.IsInf(values[i], 0) }
+	result := make([]float64, 0, 2*len(buckets))
+	for _, b := range buckets {
+		if b.end-b.start == 1 {
+			result = append(result, values[b.start])
+			continue
+		}
+		first, second := extremes(b, less, missing)
+		if first < 0 {
+			result = append(result, math.NaN(), math.NaN())
+			continue
+		}
+		result = append(result, values[first], values[second])
+	}
+	return result
+}
+
+// Returns the states of a min-max reduction, following minMaxTimes: pulses shorter than
+// a pixel are kept
+func minMaxStates(states []uint8, buckets []bucket) []uint8 {
+	less := func(i, j int) bool { return states[i] < states[j] }
+	missing := func(i int) bool { return false }
+	result := make([]uint8, 0, 2*len(buckets))
+	for _, b := range buckets {
+		if b.end-b.start == 1 {
+			result = append(result, states[b.start])
+			continue
+		}
+		first, second := extremes(b, less, missing)
+		result = append(result, states[first], states[second])
+	}
+	return result
+}
+
+// Returns threshold points of times and values picked by the Largest Triangle Three Buckets
+// algorithm, missing values being skipped
+func lttb(times, values []float64, threshold int) ([]float64, []float64) {
+	var xs, ys []float64
+	for i, v := range values {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			xs, ys = append(xs, times[i]), append(ys, v)
+		}
+	}
+	if threshold >= len(xs) || threshold < 3 {
+		return xs, ys
+	}
+
+	outX, outY := make([]float64, 0, threshold), make([]float64, 0, threshold)
+	outX, outY = append(outX, xs[0]), append(outY, ys[0])
+	// Points between the first and the last are split into threshold-2 buckets
+	size := float64(len(xs)-2) / float64(threshold-2)
+	a := 0
+	for i := 0; i < threshold-2; i++ {
+		start, end := int(float64(i)*size)+1, int(float64(i+1)*size)+1
+
+		// Average of the next bucket, the last point for the last bucket
+		nextStart, nextEnd := end, int(float64(i+2)*size)+1
+		if nextEnd > len(xs) {
+			nextEnd = len(xs)
+		}
+		var avgX, avgY float64
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += xs[j]
+			avgY += ys[j]
+		}
+		if n := nextEnd - nextStart; n > 0 {
+			avgX, avgY = avgX/float64(n), avgY/float64(n)
+		} else {
+			avgX, avgY = xs[len(xs)-1], ys[len(ys)-1]
+		}
+
+		// Point of the bucket making the largest triangle with the previous point and the average
+		picked, largest := start, -1.0
+		for j := start; j < end; j++ {
+			area := math.Abs((xs[a]-avgX)*(ys[j]-ys[a]) - (xs[a]-xs[j])*(avgY-ys[a]))
+			if area > largest {
+				picked, largest = j, area
+			}
+		}
+		outX, outY = append(outX, xs[picked]), append(outY, ys[picked])
+		a = picked
+	}
+	return append(outX, xs[len(xs)-1]), append(outY, ys[len(ys)-1])
+}
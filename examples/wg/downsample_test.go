@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Reports whether a and b hold the same values, NaN equal to NaN
+func sameFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTimeBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		times []float64
+		width int
+		want  []bucket
+	}{
+		{nil, 10, nil},
+		{[]float64{0, 1}, 0, nil},
+		{[]float64{5}, 10, []bucket{{0, 1}}},
+		{[]float64{1, 1, 1}, 3, []bucket{{0, 3}}},
+		// The last sample falls in the last column
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 5, []bucket{{0, 2}, {2, 4}, {4, 6}, {6, 8}, {8, 11}}},
+		// Columns without samples are skipped
+		{[]float64{0, 1, 2}, 100, []bucket{{0, 1}, {1, 2}, {2, 3}}},
+		{[]float64{0, 0.1, 0.2, 10}, 4, []bucket{{0, 3}, {3, 4}}},
+	} {
+		if got := timeBuckets(tc.times, tc.width); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("timeBuckets(%v, %d) = %v, want %v", tc.times, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestMinMaxValues(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, tc := range []struct {
+		values  []float64
+		buckets []bucket
+		want    []float64
+	}{
+		{nil, nil, []float64{}},
+		// Extremes in the order they occur, single samples kept as they are
+		{[]float64{1, 5, -2, 3, nan, nan, 7}, []bucket{{0, 3}, {3, 4}, {4, 6}, {6, 7}}, []float64{5, -2, 3, nan, nan, 7}},
+		{[]float64{-2, 1, 5}, []bucket{{0, 3}}, []float64{-2, 5}},
+		{[]float64{1, 1, 1}, []bucket{{0, 3}}, []float64{1, 1}},
+		// Missing values are skipped
+		{[]float64{inf, 2, nan, 4}, []bucket{{0, 4}}, []float64{2, 4}},
+		{[]float64{nan}, []bucket{{0, 1}}, []float64{nan}},
+	} {
+		if got := minMaxValues(tc.values, tc.buckets); !sameFloats(got, tc.want) {
+			t.Errorf("minMaxValues(%v, %v) = %v, want %v", tc.values, tc.buckets, got, tc.want)
+		}
+	}
+}
+
+func TestLTTB(t *testing.T) {
+	nan := math.NaN()
+	for _, tc := range []struct {
+		times, values []float64
+		threshold     int
+		wantX, wantY  []float64
+	}{
+		{nil, nil, 10, nil, nil},
+		// Missing values are skipped, every point kept under the threshold
+		{[]float64{0, 1, 2}, []float64{1, nan, 3}, 10, []float64{0, 2}, []float64{1, 3}},
+		{[]float64{0, 1, 2, 3}, []float64{1, 2, 3, 4}, 2, []float64{0, 1, 2, 3}, []float64{1, 2, 3, 4}},
+		// The first and last points and the peaks of each bucket are kept
+		{[]float64{0, 1, 2, 3, 4, 5, 6}, []float64{0, 0, 10, 0, 0, -8, 0}, 4, []float64{0, 2, 5, 6}, []float64{0, 10, -8, 0}},
+	} {
+		gotX, gotY := lttb(tc.times, tc.values, tc.threshold)
+		if !sameFloats(gotX, tc.wantX) || !sameFloats(gotY, tc.wantY) {
+			t.Errorf("lttb(%v, %v, %d) = %v, %v, want %v, %v", tc.times, tc.values, tc.threshold, gotX, gotY, tc.wantX, tc.wantY)
+		}
+	}
+}
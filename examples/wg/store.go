@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+	"github.com/ValleyZw/comgo/library"
+	"github.com/ValleyZw/comgo/plot"
+)
+
+/*
+ * storedRecord - A record uploaded to the server, unchanged once stored
+ * @ID: Identifier of the record in the API
+ * @Uploaded: Time of the upload
+ * @Record: The record
+ * @entry: Index entry of the record, matched by searches
+ * @times: Time of every sample in seconds from the trigger
+ * @states: States of every digital channel in .cfg order
+ * @changed: Digital channels changing state during the record
+ * @mu: Guards values
+ * @values: Values of every analog channel in .cfg order by scaling, decoded on first use
+ */
+type storedRecord struct {
+	ID       string
+	Uploaded time.Time
+	*comgo.Record
+	entry   *library.Entry
+	times   []float64
+	states  [][]uint8
+	changed []uint16
+	mu      sync.RWMutex
+	values  map[comgo.Scaling][][]float64
+}
+
+// Returns the values of every analog channel in .cfg order, the data file being decoded once per scaling
+func (rec *storedRecord) analog(scaling comgo.Scaling) ([][]float64, error) {
+	rec.mu.RLock()
+	values, ok := rec.values[scaling]
+	rec.mu.RUnlock()
+	if ok {
+		return values, nil
+	}
+	_, values, _, err := rec.GetSamples(scaling)
+	if err != nil {
+		return nil, err
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.values[scaling] = values
+	return values, nil
+}
+
+// Returns the time of the trigger in milliseconds since the Unix epoch on the time axis shared
+// by the records: the trigger time shifted to UTC by the time code, plus offset in seconds
+func (rec *storedRecord) origin(offset float64) float64 {
+	return float64(rec.GetTriggerTimeUTC().UnixNano())/1e6 + offset*1e3
+}
+
+/*
+ * recordStore - Records uploaded to the server, safe for concurrent use.
+ * With a library, at most max records are kept decoded, the least recently used being read
+ * again from the library when requested. In memory only, uploads beyond max are refused
+ * @lib: Library keeping the records on disk, nil to keep them in memory only
+ * @max: Number of records kept in memory
+ * @mu: Guards records and recent
+ * @records: Elements of recent by record ID
+ * @recent: Records read, the most recently used first
+ */
+type recordStore struct {
+	lib     *library.Library
+	max     int
+	mu      sync.Mutex
+	records map[string]*list.Element
+	recent  *list.List
+}
+
+func newRecordStore(lib *library.Library, max int) *recordStore {
+	return &recordStore{lib: lib, max: max, records: make(map[string]*list.Element), recent: list.New()}
+}
+
+// Returns the record id when it is in memory, marking it as the most recently used
+func (s *recordStore) cached(id string) *storedRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.records[id]
+	if !ok {
+		return nil
+	}
+	s.recent.MoveToFront(e)
+	return e.Value.(*storedRecord)
+}
+
+// Keeps stored in memory, dropping the least recently used records read from the library beyond max.
+// A record of the same ID already kept is returned instead
+func (s *recordStore) keep(stored *storedRecord) (*storedRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.records[stored.ID]; ok {
+		s.recent.MoveToFront(e)
+		return e.Value.(*storedRecord), nil
+	}
+	if s.lib == nil && s.recent.Len() >= s.max {
+		return nil, fmt.Errorf("%d records kept in memory already, delete records first", s.max)
+	}
+	s.records[stored.ID] = s.recent.PushFront(stored)
+	for s.recent.Len() > s.max {
+		last := s.recent.Back()
+		delete(s.records, last.Value.(*storedRecord).ID)
+		s.recent.Remove(last)
+	}
+	return stored, nil
+}
+
+// Returns rec stored under the ID of its entry, its samples decoded
+func newStoredRecord(rec *comgo.Record, entry *library.Entry) (*storedRecord, error) {
+	times, values, states, err := rec.GetSamples(comgo.ScaleRecorded)
+	if err != nil {
+		return nil, err
+	}
+	trigger := rec.GetTriggerTime().Sub(rec.GetStartTime()).Seconds()
+	for i := range times {
+		times[i] -= trigger
+	}
+	changed := []uint16{}
+	for i, ch := range rec.GetDigitalChannels() {
+		if plot.Changes(states[i]) {
+			changed = append(changed, ch.GetIndex())
+		}
+	}
+	rec.Name = entry.Name
+	return &storedRecord{
+		ID:       entry.ID,
+		Uploaded: entry.Added,
+		Record:   rec,
+		entry:    entry,
+		times:    times,
+		states:   states,
+		changed:  changed,
+		values:   map[comgo.Scaling][][]float64{comgo.ScaleRecorded: values},
+	}, nil
+}
+
+// Stores rec read from files, returns whether it is new: a record already in the library
+// is returned as stored
+func (s *recordStore) add(rec *comgo.Record, files []library.File) (*storedRecord, bool, error) {
+	var entry *library.Entry
+	var err error
+	if s.lib != nil {
+		entry, err = s.lib.Add(files)
+		if err == library.ErrExists {
+			stored, err := s.get(entry.ID)
+			return stored, false, err
+		}
+	} else if entry, err = library.NewEntry(rec); err == nil {
+		entry.Name = rec.Name
+		entry.ID, err = library.NewID()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	stored, err := newStoredRecord(rec, entry)
+	if err != nil {
+		return nil, false, err
+	}
+	stored, err = s.keep(stored)
+	return stored, err == nil, err
+}
+
+// Returns the record id, read from the library when not in memory, library.ErrNotFound if there is none
+func (s *recordStore) get(id string) (*storedRecord, error) {
+	stored := s.cached(id)
+	switch {
+	case stored != nil:
+		return stored, nil
+	case s.lib == nil:
+		return nil, library.ErrNotFound
+	}
+
+	entry, err := s.lib.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := s.lib.Record(id)
+	if err != nil {
+		return nil, err
+	}
+	stored, err = newStoredRecord(rec, entry)
+	if err != nil {
+		return nil, err
+	}
+	// Another request may have read the record meanwhile
+	return s.keep(stored)
+}
+
+// Returns the entries of the records matching q in upload order
+func (s *recordStore) search(q library.Query) ([]*library.Entry, error) {
+	if s.lib != nil {
+		return s.lib.Search(q)
+	}
+	s.mu.Lock()
+	entries := []*library.Entry{}
+	for _, e := range s.records {
+		if rec := e.Value.(*storedRecord); q.Match(rec.entry) {
+			entries = append(entries, rec.entry)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Added.Before(entries[j].Added)
+	})
+	return entries, nil
+}
+
+// Removes the record id, returns whether it was stored
+func (s *recordStore) remove(id string) (bool, error) {
+	s.mu.Lock()
+	e, ok := s.records[id]
+	if ok {
+		delete(s.records, id)
+		s.recent.Remove(e)
+	}
+	s.mu.Unlock()
+	if s.lib == nil {
+		return ok, nil
+	}
+	err := s.lib.Remove(id)
+	if err == library.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Reads the files of an upload
+func readPart(fh *multipart.FileHeader) (library.File, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return library.File{}, err
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return library.File{}, fmt.Errorf("%s: %v", fh.Filename, err)
+	}
+	return library.File{Name: filepath.Base(fh.Filename), Content: content}, nil
+}
+
+// Reads a record from the files of a multipart form: a .cfg and a .dat file with optional
+// .hdr and .inf files, or a single .cff file. The files of the record are returned with it
+func readUpload(form *multipart.Form) (*comgo.Record, []library.File, error) {
+	headers := make(map[string]*multipart.FileHeader)
+	for _, fhs := range form.File {
+		for _, fh := range fhs {
+			headers[strings.ToLower(filepath.Ext(fh.Filename))] = fh
+		}
+	}
+
+	if fh, ok := headers[comgo.ExtCFF]; ok {
+		file, err := readPart(fh)
+		if err != nil {
+			return nil, nil, err
+		}
+		rec, err := comgo.ReadCFF(bytes.NewReader(file.Content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", fh.Filename, err)
+		}
+		rec.Name = strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+		return rec, []library.File{file}, nil
+	}
+
+	if _, ok := headers[comgo.ExtCFG]; !ok {
+		return nil, nil, errors.New("missing .cfg or .cff file")
+	}
+	if _, ok := headers[comgo.ExtDAT]; !ok {
+		return nil, nil, errors.New("missing .dat file")
+	}
+	files := make(map[string]library.File)
+	for _, ext := range []string{comgo.ExtCFG, comgo.ExtDAT, comgo.ExtHDR, comgo.ExtINF} {
+		if fh, ok := headers[ext]; ok {
+			file, err := readPart(fh)
+			if err != nil {
+				return nil, nil, err
+			}
+			files[ext] = file
+		}
+	}
+
+	cfg := comgo.NewCFG()
+	cfgFile, datFile := files[comgo.ExtCFG], files[comgo.ExtDAT]
+	rec := &comgo.Record{CFG: &cfg, Name: strings.TrimSuffix(cfgFile.Name, filepath.Ext(cfgFile.Name))}
+	if err := cfg.ReadCFG(bytes.NewReader(cfgFile.Content)); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", cfgFile.Name, err)
+	}
+	if err := cfg.ReadDAT(bytes.NewReader(datFile.Content)); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", datFile.Name, err)
+	}
+	rec.Header, rec.Info = files[comgo.ExtHDR].Content, files[comgo.ExtINF].Content
+
+	// The files are stored under the name of the .cfg file, as companion files are found by name
+	var stored []library.File
+	for _, ext := range []string{comgo.ExtCFG, comgo.ExtDAT, comgo.ExtHDR, comgo.ExtINF} {
+		if file, ok := files[ext]; ok {
+			file.Name = rec.Name + ext
+			stored = append(stored, file)
+		}
+	}
+	return rec, stored, nil
+}
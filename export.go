@@ -0,0 +1,81 @@
+package comgo
+
+/*
+ * table - Decoded channels of a record, ready to be exported
+ * @times: Time of each sample in seconds from the start time
+ * @analog: Selected analog channels
+ * @values: Values of each selected analog channel, NaN when missing
+ * @digital: Selected digital channels
+ * @states: Status of each selected digital channel
+ */
+type table struct {
+	times   []float64
+	analog  []*AnalogChannel
+	values  [][]float64
+	digital []*DigitalChannel
+	states  [][]uint8
+}
+
+// Returns the selected channels, nil selects every channel of a kind, an empty slice none
+func (cfg *CFG) selectChannels(analog, digital []uint16) ([]*AnalogChannel, []*DigitalChannel, error) {
+	var analogChannels []*AnalogChannel
+	var digitalChannels []*DigitalChannel
+
+	if analog == nil {
+		for _, ch := range cfg.GetAnalogChannels() {
+			analog = append(analog, ch.Index)
+		}
+	}
+	for _, num := range analog {
+		ch, err := cfg.GetAnalogChannel(num)
+		if err != nil {
+			return nil, nil, err
+		}
+		analogChannels = append(analogChannels, ch)
+	}
+
+	if digital == nil {
+		for _, ch := range cfg.GetDigitalChannels() {
+			digital = append(digital, ch.Index)
+		}
+	}
+	for _, num := range digital {
+		ch, err := cfg.GetDigitalChannel(num)
+		if err != nil {
+			return nil, nil, err
+		}
+		digitalChannels = append(digitalChannels, ch)
+	}
+	return analogChannels, digitalChannels, nil
+}
+
+// Decodes the selected channels of the data file, see selectChannels
+func (cfg *CFG) decodeTable(analog, digital []uint16, scaling Scaling) (*table, error) {
+	rd, err := cfg.newDatReader()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &table{}
+	if t.analog, t.digital, err = cfg.selectChannels(analog, digital); err != nil {
+		return nil, err
+	}
+	if t.times, err = cfg.sampleTimes(rd); err != nil {
+		return nil, err
+	}
+	for _, ch := range t.analog {
+		values, err := cfg.analogData(rd, ch.Index, scaling)
+		if err != nil {
+			return nil, err
+		}
+		t.values = append(t.values, values)
+	}
+	for _, ch := range t.digital {
+		states, err := rd.digitalData(ch.Index)
+		if err != nil {
+			return nil, err
+		}
+		t.states = append(t.states, states)
+	}
+	return t, nil
+}
@@ -0,0 +1,110 @@
+package comgo
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+/*
+ * ExtractOptions - Part of a record to extract
+ * @Analog: Analog channel numbers to keep, nil for all
+ * @Digital: Digital channel numbers to keep, nil for all
+ * @From: Start of the time window in seconds from the start time
+ * @To: End of the time window in seconds from the start time, 0 for the end of the record
+ * @FileType: Data file type of the result, the type of the record when empty
+ */
+type ExtractOptions struct {
+	Analog   []uint16
+	Digital  []uint16
+	From     float64
+	To       float64
+	FileType string
+}
+
+// Extract returns a new record holding the selected channels and the samples of the time window,
+// encoded with the requested data file type. Channels are renumbered in order, the start time
+// moves to the first sample kept and the trigger time is unchanged. Values are re-encoded with
+// conversion factors fitting the extracted samples.
+func (cfg *CFG) Extract(opts ExtractOptions) (*CFG, error) {
+	t, err := cfg.decodeTable(opts.Analog, opts.Digital, ScaleRecorded)
+	if err != nil {
+		return nil, err
+	}
+
+	// Half a microsecond absorbs the rounding of time stamps
+	const tolerance = 5e-7
+	first, last := 0, len(t.times)
+	for first < last && t.times[first] < opts.From-tolerance {
+		first++
+	}
+	if opts.To > 0 {
+		for last > first && t.times[last-1] > opts.To+tolerance {
+			last--
+		}
+	}
+	if first == last {
+		return nil, errors.New("no sample in the time window")
+	}
+
+	out := NewCFG()
+	out.StationName, out.RecordDeviceId = cfg.GetStationName(), cfg.GetRecordDeviceId()
+	out.RevisionYear, out.LineFrequency = cfg.GetRevisionYear(), cfg.GetLineFrequency()
+	out.TimeFactor, out.TimeCode, out.LocalCode = cfg.GetTimeFactor(), cfg.GetTimeCode(), cfg.GetLocalCode()
+	out.DataFileType = cfg.GetDataFileType()
+	if opts.FileType != "" {
+		out.DataFileType = opts.FileType
+	}
+	out.StartTime = cfg.GetStartTime().Add(time.Duration(math.Round(t.times[first] * 1e9)))
+	out.TriggerTime = cfg.GetTriggerTime()
+
+	out.AnalogDetail, out.DigitDetail = &ChannelA{}, &ChannelD{}
+	for _, ch := range t.analog {
+		c := *ch
+		c.Number = out.AnalogDetail.ChannelTotal + 1
+		out.AnalogDetail.AddChannel(c)
+	}
+	for _, ch := range t.digital {
+		c := *ch
+		c.Number = out.DigitDetail.ChannelTotal + 1
+		out.DigitDetail.AddChannel(c)
+	}
+
+	// Sampling rate segments keep the samples of the window they hold
+	rates := cfg.GetSampleDetail()
+	if rates[0].GetRate() > 0 {
+		segmentStart := 0
+		for _, rate := range rates {
+			from, to := segmentStart, rate.GetNumber()
+			if from < first {
+				from = first
+			}
+			if to > last {
+				to = last
+			}
+			if to > from {
+				out.SampleDetail = append(out.SampleDetail, SampleRate{Rate: rate.GetRate(), Number: out.getTotalSamples() + to - from})
+			}
+			segmentStart = rate.GetNumber()
+		}
+	} else {
+		out.SampleDetail = []SampleRate{{Rate: 0, Number: last - first}}
+	}
+
+	times := make([]float64, last-first)
+	for i := range times {
+		times[i] = t.times[first+i] - t.times[first]
+	}
+	analog := make([][]float64, len(t.values))
+	for c, values := range t.values {
+		analog[c] = values[first:last]
+	}
+	digital := make([][]uint8, len(t.states))
+	for c, states := range t.states {
+		digital[c] = states[first:last]
+	}
+	if err := out.SetSamples(times, analog, digital); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
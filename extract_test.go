@@ -0,0 +1,93 @@
+package comgo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExtract(t *testing.T) {
+	rec := testRecord(t, FileTypeBinary)
+	out, err := rec.Extract(ExtractOptions{Analog: []uint16{2}, Digital: []uint16{1}, From: 0.001, To: 0.003, FileType: FileTypeASCII})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.GetDataFileType() != FileTypeASCII {
+		t.Errorf("data file type %q, want %q", out.GetDataFileType(), FileTypeASCII)
+	}
+	if want := rec.GetStartTime().Add(time.Millisecond); !out.GetStartTime().Equal(want) {
+		t.Errorf("start time %v, want %v", out.GetStartTime(), want)
+	}
+	if !out.GetTriggerTime().Equal(rec.GetTriggerTime()) {
+		t.Errorf("trigger time %v, want %v", out.GetTriggerTime(), rec.GetTriggerTime())
+	}
+	if out.GetStationName() != "North" || out.GetRecordDeviceId() != "Relay 7" {
+		t.Errorf("station %q, device %q", out.GetStationName(), out.GetRecordDeviceId())
+	}
+	if n := out.getTotalSamples(); n != 3 {
+		t.Errorf("%d samples, want 3", n)
+	}
+
+	analog := out.GetAnalogChannels()
+	if len(analog) != 1 || analog[0].Name != "IA" || analog[0].Number != 1 || analog[0].Index != 1 {
+		t.Fatalf("analog channels %+v, want IA renumbered 1", analog)
+	}
+	digital := out.GetDigitalChannels()
+	if len(digital) != 1 || digital[0].Name != "TRIP" || digital[0].Number != 1 {
+		t.Fatalf("digital channels %+v, want TRIP", digital)
+	}
+	times, err := out.GetSampleTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloats(t, "times", times, []float64{0, 0.001, 0.002}, 1e-9)
+	values, err := out.GetAnalogChannelData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloats(t, "IA", values, testIA[1:4], 1e-3)
+	states, err := out.GetDigitalChannelData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(states, testTRIP[1:4]) {
+		t.Errorf("TRIP = %v, want %v", states, testTRIP[1:4])
+	}
+
+	// The extracted record is written and read back as any other
+	var cfgFile, datFile bytes.Buffer
+	if err := out.WriteCFG(&cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.WriteDAT(&datFile); err != nil {
+		t.Fatal(err)
+	}
+	back := NewCFG()
+	if err := back.ReadCFG(&cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := back.ReadDAT(&datFile); err != nil {
+		t.Fatal(err)
+	}
+	assertSameSamples(t, out, &back, ScaleRecorded)
+}
+
+func TestExtractWhole(t *testing.T) {
+	rec := testRecord(t, FileTypeFloat32)
+	out, err := rec.Extract(ExtractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.GetDataFileType() != FileTypeFloat32 || !out.GetStartTime().Equal(rec.GetStartTime()) {
+		t.Errorf("data file type %q, start time %v", out.GetDataFileType(), out.GetStartTime())
+	}
+	assertSameSamples(t, rec.CFG, out, ScaleRecorded)
+
+	if _, err := rec.Extract(ExtractOptions{From: 0.0025, To: 0.0028}); err == nil {
+		t.Error("Extract of a window without samples succeeded")
+	}
+	if _, err := rec.Extract(ExtractOptions{Analog: []uint16{3}}); err == nil {
+		t.Error("Extract of an unknown channel succeeded")
+	}
+}
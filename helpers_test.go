@@ -0,0 +1,92 @@
+package comgo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Samples of the record built by testRecord: 5 samples at 1 kHz, IA missing at the third one
+var (
+	testTimes = []float64{0, 0.001, 0.002, 0.003, 0.004}
+	testVA    = []float64{0, 81.5, 100, 81.5, -12.25}
+	testIA    = []float64{1.5, -2, math.NaN(), 4, 0}
+	testTRIP  = []uint8{0, 0, 1, 1, 0}
+)
+
+// Returns a record of two analog channels and a digital one with a data file of type fileType
+func testRecord(t *testing.T, fileType string) *Record {
+	t.Helper()
+	cfg := NewCFG()
+	cfg.StationName, cfg.RecordDeviceId = "North", "Relay 7"
+	cfg.LineFrequency = 50
+	cfg.DataFileType = fileType
+	cfg.StartTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.TriggerTime = cfg.StartTime.Add(time.Millisecond)
+	cfg.TimeCode, cfg.LocalCode = "0", "0"
+	cfg.AnalogDetail, cfg.DigitDetail = &ChannelA{}, &ChannelD{}
+	cfg.AnalogDetail.AddChannel(AnalogChannel{Number: 1, Name: "VA", OriginalName: "VA", Phase: "A", Unit: "V", Primary: 1, Secondary: 1, HasRatio: true})
+	cfg.AnalogDetail.AddChannel(AnalogChannel{Number: 2, Name: "IA", OriginalName: "IA", Phase: "A", Unit: "A", Primary: 1, Secondary: 1, HasRatio: true})
+	cfg.DigitDetail.AddChannel(DigitalChannel{Number: 1, Name: "TRIP", OriginalName: "TRIP"})
+	if err := cfg.SetSamples(testTimes, [][]float64{testVA, testIA}, [][]uint8{testTRIP}); err != nil {
+		t.Fatal(err)
+	}
+	return &Record{CFG: &cfg, Name: "test"}
+}
+
+// Checks that got holds the samples of want, analog values within the resolution of the data file
+func assertSameSamples(t *testing.T, want, got *CFG, scaling Scaling) {
+	t.Helper()
+	wantTimes, err := want.GetSampleTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotTimes, err := got.GetSampleTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloats(t, "times", gotTimes, wantTimes, 1e-6)
+
+	if got.GetAnalogDetail().GetChannelTotal() != want.GetAnalogDetail().GetChannelTotal() ||
+		got.GetDigitDetail().GetChannelTotal() != want.GetDigitDetail().GetChannelTotal() {
+		t.Fatalf("got %d analog and %d digital channels, want %d and %d",
+			got.GetAnalogDetail().GetChannelTotal(), got.GetDigitDetail().GetChannelTotal(),
+			want.GetAnalogDetail().GetChannelTotal(), want.GetDigitDetail().GetChannelTotal())
+	}
+	for _, ch := range want.GetAnalogChannels() {
+		wantValues, err := want.GetAnalogChannelDataScaled(ch.Index, scaling)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotValues, err := got.GetAnalogChannelDataScaled(ch.Index, scaling)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFloats(t, ch.Name, gotValues, wantValues, 1e-3)
+	}
+	for _, ch := range want.GetDigitalChannels() {
+		wantStates, err := want.GetDigitalChannelData(ch.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotStates, err := got.GetDigitalChannelData(ch.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(gotStates) != string(wantStates) {
+			t.Errorf("%s: got %v, want %v", ch.Name, gotStates, wantStates)
+		}
+	}
+}
+
+func assertFloats(t *testing.T, name string, got, want []float64, tolerance float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d values, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(got[i]) || math.Abs(got[i]-want[i]) > tolerance {
+			t.Errorf("%s[%d] = %g, want %g", name, i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package comgo
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// JSONFloat is an analog value encoded as a JSON number, or null when missing
+type JSONFloat float64
+
+func (v JSONFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+		return []byte("null"), nil
+	}
+	return strconv.AppendFloat(nil, float64(v), 'g', -1, 64), nil
+}
+
+func (v *JSONFloat) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*v = JSONFloat(math.NaN())
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	*v = JSONFloat(f)
+	return err
+}
+
+// JSONStates are digital channel states encoded as a JSON array of numbers
+// instead of the base64 string encoding/json uses for byte slices
+type JSONStates []uint8
+
+func (v JSONStates) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 2+len(v)*2)
+	b = append(b, '[')
+	for i, state := range v {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendUint(b, uint64(state), 10)
+	}
+	return append(b, ']'), nil
+}
+
+func (v *JSONStates) UnmarshalJSON(b []byte) error {
+	var states []int
+	if err := json.Unmarshal(b, &states); err != nil {
+		return err
+	}
+	*v = make(JSONStates, len(states))
+	for i, state := range states {
+		(*v)[i] = uint8(state)
+	}
+	return nil
+}
+
+/*
+ * JSONRecord - JSON encoding of a record
+ * @Station: Name of the station
+ * @Device: Identification of the recording device
+ * @Revision: COMTRADE standard revision year
+ * @FileType: Data file type
+ * @LineFrequency: Line frequency in Hz
+ * @StartTime: UTC date and time of the first sample
+ * @TriggerTime: UTC date and time of the trigger
+ * @TimeCode: Time code of the record, e.g. "+10h30"
+ * @LocalCode: Local time code of the record
+ * @TimeFactor: Time stamp multiplication factor
+ * @Scaling: Scaling of the analog values
+ * @Rates: Sampling rates and end samples
+ * @Analog: Analog channel definitions
+ * @Digital: Digital channel definitions
+ * @Samples: Sample values, absent in metadata only encodings and in NDJSON
+ */
+type JSONRecord struct {
+	Station       string               `json:"station"`
+	Device        string               `json:"device"`
+	Revision      uint16               `json:"revision"`
+	FileType      string               `json:"file_type"`
+	LineFrequency uint16               `json:"line_frequency"`
+	StartTime     time.Time            `json:"start_time"`
+	TriggerTime   time.Time            `json:"trigger_time"`
+	TimeCode      string               `json:"time_code,omitempty"`
+	LocalCode     string               `json:"local_code,omitempty"`
+	TimeFactor    float64              `json:"time_factor"`
+	Scaling       string               `json:"scaling"`
+	Rates         []JSONRate           `json:"rates"`
+	Analog        []JSONAnalogChannel  `json:"analog"`
+	Digital       []JSONDigitalChannel `json:"digital"`
+	Samples       *JSONSamples         `json:"samples,omitempty"`
+}
+
+/*
+ * JSONRate - JSON encoding of a sampling rate
+ * @Rate: Sampling rate in Hz, 0 when samples are time stamped
+ * @EndSample: Last sample number at this rate
+ */
+type JSONRate struct {
+	Rate      float64 `json:"rate"`
+	EndSample int     `json:"end_sample"`
+}
+
+/*
+ * JSONAnalogChannel - JSON encoding of an analog channel definition
+ * Fields follow AnalogChannel, primary and secondary are omitted when the .cfg has no ratio
+ */
+type JSONAnalogChannel struct {
+	Index        uint16   `json:"index"`
+	Number       uint16   `json:"number"`
+	Name         string   `json:"name"`
+	OriginalName string   `json:"original_name"`
+	Phase        string   `json:"phase"`
+	Component    string   `json:"component"`
+	Unit         string   `json:"unit"`
+	FactorA      float64  `json:"a"`
+	FactorB      float64  `json:"b"`
+	Skew         float64  `json:"skew"`
+	Min          int      `json:"min"`
+	Max          int      `json:"max"`
+	Primary      *float64 `json:"primary,omitempty"`
+	Secondary    *float64 `json:"secondary,omitempty"`
+	PS           string   `json:"ps"`
+}
+
+/*
+ * JSONDigitalChannel - JSON encoding of a digital channel definition
+ * Fields follow DigitalChannel
+ */
+type JSONDigitalChannel struct {
+	Index        uint16 `json:"index"`
+	Number       uint16 `json:"number"`
+	Name         string `json:"name"`
+	OriginalName string `json:"original_name"`
+	Phase        string `json:"phase"`
+	Component    string `json:"component"`
+	InitialState uint8  `json:"initial_state"`
+}
+
+/*
+ * JSONSamples - Column oriented JSON encoding of the samples
+ * @Time: Seconds from the start time of each sample
+ * @Analog: Values of each selected analog channel, in the order of JSONRecord.Analog
+ * @Digital: Status of each selected digital channel, in the order of JSONRecord.Digital
+ */
+type JSONSamples struct {
+	Time    []float64     `json:"time"`
+	Analog  [][]JSONFloat `json:"analog"`
+	Digital []JSONStates  `json:"digital"`
+}
+
+/*
+ * JSONSample - One line of an NDJSON encoding, following the JSONRecord line
+ * @Sample: 1-based sample number
+ * @Time: UTC date and time of the sample
+ * @Offset: Seconds from the start time
+ * @Analog: Values of the selected analog channels
+ * @Digital: Status of the selected digital channels
+ */
+type JSONSample struct {
+	Sample  int         `json:"sample"`
+	Time    time.Time   `json:"time"`
+	Offset  float64     `json:"offset"`
+	Analog  []JSONFloat `json:"analog"`
+	Digital JSONStates  `json:"digital"`
+}
+
+/*
+ * JSONOptions - Content of a JSON export
+ * @Analog: Analog channel numbers to export, nil for all
+ * @Digital: Digital channel numbers to export, nil for all
+ * @Scaling: Scaling of analog values
+ * @MetadataOnly: Leave the samples out
+ */
+type JSONOptions struct {
+	Analog       []uint16
+	Digital      []uint16
+	Scaling      Scaling
+	MetadataOnly bool
+}
+
+// Returns the JSON encoding of the configuration and the given channels
+func (cfg *CFG) jsonMetadata(analog []*AnalogChannel, digital []*DigitalChannel, scaling Scaling) JSONRecord {
+	m := JSONRecord{
+		Station:       cfg.GetStationName(),
+		Device:        cfg.GetRecordDeviceId(),
+		Revision:      cfg.GetRevisionYear(),
+		FileType:      cfg.GetDataFileType(),
+		LineFrequency: cfg.GetLineFrequency(),
+		StartTime:     cfg.GetStartTimeUTC(),
+		TriggerTime:   cfg.GetTriggerTimeUTC(),
+		TimeCode:      cfg.GetTimeCode(),
+		LocalCode:     cfg.GetLocalCode(),
+		TimeFactor:    cfg.GetTimeFactor(),
+		Scaling:       scaling.String(),
+		Rates:         []JSONRate{},
+		Analog:        []JSONAnalogChannel{},
+		Digital:       []JSONDigitalChannel{},
+	}
+	for _, rate := range cfg.GetSampleDetail() {
+		m.Rates = append(m.Rates, JSONRate{rate.Rate, rate.Number})
+	}
+
+	for _, ch := range analog {
+		jch := JSONAnalogChannel{
+			Index:        ch.Index,
+			Number:       ch.Number,
+			Name:         ch.Name,
+			OriginalName: ch.OriginalName,
+			Phase:        ch.Phase,
+			Component:    ch.Element,
+			Unit:         ch.Unit,
+			FactorA:      ch.FactorA,
+			FactorB:      ch.FactorB,
+			Skew:         ch.TimeFactor,
+			Min:          ch.ValueMin,
+			Max:          ch.ValueMax,
+			PS:           ch.GetPS(),
+		}
+		if ch.HasRatio {
+			primary, secondary := ch.Primary, ch.Secondary
+			jch.Primary, jch.Secondary = &primary, &secondary
+		}
+		m.Analog = append(m.Analog, jch)
+	}
+	for _, ch := range digital {
+		m.Digital = append(m.Digital, JSONDigitalChannel{
+			Index:        ch.Index,
+			Number:       ch.Number,
+			Name:         ch.Name,
+			OriginalName: ch.OriginalName,
+			Phase:        ch.Phase,
+			Component:    ch.Element,
+			InitialState: ch.InitialState,
+		})
+	}
+	return m
+}
+
+// Returns the JSON encoding of the record, with samples unless opts.MetadataOnly is set
+func (cfg *CFG) ToJSON(opts JSONOptions) (*JSONRecord, error) {
+	if opts.MetadataOnly {
+		analog, digital, err := cfg.selectChannels(opts.Analog, opts.Digital)
+		if err != nil {
+			return nil, err
+		}
+		m := cfg.jsonMetadata(analog, digital, opts.Scaling)
+		return &m, nil
+	}
+
+	t, err := cfg.decodeTable(opts.Analog, opts.Digital, opts.Scaling)
+	if err != nil {
+		return nil, err
+	}
+	m := cfg.jsonMetadata(t.analog, t.digital, opts.Scaling)
+	m.Samples = &JSONSamples{Time: t.times, Analog: [][]JSONFloat{}, Digital: []JSONStates{}}
+	for _, values := range t.values {
+		column := make([]JSONFloat, len(values))
+		for i, v := range values {
+			column[i] = JSONFloat(v)
+		}
+		m.Samples.Analog = append(m.Samples.Analog, column)
+	}
+	for _, states := range t.states {
+		m.Samples.Digital = append(m.Samples.Digital, states)
+	}
+	return &m, nil
+}
+
+// WriteJSON writes the record as a single JSON document, see JSONRecord
+func (cfg *CFG) WriteJSON(w io.Writer, opts JSONOptions) error {
+	m, err := cfg.ToJSON(opts)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(m)
+}
+
+// WriteNDJSON streams the record as newline delimited JSON:
+// a JSONRecord without samples on the first line, then one JSONSample per line
+func (cfg *CFG) WriteNDJSON(w io.Writer, opts JSONOptions) error {
+	rd, err := cfg.newDatReader()
+	if err != nil {
+		return err
+	}
+	analog, digital, err := cfg.selectChannels(opts.Analog, opts.Digital)
+	if err != nil {
+		return err
+	}
+	scales := make([]func(float64) float64, len(analog))
+	for c, ch := range analog {
+		if scales[c], err = cfg.analogScale(ch.Index, opts.Scaling); err != nil {
+			return err
+		}
+	}
+	times, err := cfg.sampleTimes(rd)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(cfg.jsonMetadata(analog, digital, opts.Scaling)); err != nil {
+		return err
+	}
+
+	// Samples are decoded one at a time, the data file is never held decoded in memory
+	start := cfg.GetStartTimeUTC()
+	sample := JSONSample{
+		Analog:  make([]JSONFloat, len(analog)),
+		Digital: make(JSONStates, len(digital)),
+	}
+	for i, offset := range times {
+		sample.Sample = i + 1
+		sample.Offset = offset
+		sample.Time = start.Add(time.Duration(math.Round(offset * 1e9)))
+		for c, ch := range analog {
+			value, err := rd.getAnalog(i, int(ch.Index)-1)
+			if err != nil {
+				return err
+			}
+			sample.Analog[c] = JSONFloat(scales[c](value))
+		}
+		for c, ch := range digital {
+			if sample.Digital[c], err = rd.getDigital(i, int(ch.Index)-1); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(&sample); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
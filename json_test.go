@@ -0,0 +1,86 @@
+package comgo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// Returns the values of column as floats
+func jsonColumn(column []JSONFloat) []float64 {
+	values := make([]float64, len(column))
+	for i, v := range column {
+		values[i] = float64(v)
+	}
+	return values
+}
+
+func TestWriteJSONRoundTrip(t *testing.T) {
+	rec := testRecord(t, FileTypeFloat32)
+	var buf bytes.Buffer
+	if err := rec.WriteJSON(&buf, JSONOptions{Scaling: ScalePrimary}); err != nil {
+		t.Fatal(err)
+	}
+	var m JSONRecord
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Station != "North" || m.Scaling != "primary" || len(m.Analog) != 2 || len(m.Digital) != 1 || m.Samples == nil {
+		t.Fatalf("got %+v", m)
+	}
+	assertFloats(t, "time", m.Samples.Time, testTimes, 1e-9)
+	assertFloats(t, "VA", jsonColumn(m.Samples.Analog[0]), testVA, 1e-3)
+	assertFloats(t, "IA", jsonColumn(m.Samples.Analog[1]), testIA, 1e-3)
+	if !bytes.Equal(m.Samples.Digital[0], testTRIP) {
+		t.Errorf("got TRIP %v, want %v", m.Samples.Digital[0], testTRIP)
+	}
+}
+
+func TestWriteNDJSONRoundTrip(t *testing.T) {
+	rec := testRecord(t, FileTypeFloat32)
+	var buf bytes.Buffer
+	if err := rec.WriteNDJSON(&buf, JSONOptions{Analog: []uint16{2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	if !scanner.Scan() {
+		t.Fatal("no metadata line")
+	}
+	var m JSONRecord
+	if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Samples != nil || len(m.Analog) != 1 || m.Analog[0].Name != "IA" || len(m.Digital) != 1 {
+		t.Errorf("got metadata %+v", m)
+	}
+
+	var times, values []float64
+	var states []uint8
+	for scanner.Scan() {
+		var s JSONSample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Sample != len(times)+1 || len(s.Analog) != 1 || len(s.Digital) != 1 {
+			t.Fatalf("got sample %+v", s)
+		}
+		if want := rec.GetStartTimeUTC().Add(time.Duration(math.Round(s.Offset * 1e9))); !s.Time.Equal(want) {
+			t.Errorf("sample %d: got time %v, want %v", s.Sample, s.Time, want)
+		}
+		times = append(times, s.Offset)
+		values = append(values, float64(s.Analog[0]))
+		states = append(states, s.Digital[0])
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	assertFloats(t, "time", times, testTimes, 1e-9)
+	assertFloats(t, "IA", values, testIA, 1e-3)
+	if !bytes.Equal(states, testTRIP) {
+		t.Errorf("got TRIP %v, want %v", states, testTRIP)
+	}
+}
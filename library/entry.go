@@ -0,0 +1,170 @@
+package library
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+)
+
+/*
+ * Entry - Index entry of a record in the library
+ * @ID: Identifier of the record in the library
+ * @Name: Name of the record, the file name without extension
+ * @Station: Station name
+ * @Device: Recording device identification
+ * @StartTime: Time of the first sample as recorded
+ * @TriggerTime: Time of the trigger as recorded
+ * @TriggerTimeUTC: Time of the trigger shifted to UTC by the time code, used by queries
+ * @Duration: Seconds from the first to the last sample
+ * @Samples: Number of samples
+ * @Analog: Names of the analog channels
+ * @Digital: Names of the digital channels
+ * @Changed: Names of the digital channels changing state during the record
+ * @Files: Names of the original files kept in the record directory
+ * @Checksum: SHA-256 of the original files, identifying records added twice
+ * @Added: Time the record was added to the library
+ */
+type Entry struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Station        string    `json:"station"`
+	Device         string    `json:"device"`
+	StartTime      time.Time `json:"start_time"`
+	TriggerTime    time.Time `json:"trigger_time"`
+	TriggerTimeUTC time.Time `json:"trigger_time_utc"`
+	Duration       float64   `json:"duration"`
+	Samples        int       `json:"samples"`
+	Analog         []string  `json:"analog"`
+	Digital        []string  `json:"digital"`
+	Changed        []string  `json:"changed"`
+	Files          []string  `json:"files,omitempty"`
+	Checksum       string    `json:"checksum,omitempty"`
+	Added          time.Time `json:"added"`
+}
+
+// NewEntry indexes rec, the ID, files and checksum are left to the caller
+func NewEntry(rec *comgo.Record) (*Entry, error) {
+	times, err := rec.GetSampleTimes()
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{
+		Name:           rec.GetName(),
+		Station:        rec.GetStationName(),
+		Device:         rec.GetRecordDeviceId(),
+		StartTime:      rec.GetStartTime(),
+		TriggerTime:    rec.GetTriggerTime(),
+		TriggerTimeUTC: rec.GetTriggerTimeUTC(),
+		Samples:        len(times),
+		Analog:         []string{},
+		Digital:        []string{},
+		Changed:        []string{},
+		Added:          time.Now().UTC(),
+	}
+	if len(times) > 0 {
+		e.Duration = times[len(times)-1] - times[0]
+	}
+	for _, ch := range rec.GetAnalogChannels() {
+		e.Analog = append(e.Analog, ch.GetName())
+	}
+	for _, ch := range rec.GetDigitalChannels() {
+		e.Digital = append(e.Digital, ch.GetName())
+		states, err := rec.GetDigitalChannelData(ch.GetIndex())
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(states); i++ {
+			if states[i] != states[0] {
+				e.Changed = append(e.Changed, ch.GetName())
+				break
+			}
+		}
+	}
+	return e, nil
+}
+
+/*
+ * Query - Criteria of a search, every criterion given must match
+ * @Station: Station name, case-insensitive
+ * @Device: Recording device identification, case-insensitive
+ * @From: Earliest trigger time, unbounded when zero
+ * @To: Latest trigger time, unbounded when zero
+ * @Channels: Analog or digital channels the record must have
+ * @Operated: Digital channels that must change state during the record
+ */
+type Query struct {
+	Station  string
+	Device   string
+	From     time.Time
+	To       time.Time
+	Channels []string
+	Operated []string
+}
+
+// Whether name is one of names, case-insensitive with spaces matching underscores
+// as in channel names
+func hasName(names []string, name string) bool {
+	name = strings.Replace(strings.TrimSpace(name), " ", "_", -1)
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns whether e meets the criteria of q
+func (q Query) Match(e *Entry) bool {
+	if q.Station != "" && !strings.EqualFold(strings.TrimSpace(e.Station), strings.TrimSpace(q.Station)) {
+		return false
+	}
+	if q.Device != "" && !strings.EqualFold(strings.TrimSpace(e.Device), strings.TrimSpace(q.Device)) {
+		return false
+	}
+	if !q.From.IsZero() && e.TriggerTimeUTC.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && e.TriggerTimeUTC.After(q.To) {
+		return false
+	}
+	for _, name := range q.Channels {
+		if !hasName(e.Analog, name) && !hasName(e.Digital, name) {
+			return false
+		}
+	}
+	for _, name := range q.Operated {
+		if !hasName(e.Changed, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Layouts accepted by ParseTime
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses a query time, RFC 3339 or a date with an optional time of day taken as UTC.
+// A date alone stands for the whole day when end is set, the end of the day being returned
+func ParseTime(value string, end bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if end && layout == "2006-01-02" {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a date such as 2007-01-01 or an RFC 3339 time", value)
+}
@@ -0,0 +1,82 @@
+package library
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value string
+		end   bool
+		want  time.Time
+	}{
+		{"2007-01-31", false, time.Date(2007, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"2007-01-31", true, time.Date(2007, 1, 31, 23, 59, 59, 999999999, time.UTC)},
+		{" 2007-01-31 10:22 ", true, time.Date(2007, 1, 31, 10, 22, 0, 0, time.UTC)},
+		{"2007-01-31T10:22:33", true, time.Date(2007, 1, 31, 10, 22, 33, 0, time.UTC)},
+		{"2007-01-31T10:22:33.5+02:00", false, time.Date(2007, 1, 31, 8, 22, 33, 5e8, time.UTC)},
+	}
+	for _, tc := range tests {
+		got, err := ParseTime(tc.value, tc.end)
+		if err != nil {
+			t.Errorf("ParseTime(%q, %v): %v", tc.value, tc.end, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("ParseTime(%q, %v) = %v, want %v", tc.value, tc.end, got, tc.want)
+		}
+	}
+	if _, err := ParseTime("31/01/2007", false); err == nil {
+		t.Error("ParseTime(31/01/2007) succeeded")
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	trigger := time.Date(2007, 1, 31, 23, 30, 0, 0, time.UTC)
+	e := &Entry{
+		Station:        "North Sub",
+		Device:         "Relay 7",
+		TriggerTimeUTC: trigger,
+		Analog:         []string{"VA", "IA"},
+		Digital:        []string{"86_GC1", "TRIP"},
+		Changed:        []string{"TRIP"},
+	}
+	day := func(value string, end bool) time.Time {
+		tm, err := ParseTime(value, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		name  string
+		query Query
+		want  bool
+	}{
+		{"empty", Query{}, true},
+		{"station folded", Query{Station: " north SUB "}, true},
+		{"other station", Query{Station: "North"}, false},
+		{"device folded", Query{Device: "RELAY 7"}, true},
+		{"other device", Query{Device: "Relay 8"}, false},
+		{"from equal", Query{From: trigger}, true},
+		{"from after", Query{From: trigger.Add(time.Nanosecond)}, false},
+		{"to equal", Query{To: trigger}, true},
+		{"to before", Query{To: trigger.Add(-time.Nanosecond)}, false},
+		{"to end of day", Query{From: day("2007-01-31", false), To: day("2007-01-31", true)}, true},
+		{"to start of day", Query{To: day("2007-01-31", false)}, false},
+		{"from next day", Query{From: day("2007-02-01", false)}, false},
+		{"channels", Query{Channels: []string{"va", "86_gc1"}}, true},
+		{"channel with space", Query{Channels: []string{"86 GC1"}}, true},
+		{"missing channel", Query{Channels: []string{"VA", "IB"}}, false},
+		{"operated", Query{Operated: []string{"trip"}}, true},
+		{"not operated", Query{Operated: []string{"86_GC1"}}, false},
+		{"analog not operated", Query{Operated: []string{"VA"}}, false},
+		{"every criterion", Query{Station: "NORTH SUB", Device: "relay 7", From: day("2007-01-01", false), To: day("2007-01-31", true), Channels: []string{"IA"}, Operated: []string{"TRIP"}}, true},
+	}
+	for _, tc := range tests {
+		if got := tc.query.Match(e); got != tc.want {
+			t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
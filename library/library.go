@@ -0,0 +1,483 @@
+// Package library keeps COMTRADE records in a directory with an index of their metadata,
+// so that records can be searched by station, device, trigger time and channels.
+//
+// A library directory holds the index file, index.json, and a directory per record under records/
+// keeping the original files as they were added. Processes sharing a library, e.g. cg and wg,
+// change the index in turn holding the lock file index.lock.
+package library
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+)
+
+// Layout of a library directory
+const (
+	indexName  = "index.json"
+	lockName   = "index.lock"
+	recordsDir = "records"
+)
+
+// Waiting for the lock file: the delay between attempts, how long to wait, and the age
+// of a lock file left by a process that died, taken over
+const (
+	lockRetry   = 10 * time.Millisecond
+	lockTimeout = 10 * time.Second
+	lockStale   = time.Minute
+)
+
+var (
+	// ErrExists is returned when the files of a record are already in the library
+	ErrExists = errors.New("record already in the library")
+	// ErrNotFound is returned for an unknown record ID
+	ErrNotFound = errors.New("record not found")
+)
+
+/*
+ * File - An original file of a record
+ * @Name: File name without directory, e.g. fault.cfg
+ * @Content: Content of the file, possibly gzip compressed
+ */
+type File struct {
+	Name    string
+	Content []byte
+}
+
+/*
+ * index - Content of the index file
+ * @Records: Entries in the order records were added
+ */
+type index struct {
+	Records []*Entry `json:"records"`
+}
+
+/*
+ * Library - Records kept in a directory, safe for concurrent use also by several processes.
+ * The index is read again when another process changed it
+ * @dir: Library directory
+ * @mu: Guards the fields below
+ * @entries: Entries in the order records were added
+ * @modTime: Modification time of the index file read
+ * @size: Size of the index file read
+ */
+type Library struct {
+	dir     string
+	mu      sync.Mutex
+	entries []*Entry
+	modTime time.Time
+	size    int64
+}
+
+// Open opens the library in dir, creating the directory when it does not exist
+func Open(dir string) (*Library, error) {
+	if err := os.MkdirAll(filepath.Join(dir, recordsDir), 0755); err != nil {
+		return nil, err
+	}
+	l := &Library{dir: dir}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Dir returns the library directory
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// Reads the index file when it changed since it was last read
+func (l *Library) load() error {
+	name := filepath.Join(l.dir, indexName)
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		l.entries, l.modTime, l.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(l.modTime) && info.Size() == l.size {
+		return nil
+	}
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var idx index
+	if err := json.Unmarshal(content, &idx); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	l.entries, l.modTime, l.size = idx.Records, info.ModTime(), info.Size()
+	return nil
+}
+
+// Takes the lock file of the library, held by one process at a time while it changes the index,
+// and returns the function releasing it
+func (l *Library) lock() (func(), error) {
+	name := filepath.Join(l.dir, lockName)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > lockStale {
+			takeStale(name, info)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s: library locked by another process", name)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// Removes the lock file name judged stale from info. The file is moved aside first so that
+// a single process takes it over, and put back when it is not the stale one, another process
+// having taken over and locked the library in the meantime
+func takeStale(name string, info os.FileInfo) {
+	id, err := NewID()
+	if err != nil {
+		return
+	}
+	aside := name + "." + id
+	if err := os.Rename(name, aside); err != nil {
+		return
+	}
+	if moved, err := os.Stat(aside); err == nil && (!os.SameFile(info, moved) || !moved.ModTime().Equal(info.ModTime())) {
+		os.Link(aside, name)
+	}
+	os.Remove(aside)
+}
+
+// Changes the index with fn holding the lock file, the index read again first so that
+// the changes of other processes are kept. The entries are left as fn changed them on errors
+func (l *Library) update(fn func() error) error {
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// Read in full, a change within the resolution of modification times being missed otherwise
+	l.modTime = time.Time{}
+	if err := l.load(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return l.save()
+}
+
+// Writes the index to a temporary file renamed over the index file, so that the index
+// is never left half written
+func (l *Library) save() error {
+	content, err := json.MarshalIndent(index{Records: l.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(l.dir, indexName+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(content, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(l.dir, indexName))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if info, err := os.Stat(filepath.Join(l.dir, indexName)); err == nil {
+		l.modTime, l.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// NewID returns a random record ID
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// FileExt returns the extension of name in lower case, ignoring a .gz suffix
+func FileExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".gz" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(name, filepath.Ext(name))))
+	}
+	return ext
+}
+
+// Stem returns name without its extension and a .gz suffix, whatever their case
+func Stem(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Whether ext is the extension of a record file
+func recordExt(ext string) bool {
+	switch ext {
+	case comgo.ExtCFG, comgo.ExtDAT, comgo.ExtHDR, comgo.ExtINF, comgo.ExtCFF:
+		return true
+	}
+	return false
+}
+
+// Returns the file opening the record: the .cfg file, else the .cff file
+func mainFile(names []string) (string, bool) {
+	var cff string
+	for _, name := range names {
+		switch FileExt(name) {
+		case comgo.ExtCFG:
+			return name, true
+		case comgo.ExtCFF:
+			cff = name
+		}
+	}
+	return cff, cff != ""
+}
+
+// Returns the SHA-256 of files, independent of their names
+func checksum(files []File) string {
+	sorted := append([]File(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return FileExt(sorted[i].Name) < FileExt(sorted[j].Name)
+	})
+	h := sha256.New()
+	for _, f := range sorted {
+		fmt.Fprintf(h, "%s %d\n", FileExt(f.Name), len(f.Content))
+		h.Write(f.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the entry of the record with the checksum sum, nil if there is none
+func (l *Library) findChecksum(sum string) *Entry {
+	for _, e := range l.entries {
+		if e.Checksum == sum {
+			return e
+		}
+	}
+	return nil
+}
+
+// Add stores the files of a record, a .cfg and a .dat file with optional .hdr and .inf files
+// or a .cff file, and indexes it.
+// Files already in the library return the existing entry with ErrExists
+func (l *Library) Add(files []File) (*Entry, error) {
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if f.Name == "" || f.Name != filepath.Base(f.Name) || f.Name == "." || f.Name == ".." {
+			return nil, fmt.Errorf("invalid file name %q", f.Name)
+		}
+		if !recordExt(FileExt(f.Name)) {
+			return nil, fmt.Errorf("%s: not a record file", f.Name)
+		}
+		names = append(names, f.Name)
+	}
+	main, ok := mainFile(names)
+	if !ok {
+		return nil, errors.New("missing .cfg or .cff file")
+	}
+	sum := checksum(files)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if e := l.findChecksum(sum); e != nil {
+		return e, ErrExists
+	}
+
+	// The record is stored and indexed before the lock file is taken, the record directory
+	// being new, and removed when another process added the same files meanwhile
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(l.dir, recordsDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var existing *Entry
+	e, err := func() (*Entry, error) {
+		for _, f := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, f.Name), f.Content, 0644); err != nil {
+				return nil, err
+			}
+		}
+		// Errors name the files relative to the record directory
+		rec, err := comgo.Open(filepath.Join(dir, main))
+		if err != nil {
+			return nil, err
+		}
+		e, err := NewEntry(rec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", main, err)
+		}
+		e.ID, e.Name, e.Files, e.Checksum = id, Stem(main), names, sum
+		err = l.update(func() error {
+			if existing = l.findChecksum(sum); existing != nil {
+				return ErrExists
+			}
+			l.entries = append(l.entries, e)
+			return nil
+		})
+		if err != nil {
+			// The index is read again by the next call
+			l.modTime = time.Time{}
+			return nil, err
+		}
+		return e, nil
+	}()
+	if err != nil {
+		os.RemoveAll(dir)
+		if err == ErrExists {
+			return existing, err
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+// Import adds the record name from the file system with its companion files, name may name
+// the .cfg, .dat or .cff file or the record without extension
+func (l *Library) Import(name string) (*Entry, error) {
+	dir, base := filepath.Dir(name), filepath.Base(name)
+	if recordExt(FileExt(base)) {
+		base = Stem(base)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	var hasCFG bool
+	for _, info := range infos {
+		ext := FileExt(info.Name())
+		if info.IsDir() || !recordExt(ext) || !strings.EqualFold(Stem(info.Name()), base) {
+			continue
+		}
+		hasCFG = hasCFG || ext == comgo.ExtCFG
+		content, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: info.Name(), Content: content})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no record files found", name)
+	}
+
+	// A .cff file next to a .cfg file is kept only when named
+	cff := FileExt(name) == comgo.ExtCFF
+	kept := files[:0]
+	for _, f := range files {
+		ext := FileExt(f.Name)
+		if cff && ext != comgo.ExtCFF || !cff && hasCFG && ext == comgo.ExtCFF {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	e, err := l.Add(kept)
+	if err != nil && err != ErrExists {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return e, err
+}
+
+// Get returns the entry of the record id, ErrNotFound if there is none. Entries must not be modified
+func (l *Library) Get(id string) (*Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	for _, e := range l.entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Search returns the entries matching q in the order records were added
+func (l *Library) Search(q Query) ([]*Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	for _, e := range l.entries {
+		if q.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// Remove removes the record id and its files
+func (l *Library) Remove(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.update(func() error {
+		for i, e := range l.entries {
+			if e.ID == id {
+				l.entries = append(l.entries[:i:i], l.entries[i+1:]...)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		// The index is read again by the next call
+		l.modTime = time.Time{}
+		return err
+	}
+	return os.RemoveAll(filepath.Join(l.dir, recordsDir, id))
+}
+
+// Path returns the path of the file opening the record of e, the .cfg or .cff file
+func (l *Library) Path(e *Entry) string {
+	main, _ := mainFile(e.Files)
+	return filepath.Join(l.dir, recordsDir, e.ID, main)
+}
+
+// Record reads the record id from its original files, named after its path in the library
+func (l *Library) Record(id string) (*comgo.Record, error) {
+	e, err := l.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return comgo.Open(l.Path(e))
+}
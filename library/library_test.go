@@ -0,0 +1,212 @@
+package library
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+)
+
+// Returns the files of a record of station with a single analog channel
+func testFiles(t *testing.T, name, station string) []File {
+	t.Helper()
+	cfg := comgo.NewCFG()
+	cfg.StationName, cfg.RecordDeviceId = station, "Relay 7"
+	cfg.LineFrequency = 50
+	cfg.DataFileType = comgo.FileTypeASCII
+	cfg.StartTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.TriggerTime = cfg.StartTime.Add(time.Millisecond)
+	cfg.AnalogDetail, cfg.DigitDetail = &comgo.ChannelA{}, &comgo.ChannelD{}
+	cfg.AnalogDetail.AddChannel(comgo.AnalogChannel{Number: 1, Name: "VA", OriginalName: "VA", Phase: "A", Unit: "V", Primary: 1, Secondary: 1, HasRatio: true})
+	if err := cfg.SetSamples([]float64{0, 0.001, 0.002}, [][]float64{{0, 1, 2}}, [][]uint8{}); err != nil {
+		t.Fatal(err)
+	}
+	var cfgFile, datFile bytes.Buffer
+	if err := cfg.WriteCFG(&cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.WriteDAT(&datFile); err != nil {
+		t.Fatal(err)
+	}
+	return []File{{Name: name + ".cfg", Content: cfgFile.Bytes()}, {Name: name + ".dat", Content: datFile.Bytes()}}
+}
+
+// Libraries opened on the same directory stand for processes sharing it
+func TestAddConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var libs []*Library
+	for i := 0; i < 4; i++ {
+		lib, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		libs = append(libs, lib)
+	}
+
+	// Every library adds the same record and one of its own
+	same := testFiles(t, "same", "North")
+	var own [][]File
+	for i := range libs {
+		own = append(own, testFiles(t, "own", fmt.Sprint("Station ", i)))
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(libs))
+	for i, lib := range libs {
+		wg.Add(1)
+		go func(i int, lib *Library) {
+			defer wg.Done()
+			if _, err := lib.Add(same); err != nil && err != ErrExists {
+				errs <- err
+			}
+			if _, err := lib.Add(own[i]); err != nil {
+				errs <- err
+			}
+		}(i, lib)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	entries, err := libs[0].Search(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(libs)+1 {
+		t.Errorf("got %d entries, want %d", len(entries), len(libs)+1)
+	}
+	dirs, err := ioutil.ReadDir(filepath.Join(dir, recordsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != len(entries) {
+		t.Errorf("got %d record directories for %d entries", len(dirs), len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(dir, lockName)); !os.IsNotExist(err) {
+		t.Errorf("lock file left: %v", err)
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := lib.Add(testFiles(t, "fault", "North"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := lib.Get(added.ID); err != nil || e.ID != added.ID {
+		t.Errorf("Get(%q) = %v, %v", added.ID, e, err)
+	}
+	if err := lib.Remove(added.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := lib.Get(added.ID); err != ErrNotFound {
+		t.Errorf("Get(%q) after Remove = %v, %v, want ErrNotFound", added.ID, e, err)
+	}
+	if _, err := lib.Record(added.ID); err != ErrNotFound {
+		t.Errorf("Record(%q) after Remove = %v, want ErrNotFound", added.ID, err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, station := range []string{"North", "South", "NORTH"} {
+		if _, err := lib.Add(testFiles(t, "fault", station)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := lib.Search(Query{Station: "north", Channels: []string{"va"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Station != "North" || entries[1].Station != "NORTH" {
+		t.Errorf("got %d entries, want North and NORTH in the order added", len(entries))
+	}
+	if entries, err := lib.Search(Query{Operated: []string{"VA"}}); err != nil || len(entries) != 0 {
+		t.Errorf("Search(Operated VA) = %d entries, %v, want none", len(entries), err)
+	}
+}
+
+func TestLockStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, lockName)
+	old := time.Now().Add(-2 * lockStale)
+	if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Add(testFiles(t, "fault", "North")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("lock file left: %v", err)
+	}
+
+	// A lock taken by another process after the stale one was judged is kept
+	if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name+".new", []byte("fresh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(name+".new", name); err != nil {
+		t.Fatal(err)
+	}
+	takeStale(name, stale)
+	if content, err := ioutil.ReadFile(name); err != nil || string(content) != "fresh" {
+		t.Errorf("fresh lock file = %q, %v", content, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), lockName+".") {
+			t.Errorf("lock file %s left aside", f.Name())
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package comgo
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default number of lines handed to the writer at once
+const DefaultBatchSize = 5000
+
+// Escapers of the InfluxDB line protocol
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+/*
+ * LineProtocolOptions - Content of an InfluxDB line protocol export
+ * @Analog: Analog channel numbers to export, nil for all
+ * @Digital: Digital channel numbers to export, nil for all
+ * @Scaling: Scaling of analog values
+ * @Measurement: Measurement name, "comtrade" when empty
+ * @Tags: Tags added to every point
+ * @BatchSize: Lines per Write call, DefaultBatchSize when 0
+ */
+type LineProtocolOptions struct {
+	Analog      []uint16
+	Digital     []uint16
+	Scaling     Scaling
+	Measurement string
+	Tags        map[string]string
+	BatchSize   int
+}
+
+// Appends the escaped tag set of a point, tags with an empty value are left out
+// as the line protocol does not allow them
+func appendTags(b []byte, tags [][2]string) []byte {
+	for _, tag := range tags {
+		if tag[1] == "" {
+			continue
+		}
+		b = append(b, ',')
+		b = append(b, tagEscaper.Replace(tag[0])...)
+		b = append(b, '=')
+		b = append(b, tagEscaper.Replace(tag[1])...)
+	}
+	return b
+}
+
+// WriteLineProtocol writes one InfluxDB line protocol point per channel and sample, tagged with
+// the station, device and the channel name, phase and unit, with a "value" float field for
+// analog channels and a "state" integer field for digital ones, at the UTC time of the sample
+// in nanoseconds. Missing analog samples are left out. Lines are written in batches of
+// opts.BatchSize, each batch in a single Write call made of complete lines, so that w may
+// post every call to an ingest endpoint.
+func (cfg *CFG) WriteLineProtocol(w io.Writer, opts LineProtocolOptions) error {
+	t, err := cfg.decodeTable(opts.Analog, opts.Digital, opts.Scaling)
+	if err != nil {
+		return err
+	}
+	measurement := opts.Measurement
+	if measurement == "" {
+		measurement = "comtrade"
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	// The series key of each channel does not change between samples,
+	// tags are sorted by key as recommended for ingest performance, opts.Tags take precedence
+	prefix := func(name, phase, unit string) []byte {
+		values := map[string]string{
+			"station": cfg.GetStationName(),
+			"device":  cfg.GetRecordDeviceId(),
+			"channel": name,
+			"phase":   phase,
+			"unit":    unit,
+		}
+		for key, value := range opts.Tags {
+			values[key] = value
+		}
+		var tags [][2]string
+		for key, value := range values {
+			tags = append(tags, [2]string{key, value})
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i][0] < tags[j][0] })
+		return appendTags([]byte(measurementEscaper.Replace(measurement)), tags)
+	}
+	var analogKeys, digitalKeys [][]byte
+	for _, ch := range t.analog {
+		analogKeys = append(analogKeys, append(prefix(ch.Name, ch.Phase, ch.Unit), " value="...))
+	}
+	for _, ch := range t.digital {
+		digitalKeys = append(digitalKeys, append(prefix(ch.Name, ch.Phase, ""), " state="...))
+	}
+
+	var batch []byte
+	lines := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := w.Write(batch)
+		batch, lines = batch[:0], 0
+		return err
+	}
+	// Ends the point being appended to the batch
+	end := func(stamp int64) error {
+		batch = append(batch, ' ')
+		batch = strconv.AppendInt(batch, stamp, 10)
+		batch = append(batch, '\n')
+		if lines++; lines >= batchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	start := cfg.GetStartTimeUTC().UnixNano()
+	for i, offset := range t.times {
+		stamp := start + int64(math.Round(offset*1e9))
+		for c, values := range t.values {
+			if math.IsNaN(values[i]) || math.IsInf(values[i], 0) {
+				continue
+			}
+			batch = append(batch, analogKeys[c]...)
+			batch = strconv.AppendFloat(batch, values[i], 'g', -1, 64)
+			if err := end(stamp); err != nil {
+				return err
+			}
+		}
+		for c, states := range t.states {
+			batch = append(batch, digitalKeys[c]...)
+			batch = append(strconv.AppendUint(batch, uint64(states[i]), 10), 'i')
+			if err := end(stamp); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
@@ -0,0 +1,98 @@
+package comgo
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Keeps the content of every Write call
+type writeRecorder struct {
+	writes []string
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestWriteLineProtocol(t *testing.T) {
+	rec := testRecord(t, FileTypeASCII)
+	rec.StationName, rec.RecordDeviceId = "North, Sub 1", "Relay=7"
+	rec.TimeCode = "+10h30"
+	w := &writeRecorder{}
+	err := rec.WriteLineProtocol(w, LineProtocolOptions{
+		Measurement: "fault records",
+		Tags:        map[string]string{"site": "x=y", "bay": ""},
+		BatchSize:   4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// VA has 5 samples, IA 4 as one is missing, TRIP 5
+	var lines []string
+	for i, write := range w.writes {
+		if !strings.HasSuffix(write, "\n") {
+			t.Errorf("write %d does not end a line: %q", i+1, write)
+		}
+		batch := strings.Split(strings.TrimSuffix(write, "\n"), "\n")
+		if want := 4; i == len(w.writes)-1 {
+			want = 14 - 4*(len(w.writes)-1)
+			if len(batch) != want {
+				t.Errorf("last write holds %d lines, want %d", len(batch), want)
+			}
+		} else if len(batch) != want {
+			t.Errorf("write %d holds %d lines, want %d", i+1, len(batch), want)
+		}
+		lines = append(lines, batch...)
+	}
+	if len(lines) != 14 || len(w.writes) != 4 {
+		t.Fatalf("got %d lines in %d writes, want 14 in 4", len(lines), len(w.writes))
+	}
+
+	// Tags sorted and escaped, empty ones left out, UTC nanoseconds from the time code
+	start := time.Date(2019, 12, 31, 13, 30, 0, 0, time.UTC).UnixNano()
+	if want := fmt.Sprintf(`fault\ records,channel=VA,device=Relay\=7,phase=A,site=x\=y,station=North\,\ Sub\ 1,unit=V value=0 %d`, start); lines[0] != want {
+		t.Errorf("got first line %q, want %q", lines[0], want)
+	}
+	if want := fmt.Sprintf(`fault\ records,channel=TRIP,device=Relay\=7,site=x\=y,station=North\,\ Sub\ 1 state=0i %d`, start); lines[2] != want {
+		t.Errorf("got TRIP line %q, want %q", lines[2], want)
+	}
+
+	values := make(map[string][]float64)
+	for _, line := range lines {
+		fields := strings.Split(line, " ")
+		channel := strings.Split(strings.SplitN(fields[1], "channel=", 2)[1], ",")[0]
+		value := strings.SplitN(fields[len(fields)-2], "=", 2)[1]
+		if channel == "TRIP" {
+			if !strings.HasSuffix(value, "i") {
+				t.Errorf("got state %q without the integer suffix", value)
+			}
+			value = strings.TrimSuffix(value, "i")
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		stamp, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if want := start + int64(len(values[channel]))*int64(time.Millisecond); channel != "IA" && stamp != want {
+			t.Errorf("line %q: got time stamp %d, want %d", line, stamp, want)
+		}
+		values[channel] = append(values[channel], v)
+	}
+	assertFloats(t, "VA", values["VA"], testVA, 1e-3)
+	assertFloats(t, "IA", values["IA"], []float64{testIA[0], testIA[1], testIA[3], testIA[4]}, 1e-3)
+	assertFloats(t, "TRIP", values["TRIP"], []float64{0, 0, 1, 1, 0}, 0)
+
+	var buf bytes.Buffer
+	if err := rec.WriteLineProtocol(&buf, LineProtocolOptions{Analog: []uint16{}, Digital: []uint16{}}); err != nil || buf.Len() != 0 {
+		t.Errorf("got %q, %v without channels", buf.String(), err)
+	}
+}
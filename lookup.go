@@ -0,0 +1,274 @@
+package comgo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MatchField selects the channel attribute a lookup is matched against
+type MatchField uint8
+
+const (
+	// ByName matches the normalized name (spaces replaced by underscores)
+	ByName MatchField = iota
+	// ByOriginalName matches the name as written in the .cfg file
+	ByOriginalName
+	// ByPhase matches the phase identification (A, B, C, N...)
+	ByPhase
+	// ByComponent matches the circuit component being monitored (ccbm)
+	ByComponent
+	// ByUnit matches the channel units, analog channels only
+	ByUnit
+)
+
+func (f MatchField) String() string {
+	switch f {
+	case ByName:
+		return "name"
+	case ByOriginalName:
+		return "original name"
+	case ByPhase:
+		return "phase"
+	case ByComponent:
+		return "component"
+	case ByUnit:
+		return "unit"
+	}
+	return "unknown"
+}
+
+// MatchMode selects how a lookup value is compared with the channel attribute
+type MatchMode uint8
+
+const (
+	// MatchExact compares values as is
+	MatchExact MatchMode = iota
+	// MatchFold compares values ignoring case
+	MatchFold
+	// MatchPattern treats the lookup value as a regular expression
+	MatchPattern
+)
+
+var (
+	// ErrChannelNotFound is returned when no channel matches a lookup
+	ErrChannelNotFound = errors.New("channel not found")
+	// ErrAmbiguousChannel is returned when a lookup expecting one channel matches several
+	ErrAmbiguousChannel = errors.New("ambiguous channel")
+)
+
+// Returns the attribute of every channel selected by field
+func channelValues(field MatchField, names, original, phases, elements, units []string) ([]string, error) {
+	switch field {
+	case ByName:
+		return names, nil
+	case ByOriginalName:
+		return original, nil
+	case ByPhase:
+		return phases, nil
+	case ByComponent:
+		return elements, nil
+	case ByUnit:
+		if units == nil {
+			return nil, errors.New("digital channels have no unit")
+		}
+		return units, nil
+	}
+	return nil, fmt.Errorf("unknown match field %d", field)
+}
+
+// Returns the 1-based position of every channel whose attribute matches value
+func findChannels(values []string, field MatchField, mode MatchMode, value string) ([]uint16, error) {
+	var match func(string) bool
+	switch mode {
+	case MatchExact, MatchFold:
+		value = strings.TrimSpace(value)
+		if field == ByName {
+			value = normalizeChannelName(value)
+		}
+		if mode == MatchExact {
+			match = func(s string) bool { return strings.TrimSpace(s) == value }
+		} else {
+			match = func(s string) bool { return strings.EqualFold(strings.TrimSpace(s), value) }
+		}
+	case MatchPattern:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel pattern %q: %v", value, err)
+		}
+		match = re.MatchString
+	default:
+		return nil, fmt.Errorf("unknown match mode %d", mode)
+	}
+
+	var result []uint16
+	for i, v := range values {
+		if match(v) {
+			result = append(result, uint16(i+1))
+		}
+	}
+	return result, nil
+}
+
+// Returns the only channel in matches, or an error naming the candidates
+func singleChannel(kind string, names []string, matches []uint16, field MatchField, value string) (uint16, error) {
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("%w: no %s channel with %s %q", ErrChannelNotFound, kind, field, value)
+	case 1:
+		return matches[0], nil
+	}
+	candidates := make([]string, len(matches))
+	for i, num := range matches {
+		candidates[i] = fmt.Sprintf("%d:%s", num, names[num-1])
+	}
+	return 0, fmt.Errorf("%w: %s %q matches %s channels %s", ErrAmbiguousChannel, field, value, kind, strings.Join(candidates, ", "))
+}
+
+// Returns the numbers of the analog channels matching value, as accepted by GetAnalogChannelData
+func (cfg *CFG) FindAnalogChannels(field MatchField, mode MatchMode, value string) ([]uint16, error) {
+	m := cfg.GetAnalogDetail()
+	if m == nil {
+		return nil, errors.New("invalid analog channel")
+	}
+	values, err := channelValues(field, m.GetChannelNames(), m.GetOriginalNames(), m.GetChannelPhases(), m.GetChannelElements(), m.GetChannelUnits())
+	if err != nil {
+		return nil, err
+	}
+	return findChannels(values, field, mode, value)
+}
+
+// Returns the number of the only analog channel matching value
+// ErrChannelNotFound or ErrAmbiguousChannel is returned otherwise
+func (cfg *CFG) LookupAnalogChannel(field MatchField, mode MatchMode, value string) (uint16, error) {
+	matches, err := cfg.FindAnalogChannels(field, mode, value)
+	if err != nil {
+		return 0, err
+	}
+	return singleChannel("analog", cfg.GetAnalogChannelNames(), matches, field, value)
+}
+
+// Returns the numbers of the digital channels matching value
+func (cfg *CFG) FindDigitalChannels(field MatchField, mode MatchMode, value string) ([]uint16, error) {
+	m := cfg.GetDigitDetail()
+	if m == nil {
+		return nil, errors.New("invalid digital channel")
+	}
+	values, err := channelValues(field, m.GetChannelNames(), m.GetOriginalNames(), m.GetChannelPhases(), m.GetChannelElements(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return findChannels(values, field, mode, value)
+}
+
+// Returns the number of the only digital channel matching value
+// ErrChannelNotFound or ErrAmbiguousChannel is returned otherwise
+func (cfg *CFG) LookupDigitalChannel(field MatchField, mode MatchMode, value string) (uint16, error) {
+	matches, err := cfg.FindDigitalChannels(field, mode, value)
+	if err != nil {
+		return 0, err
+	}
+	return singleChannel("digital", cfg.GetDigitDetail().GetChannelNames(), matches, field, value)
+}
+
+// Resolves a channel selection, see SelectAnalogChannels, find looking channels up by attribute
+func selectChannelSpec(kind, spec string, total uint16, find func(MatchField, MatchMode, string) ([]uint16, error)) ([]uint16, error) {
+	switch strings.ToLower(strings.TrimSpace(spec)) {
+	case "", "all":
+		return nil, nil
+	case "none":
+		return []uint16{}, nil
+	}
+
+	result := []uint16{}
+	seen := make(map[uint16]bool)
+	add := func(nums ...uint16) {
+		for _, num := range nums {
+			if !seen[num] {
+				seen[num] = true
+				result = append(result, num)
+			}
+		}
+	}
+	number := func(s string) (uint16, bool, error) {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return 0, false, nil
+		}
+		if n < 1 || n > int(total) {
+			return 0, true, fmt.Errorf("no %s channel %d, the record has %d", kind, n, total)
+		}
+		return uint16(n), true, nil
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if num, ok, err := number(item); err != nil {
+			return nil, err
+		} else if ok {
+			add(num)
+			continue
+		}
+		if bounds := strings.SplitN(item, "-", 2); len(bounds) == 2 {
+			from, okFrom, err := number(bounds[0])
+			if err != nil {
+				return nil, err
+			}
+			to, okTo, err := number(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+			if okFrom && okTo {
+				if from > to {
+					return nil, fmt.Errorf("invalid %s channel range %s, %d is after %d", kind, item, from, to)
+				}
+				// An int counter ends the loop when to is the last uint16
+				for num := int(from); num <= int(to); num++ {
+					add(uint16(num))
+				}
+				continue
+			}
+		}
+		if len(item) > 2 && strings.HasPrefix(item, "/") && strings.HasSuffix(item, "/") {
+			nums, err := find(ByName, MatchPattern, item[1:len(item)-1])
+			if err != nil {
+				return nil, err
+			}
+			if len(nums) == 0 {
+				return nil, fmt.Errorf("%w: no %s channel matches %s", ErrChannelNotFound, kind, item)
+			}
+			add(nums...)
+			continue
+		}
+		nums, err := find(ByName, MatchFold, item)
+		if err == nil && len(nums) == 0 {
+			nums, err = find(ByOriginalName, MatchFold, item)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(nums) == 0 {
+			return nil, fmt.Errorf("%w: no %s channel named %q", ErrChannelNotFound, kind, item)
+		}
+		add(nums...)
+	}
+	return result, nil
+}
+
+// SelectAnalogChannels resolves a comma separated list of channel numbers, ranges such as 3-5,
+// names and original names ignoring case, or /patterns/ matched against names, to the numbers
+// of analog channels in the given order without repeats.
+// An empty spec or "all" returns nil, standing for every channel, "none" an empty slice
+func (cfg *CFG) SelectAnalogChannels(spec string) ([]uint16, error) {
+	return selectChannelSpec("analog", spec, cfg.GetAnalogDetail().GetChannelTotal(), cfg.FindAnalogChannels)
+}
+
+// SelectDigitalChannels resolves a selection of digital channels, see SelectAnalogChannels
+func (cfg *CFG) SelectDigitalChannels(spec string) ([]uint16, error) {
+	return selectChannelSpec("digital", spec, cfg.GetDigitDetail().GetChannelTotal(), cfg.FindDigitalChannels)
+}
@@ -0,0 +1,95 @@
+package comgo
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectAnalogChannels(t *testing.T) {
+	cfg := testRecord(t, FileTypeASCII).CFG
+	errAny := errors.New("any error")
+	for _, tc := range []struct {
+		spec string
+		want []uint16
+		err  error
+	}{
+		{"", nil, nil},
+		{"all", nil, nil},
+		{"none", []uint16{}, nil},
+		{"2,1", []uint16{2, 1}, nil},
+		{"1-2", []uint16{1, 2}, nil},
+		{"ia, 1, 2", []uint16{2, 1}, nil},
+		{"/^V/", []uint16{1}, nil},
+		{"VB", nil, ErrChannelNotFound},
+		{"/^X/", nil, ErrChannelNotFound},
+		{"3", nil, errAny},
+		{"2-1", nil, errAny},
+		{"1-3", nil, errAny},
+	} {
+		got, err := cfg.SelectAnalogChannels(tc.spec)
+		if tc.err == errAny && err != nil {
+			continue
+		}
+		if !errors.Is(err, tc.err) || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SelectAnalogChannels(%q) = %v, %v, want %v, %v", tc.spec, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestLookupChannel(t *testing.T) {
+	cfg := testRecord(t, FileTypeASCII).CFG
+	if num, err := cfg.LookupAnalogChannel(ByName, MatchFold, "ia"); err != nil || num != 2 {
+		t.Errorf("LookupAnalogChannel(ia) = %d, %v, want 2", num, err)
+	}
+	if num, err := cfg.LookupDigitalChannel(ByName, MatchExact, "TRIP"); err != nil || num != 1 {
+		t.Errorf("LookupDigitalChannel(TRIP) = %d, %v, want 1", num, err)
+	}
+
+	for _, tc := range []struct {
+		field MatchField
+		mode  MatchMode
+		value string
+		err   error
+	}{
+		{ByPhase, MatchExact, "A", ErrAmbiguousChannel},
+		{ByName, MatchPattern, "A$", ErrAmbiguousChannel},
+		{ByName, MatchExact, "ia", ErrChannelNotFound},
+		{ByUnit, MatchFold, "kV", ErrChannelNotFound},
+	} {
+		if num, err := cfg.LookupAnalogChannel(tc.field, tc.mode, tc.value); !errors.Is(err, tc.err) {
+			t.Errorf("LookupAnalogChannel(%s %q) = %d, %v, want %v", tc.field, tc.value, num, err, tc.err)
+		}
+	}
+	if _, err := cfg.LookupAnalogChannel(ByPhase, MatchExact, "A"); err == nil || !strings.Contains(err.Error(), "1:VA, 2:IA") {
+		t.Errorf("ambiguous lookup error %v does not name the candidates", err)
+	}
+	if num, err := cfg.LookupDigitalChannel(ByName, MatchFold, "CLOSE"); !errors.Is(err, ErrChannelNotFound) {
+		t.Errorf("LookupDigitalChannel(CLOSE) = %d, %v, want ErrChannelNotFound", num, err)
+	}
+
+	if nums, err := cfg.FindAnalogChannels(ByPhase, MatchFold, "a"); err != nil || !reflect.DeepEqual(nums, []uint16{1, 2}) {
+		t.Errorf("FindAnalogChannels(phase a) = %v, %v, want [1 2]", nums, err)
+	}
+	if nums, err := cfg.FindAnalogChannels(ByName, MatchExact, "VB"); err != nil || len(nums) != 0 {
+		t.Errorf("FindAnalogChannels(VB) = %v, %v, want none", nums, err)
+	}
+	if _, err := cfg.FindAnalogChannels(ByName, MatchPattern, "("); err == nil {
+		t.Error("FindAnalogChannels with an invalid pattern succeeded")
+	}
+	if _, err := cfg.FindDigitalChannels(ByUnit, MatchExact, "V"); err == nil {
+		t.Error("FindDigitalChannels by unit succeeded")
+	}
+}
+
+func TestParseScaling(t *testing.T) {
+	for name, want := range map[string]Scaling{"": ScaleRecorded, "Primary": ScalePrimary, "secondary": ScaleSecondary, "RAW": ScaleRaw} {
+		if got, err := ParseScaling(name); err != nil || got != want {
+			t.Errorf("ParseScaling(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseScaling("peak"); err == nil {
+		t.Error("ParseScaling(\"peak\") succeeded")
+	}
+}
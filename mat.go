@@ -0,0 +1,228 @@
+package comgo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf16"
+)
+
+// Level 5 MAT-file data types and array classes used by the writer
+const (
+	miINT8   = 1
+	miUINT8  = 2
+	miUINT16 = 4
+	miINT32  = 5
+	miUINT32 = 6
+	miDOUBLE = 9
+	miMATRIX = 14
+
+	mxSTRUCT = 2
+	mxCHAR   = 4
+	mxDOUBLE = 6
+	mxUINT8  = 9
+
+	mxLogicalFlag = 0x02
+)
+
+// Names of the fields of the channel structs, at most 31 characters each
+var (
+	matRecordFields  = []string{"station", "device", "revision", "file_type", "line_frequency", "start_time", "trigger_time", "trigger", "time_code", "local_code", "rates", "end_samples", "scaling"}
+	matAnalogFields  = []string{"name", "original_name", "phase", "component", "unit", "primary", "secondary", "ps", "data", "time"}
+	matDigitalFields = []string{"name", "original_name", "phase", "component", "initial_state", "data", "time"}
+)
+
+// Largest data size of an element, held in 32 bits by the tag
+var matMaxSize uint64 = math.MaxUint32
+
+/*
+ * MATOptions - Content of a MAT-file export
+ * @Analog: Analog channel numbers to export, nil for all
+ * @Digital: Digital channel numbers to export, nil for all
+ * @Scaling: Scaling of analog values
+ */
+type MATOptions struct {
+	Analog  []uint16
+	Digital []uint16
+	Scaling Scaling
+}
+
+// Encodes a data element: tag, data and padding to 8 bytes
+func matElement(typ uint32, data []byte) []byte {
+	b := make([]byte, 8, 8+len(data)+7)
+	binary.LittleEndian.PutUint32(b, typ)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	b = append(b, data...)
+	for len(b)%8 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// Encodes a miMATRIX element from its array flags, dimensions, name and content elements
+func matMatrix(class, flags uint32, name string, rows, cols int, content ...[]byte) []byte {
+	var b []byte
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header, class|flags<<8)
+	b = append(b, matElement(miUINT32, header)...)
+
+	dims := make([]byte, 8)
+	binary.LittleEndian.PutUint32(dims, uint32(rows))
+	binary.LittleEndian.PutUint32(dims[4:], uint32(cols))
+	b = append(b, matElement(miINT32, dims)...)
+	b = append(b, matElement(miINT8, []byte(name))...)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	return matElement(miMATRIX, b)
+}
+
+// Encodes a column vector of doubles, or a scalar
+func matDouble(name string, values ...float64) []byte {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(v))
+	}
+	return matMatrix(mxDOUBLE, 0, name, len(values), 1, matElement(miDOUBLE, data))
+}
+
+// Encodes a column vector of logical values
+func matLogical(name string, values []uint8) []byte {
+	data := make([]byte, len(values))
+	for i, v := range values {
+		if v != 0 {
+			data[i] = 1
+		}
+	}
+	return matMatrix(mxUINT8, mxLogicalFlag, name, len(values), 1, matElement(miUINT8, data))
+}
+
+// Encodes a character row vector
+func matChar(name, s string) []byte {
+	chars := utf16.Encode([]rune(s))
+	data := make([]byte, 2*len(chars))
+	for i, c := range chars {
+		binary.LittleEndian.PutUint16(data[2*i:], c)
+	}
+	rows := 1
+	if len(chars) == 0 {
+		rows = 0
+	}
+	return matMatrix(mxCHAR, 0, name, rows, len(chars), matElement(miUINT16, data))
+}
+
+// Encodes a 1xN struct array, elements[i] holds the encoded fields of element i
+func matStruct(name string, fields []string, elements [][][]byte) []byte {
+	const fieldLength = 32
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, fieldLength)
+	names := make([]byte, fieldLength*len(fields))
+	for i, field := range fields {
+		copy(names[i*fieldLength:(i+1)*fieldLength-1], field)
+	}
+	content := [][]byte{matElement(miINT32, length), matElement(miINT8, names)}
+	for _, element := range elements {
+		content = append(content, element...)
+	}
+	return matMatrix(mxSTRUCT, 0, name, 1, len(elements), content...)
+}
+
+// Writes the variable v, refused when its data does not fit the size field of its tag.
+// The elements nested in v being smaller, checking v is enough
+func writeMATVariable(w io.Writer, name string, v []byte) error {
+	if uint64(len(v)-8) > matMaxSize {
+		return fmt.Errorf("MAT-file variable %s of %d bytes too large, Level 5 MAT-files hold at most %d bytes per variable, "+
+			"export fewer channels or a shorter window, or use a MAT-file v7.3 (HDF5) writer", name, len(v)-8, matMaxSize)
+	}
+	_, err := w.Write(v)
+	return err
+}
+
+// WriteMAT writes the selected channels as a Level 5 MAT-file readable by MATLAB, Octave
+// and scipy.io.loadmat. It holds three variables: "record", a struct with the .cfg header
+// fields, and "analog" and "digital", struct arrays with one element per channel holding
+// its definition, "data" and "time" in seconds from the start time as column vectors.
+// A variable holds at most 4 GiB, larger exports fail before the variable is written.
+func (cfg *CFG) WriteMAT(w io.Writer, opts MATOptions) error {
+	t, err := cfg.decodeTable(opts.Analog, opts.Digital, opts.Scaling)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 128)
+	text := fmt.Sprintf("MATLAB 5.0 MAT-file, Platform: comgo, Created on: %s", time.Now().Format("Mon Jan _2 15:04:05 2006"))
+	copy(header, text)
+	for i := len(text); i < 116; i++ {
+		header[i] = ' '
+	}
+	binary.LittleEndian.PutUint16(header[124:], 0x0100)
+	copy(header[126:], "IM")
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	var rates, endSamples []float64
+	for _, rate := range cfg.GetSampleDetail() {
+		rates = append(rates, rate.Rate)
+		endSamples = append(endSamples, float64(rate.Number))
+	}
+	record := matStruct("record", matRecordFields, [][][]byte{{
+		matChar("", cfg.GetStationName()),
+		matChar("", cfg.GetRecordDeviceId()),
+		matDouble("", float64(cfg.GetRevisionYear())),
+		matChar("", cfg.GetDataFileType()),
+		matDouble("", float64(cfg.GetLineFrequency())),
+		matChar("", cfg.GetStartTimeUTC().Format(ISOTimeFormat)),
+		matChar("", cfg.GetTriggerTimeUTC().Format(ISOTimeFormat)),
+		matDouble("", cfg.GetTriggerTime().Sub(cfg.GetStartTime()).Seconds()),
+		matChar("", cfg.GetTimeCode()),
+		matChar("", cfg.GetLocalCode()),
+		matDouble("", rates...),
+		matDouble("", endSamples...),
+		matChar("", opts.Scaling.String()),
+	}})
+	if err := writeMATVariable(w, "record", record); err != nil {
+		return err
+	}
+
+	times := matDouble("", t.times...)
+
+	var analog [][][]byte
+	for c, ch := range t.analog {
+		primary, secondary := math.NaN(), math.NaN()
+		if ch.HasRatio {
+			primary, secondary = ch.Primary, ch.Secondary
+		}
+		analog = append(analog, [][]byte{
+			matChar("", ch.Name),
+			matChar("", ch.OriginalName),
+			matChar("", ch.Phase),
+			matChar("", ch.Element),
+			matChar("", ch.Unit),
+			matDouble("", primary),
+			matDouble("", secondary),
+			matChar("", ch.GetPS()),
+			matDouble("", t.values[c]...),
+			times,
+		})
+	}
+	if err := writeMATVariable(w, "analog", matStruct("analog", matAnalogFields, analog)); err != nil {
+		return err
+	}
+
+	var digital [][][]byte
+	for c, ch := range t.digital {
+		digital = append(digital, [][]byte{
+			matChar("", ch.Name),
+			matChar("", ch.OriginalName),
+			matChar("", ch.Phase),
+			matChar("", ch.Element),
+			matDouble("", float64(ch.InitialState)),
+			matLogical("", t.states[c]),
+			times,
+		})
+	}
+	return writeMATVariable(w, "digital", matStruct("digital", matDigitalFields, digital))
+}
@@ -0,0 +1,201 @@
+package comgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+/*
+ * matTestVar - Array read back from a MAT-file
+ * @class: Array class
+ * @flags: Array flags above the class
+ * @dims: Dimensions
+ * @name: Array name
+ * @data: Real part of numeric and character arrays
+ * @elements: Fields of each element of struct arrays
+ */
+type matTestVar struct {
+	class    uint32
+	flags    uint32
+	dims     []int32
+	name     string
+	data     []byte
+	elements []map[string]*matTestVar
+}
+
+// Reads the data element at the start of b, returning its type, data and encoded size
+func readMATElement(t *testing.T, b []byte) (typ uint32, data []byte, size int) {
+	t.Helper()
+	if len(b) < 8 {
+		t.Fatal("truncated MAT-file element")
+	}
+	typ = binary.LittleEndian.Uint32(b)
+	// Small data elements pack their size in the upper half of the type
+	if n := typ >> 16; n != 0 {
+		return typ & 0xffff, b[4 : 4+n], 8
+	}
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	size = 8 + n
+	if size%8 != 0 {
+		size += 8 - size%8
+	}
+	return typ, b[8 : 8+n], size
+}
+
+// Reads the content of a miMATRIX element
+func readMATMatrix(t *testing.T, b []byte) *matTestVar {
+	t.Helper()
+	v := &matTestVar{}
+	var parts [][]byte
+	for len(b) > 0 {
+		_, data, size := readMATElement(t, b)
+		parts = append(parts, data)
+		b = b[size:]
+	}
+	if len(parts) < 3 {
+		t.Fatalf("got %d parts of a matrix", len(parts))
+	}
+	flags := binary.LittleEndian.Uint32(parts[0])
+	v.class, v.flags = flags&0xff, flags>>8&0xff
+	for i := 0; i < len(parts[1]); i += 4 {
+		v.dims = append(v.dims, int32(binary.LittleEndian.Uint32(parts[1][i:])))
+	}
+	v.name = string(parts[2])
+	if v.class != mxSTRUCT {
+		if len(parts) > 3 {
+			v.data = parts[3]
+		}
+		return v
+	}
+
+	length := int(binary.LittleEndian.Uint32(parts[3]))
+	var fields []string
+	for i := 0; i+length <= len(parts[4]); i += length {
+		fields = append(fields, strings.TrimRight(string(parts[4][i:i+length]), "\x00"))
+	}
+	values := parts[5:]
+	for len(values) >= len(fields) && len(fields) > 0 {
+		element := make(map[string]*matTestVar)
+		for i, field := range fields {
+			element[field] = readMATMatrix(t, values[i])
+		}
+		v.elements = append(v.elements, element)
+		values = values[len(fields):]
+	}
+	return v
+}
+
+func (v *matTestVar) floats() []float64 {
+	values := make([]float64, len(v.data)/8)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(v.data[8*i:]))
+	}
+	return values
+}
+
+func (v *matTestVar) string() string {
+	chars := make([]uint16, len(v.data)/2)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(v.data[2*i:])
+	}
+	return string(utf16.Decode(chars))
+}
+
+func TestWriteMATRoundTrip(t *testing.T) {
+	rec := testRecord(t, FileTypeBinary32)
+	var buf bytes.Buffer
+	if err := rec.WriteMAT(&buf, MATOptions{Scaling: ScalePrimary}); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+	if len(content) < 128 || !strings.HasPrefix(string(content), "MATLAB 5.0 MAT-file") || string(content[126:128]) != "IM" {
+		t.Fatal("invalid MAT-file header")
+	}
+
+	vars := make(map[string]*matTestVar)
+	for b := content[128:]; len(b) > 0; {
+		typ, data, size := readMATElement(t, b)
+		if typ != miMATRIX {
+			t.Fatalf("got element type %d, want miMATRIX", typ)
+		}
+		v := readMATMatrix(t, data)
+		vars[v.name] = v
+		b = b[size:]
+	}
+
+	record := vars["record"]
+	if record == nil || len(record.elements) != 1 {
+		t.Fatal("missing record variable")
+	}
+	if got := record.elements[0]["station"].string(); got != rec.GetStationName() {
+		t.Errorf("got station %q, want %q", got, rec.GetStationName())
+	}
+	if got := record.elements[0]["scaling"].string(); got != "primary" {
+		t.Errorf("got scaling %q, want primary", got)
+	}
+	assertFloats(t, "trigger", record.elements[0]["trigger"].floats(), []float64{0.001}, 1e-9)
+
+	analog := vars["analog"]
+	if analog == nil || len(analog.elements) != 2 {
+		t.Fatal("missing analog channels")
+	}
+	for c, want := range [][]float64{testVA, testIA} {
+		element := analog.elements[c]
+		data := element["data"]
+		if data.class != mxDOUBLE || len(data.dims) != 2 || int(data.dims[0]) != len(want) || data.dims[1] != 1 {
+			t.Errorf("got class %d and dimensions %v of analog data", data.class, data.dims)
+		}
+		assertFloats(t, element["name"].string(), data.floats(), want, 1e-3)
+		assertFloats(t, "time", element["time"].floats(), testTimes, 1e-9)
+	}
+	if got := analog.elements[1]["name"].string(); got != "IA" {
+		t.Errorf("got analog channel %q, want IA", got)
+	}
+
+	digital := vars["digital"]
+	if digital == nil || len(digital.elements) != 1 {
+		t.Fatal("missing digital channels")
+	}
+	data := digital.elements[0]["data"]
+	if data.class != mxUINT8 || data.flags&mxLogicalFlag == 0 {
+		t.Errorf("got class %d and flags %#x of digital data, want logical", data.class, data.flags)
+	}
+	if !bytes.Equal(data.data, testTRIP) || digital.elements[0]["name"].string() != "TRIP" {
+		t.Errorf("got %s %v, want TRIP %v", digital.elements[0]["name"].string(), data.data, testTRIP)
+	}
+}
+
+func TestWriteMATTooLarge(t *testing.T) {
+	rec := testRecord(t, FileTypeBinary32)
+	var buf bytes.Buffer
+	if err := rec.WriteMAT(&buf, MATOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Data sizes of the record, analog and digital variables
+	var sizes []uint64
+	for b := buf.Bytes()[128:]; len(b) > 0; {
+		_, data, size := readMATElement(t, b)
+		sizes = append(sizes, uint64(len(data)))
+		b = b[size:]
+	}
+	if len(sizes) != 3 || sizes[1] <= sizes[0] || sizes[1] <= sizes[2] {
+		t.Fatalf("variable sizes %v, want the analog variable the largest", sizes)
+	}
+
+	// The limit lowered below the analog variable only
+	defer func(max uint64) { matMaxSize = max }(matMaxSize)
+	matMaxSize = sizes[1] - 1
+	buf.Reset()
+	err := rec.WriteMAT(&buf, MATOptions{})
+	if err == nil || !strings.Contains(err.Error(), "variable analog") || !strings.Contains(err.Error(), "v7.3") {
+		t.Fatalf("WriteMAT = %v, want the analog variable refused", err)
+	}
+	matMaxSize = sizes[1]
+	if err := rec.WriteMAT(&buf, MATOptions{}); err != nil {
+		t.Errorf("WriteMAT at the limit: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package comgo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Extensions of the files making up a record
+const (
+	ExtCFG = ".cfg"
+	ExtDAT = ".dat"
+	ExtHDR = ".hdr"
+	ExtINF = ".inf"
+	ExtCFF = ".cff"
+)
+
+/*
+ * Record - A COMTRADE record with its companion files
+ * @CFG: Configuration parameters and data file content
+ * @Name: Path of the record without extension
+ * @Header: Content of the header file (.hdr), if any
+ * @Info: Content of the information file (.inf), if any
+ */
+type Record struct {
+	*CFG
+	Name   string
+	Header []byte
+	Info   []byte
+}
+
+func (m *Record) GetCFG() *CFG {
+	if m != nil {
+		return m.CFG
+	}
+	return nil
+}
+
+func (m *Record) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Record) GetHeader() []byte {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *Record) GetInfo() []byte {
+	if m != nil {
+		return m.Info
+	}
+	return nil
+}
+
+// Open reads the record name from the file system
+// name may name the .cfg, .dat or .cff file, or the record without extension
+func Open(name string) (*Record, error) {
+	rec, err := OpenFS(os.DirFS(filepath.Dir(name)), filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	rec.Name = filepath.Join(filepath.Dir(name), path.Base(rec.Name))
+	return rec, nil
+}
+
+// OpenFS reads the record name from fsys, companion files are found case-insensitively
+// and may be gzip compressed
+// name may name the .cfg, .dat or .cff file, or the record without extension
+func OpenFS(fsys fs.FS, name string) (*Record, error) {
+	dir, base := path.Dir(name), path.Base(name)
+	if strings.EqualFold(path.Ext(base), ".gz") {
+		base = strings.TrimSuffix(base, path.Ext(base))
+	}
+	switch strings.ToLower(path.Ext(base)) {
+	case ExtCFG, ExtDAT, ExtHDR, ExtINF, ExtCFF:
+		base = strings.TrimSuffix(base, path.Ext(base))
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// Companion files may be gzip compressed, e.g. record.dat.gz
+		entryName := entry.Name()
+		if strings.EqualFold(path.Ext(entryName), ".gz") {
+			entryName = strings.TrimSuffix(entryName, path.Ext(entryName))
+		}
+		ext := path.Ext(entryName)
+		if strings.EqualFold(strings.TrimSuffix(entryName, ext), base) {
+			files[strings.ToLower(ext)] = path.Join(dir, entry.Name())
+		}
+	}
+
+	// The combined file format holds every part of the record
+	if cff, ok := files[ExtCFF]; ok && (files[ExtCFG] == "" || strings.EqualFold(path.Ext(name), ExtCFF)) {
+		var rec *Record
+		err := readFS(fsys, cff, func(rd io.Reader) (err error) {
+			rec, err = ReadCFF(rd)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		rec.Name = path.Join(dir, base)
+		return rec, nil
+	}
+
+	cfgName, ok := files[ExtCFG]
+	if !ok {
+		return nil, fmt.Errorf("%s: configuration file not found", path.Join(dir, base))
+	}
+	datName, ok := files[ExtDAT]
+	if !ok {
+		return nil, fmt.Errorf("%s: data file not found", path.Join(dir, base))
+	}
+
+	cfg := NewCFG()
+	rec := &Record{CFG: &cfg, Name: path.Join(dir, base)}
+	if err := readFS(fsys, cfgName, cfg.ReadCFG); err != nil {
+		return nil, err
+	}
+	if err := readFS(fsys, datName, cfg.ReadDAT); err != nil {
+		return nil, err
+	}
+	if hdr, ok := files[ExtHDR]; ok {
+		if err := readFS(fsys, hdr, func(rd io.Reader) (err error) {
+			rec.Header, err = readAll(rd)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if inf, ok := files[ExtINF]; ok {
+		if err := readFS(fsys, inf, func(rd io.Reader) (err error) {
+			rec.Info, err = readAll(rd)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// Opens name in fsys and hands it to read
+func readFS(fsys fs.FS, name string, read func(io.Reader) error) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := read(file); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// Reads a record stored in the combined file format (.cff) of C37.111-2013
+// sections start with "--- file type: CFG ---", "DAT ASCII", "DAT BINARY: <size>", "HDR" or "INF"
+func ReadCFF(rd io.Reader) (*Record, error) {
+	cfg := NewCFG()
+	rec := &Record{CFG: &cfg}
+	br, err := decompress(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	var section string
+	var content, cfgContent []byte
+	flush := func() {
+		switch section {
+		case "CFG":
+			cfgContent = content
+		case "HDR":
+			rec.Header = content
+		case "INF":
+			rec.Info = content
+		case "DAT":
+			cfg.DataFileContent = content
+		}
+		content = nil
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+
+		header := ByteToString(line)
+		if !strings.HasPrefix(header, "---") || !strings.Contains(strings.ToLower(header), "file type:") {
+			content = append(content, line...)
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+
+		flush()
+		fileType := strings.TrimSpace(strings.Trim(header[strings.Index(strings.ToLower(header), "file type:")+len("file type:"):], "-"))
+		fields := strings.Fields(strings.ToUpper(strings.Replace(fileType, ":", " ", -1)))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("cff format error: invalid section %q", header)
+		}
+		section = fields[0]
+
+		// Binary data sections give their size in bytes
+		if section == "DAT" && len(fields) > 2 && fields[1] != FileTypeASCII {
+			size, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("cff format error: invalid data size in %q", header)
+			}
+			content = make([]byte, size)
+			if _, err := io.ReadFull(br, content); err != nil {
+				return nil, fmt.Errorf("cff format error: data section: %v", err)
+			}
+			flush()
+			section = ""
+		}
+	}
+	flush()
+
+	if cfgContent == nil {
+		return nil, errors.New("cff format error: missing CFG section")
+	}
+	if err := cfg.ReadCFG(bytes.NewReader(cfgContent)); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,80 @@
+package comgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Returns content gzip compressed
+func gzipped(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenFS(t *testing.T) {
+	cfg := []byte(fmt.Sprintf(testDatCFG, FileTypeASCII))
+	dat := []byte("1,0,10,0\n2,1000,,0\n3,2000,-4,1\n")
+	fsys := fstest.MapFS{
+		"rec/FAULT.CFG":     {Data: cfg},
+		"rec/fault.Dat.gz":  {Data: gzipped(t, dat)},
+		"rec/Fault.hdr":     {Data: []byte("header\n")},
+		"rec/fault.INF":     {Data: []byte("[info]\n")},
+		"rec/faults.dat":    {Data: []byte("not a companion\n")},
+		"rec/other.cfg":     {Data: cfg},
+		"rec/combined.cff":  {Data: []byte("--- file type: CFG ---\n" + string(cfg) + "--- file type: DAT ASCII ---\n" + string(dat))},
+		"rec/combined.cfg":  {Data: cfg},
+		"rec/sub/fault.dat": {Data: dat},
+	}
+
+	for _, name := range []string{"rec/fault", "rec/FAULT.CFG", "rec/fault.cfg", "rec/fault.dat.gz", "rec/FAULT.HDR"} {
+		t.Run(name, func(t *testing.T) {
+			rec, err := OpenFS(fsys, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The record is named as given, without extension
+			if !strings.EqualFold(rec.Name, "rec/fault") {
+				t.Errorf("got name %q, want rec/fault", rec.Name)
+			}
+			if string(rec.Header) != "header\n" || string(rec.Info) != "[info]\n" {
+				t.Errorf("got header %q and info %q", rec.Header, rec.Info)
+			}
+			values, err := rec.GetAnalogChannelData(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFloats(t, "VA", values, []float64{6, math.NaN(), -1}, 1e-12)
+		})
+	}
+
+	// A .cff file is read when named, or when there is no .cfg file
+	rec, err := OpenFS(fsys, "rec/combined.cff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, err := rec.GetAnalogChannelData(1); err != nil || len(values) != 3 {
+		t.Errorf("got %v, %v from the .cff file", values, err)
+	}
+	if _, err := OpenFS(fsys, "rec/combined"); err == nil {
+		t.Error("opened rec/combined from its .cfg file without a .dat file")
+	}
+
+	for _, name := range []string{"rec/other", "rec/missing", "rec/sub/fault"} {
+		if _, err := OpenFS(fsys, name); err == nil {
+			t.Errorf("opened %s", name)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package comgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Parquet physical types, encodings and codecs used by the writer
+const (
+	parquetBoolean = 0
+	parquetInt64   = 2
+	parquetDouble  = 5
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetGzip         = 2
+)
+
+// Thrift compact protocol field types
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// Maximum number of samples per row group
+const parquetRowGroupSize = 1 << 20
+
+/*
+ * ParquetOptions - Content of a Parquet export
+ * @Analog: Analog channel numbers to export, nil for all
+ * @Digital: Digital channel numbers to export, nil for all
+ * @Scaling: Scaling of analog values
+ * @Compress: Compress pages with gzip
+ */
+type ParquetOptions struct {
+	Analog   []uint16
+	Digital  []uint16
+	Scaling  Scaling
+	Compress bool
+}
+
+/*
+ * thriftWriter - Minimal encoder of the Thrift compact protocol used by Parquet metadata
+ * @buf: Encoded bytes
+ * @last: Last field id of each open struct
+ */
+type thriftWriter struct {
+	buf  []byte
+	last []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf = append(t.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) bool(id int16, v bool) {
+	if v {
+		t.field(id, thriftTrue)
+	} else {
+		t.field(id, thriftFalse)
+	}
+}
+
+func (t *thriftWriter) string(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+func (t *thriftWriter) list(id int16, elem byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xf0|elem)
+		t.varint(uint64(size))
+	}
+}
+
+// Opens a struct field, or a list element when id is 0
+func (t *thriftWriter) begin(id int16) {
+	if id != 0 {
+		t.field(id, thriftStruct)
+	}
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+/*
+ * parquetColumn - A column chunk written to the file
+ * @name: Column name
+ * @kind: Parquet physical type
+ * @offset: Offset of the data page header in the file
+ * @size: Uncompressed size including the page header
+ * @compressed: Compressed size including the page header
+ * @rows: Number of values
+ */
+type parquetColumn struct {
+	name       string
+	kind       int32
+	offset     int64
+	size       int64
+	compressed int64
+	rows       int64
+}
+
+/*
+ * parquetWriter - Writes pages and keeps track of the file offset
+ * @w: Destination
+ * @offset: Bytes written so far
+ * @compress: Compress pages with gzip
+ */
+type parquetWriter struct {
+	w        io.Writer
+	offset   int64
+	compress bool
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+// Writes a data page holding the PLAIN encoded values of a required column
+func (pw *parquetWriter) writePage(col *parquetColumn, values []byte, rows int) error {
+	data := values
+	if pw.compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(values); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	t := &thriftWriter{last: []int16{0}}
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(len(values)))
+	t.i32(3, int32(len(data)))
+	t.begin(5)
+	t.i32(1, int32(rows))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.end()
+	t.buf = append(t.buf, 0)
+
+	col.offset, col.rows = pw.offset, int64(rows)
+	col.size = int64(len(t.buf) + len(values))
+	col.compressed = int64(len(t.buf) + len(data))
+	if err := pw.write(t.buf); err != nil {
+		return err
+	}
+	return pw.write(data)
+}
+
+// Returns the column names, made unique with the channel index when names repeat
+func uniqueNames(names []string) []string {
+	seen := make(map[string]int)
+	for _, name := range names {
+		seen[name]++
+	}
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[i] = name
+		if seen[name] > 1 || name == "time" {
+			result[i] = name + "_" + strconv.Itoa(i+1)
+		}
+	}
+	return result
+}
+
+// WriteParquet writes the selected channels as a Parquet file: a "time" column of UTC
+// timestamps in nanoseconds, one double column per analog channel and one boolean column
+// per digital channel. Missing analog samples are stored as NaN.
+// The record metadata is stored in the file key/value metadata, "comtrade" holds the
+// JSONRecord encoding of the configuration and the selected channels.
+func (cfg *CFG) WriteParquet(w io.Writer, opts ParquetOptions) error {
+	t, err := cfg.decodeTable(opts.Analog, opts.Digital, opts.Scaling)
+	if err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(cfg.jsonMetadata(t.analog, t.digital, opts.Scaling))
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, ch := range t.analog {
+		names = append(names, ch.Name)
+	}
+	for _, ch := range t.digital {
+		names = append(names, ch.Name)
+	}
+	names = append([]string{"time"}, uniqueNames(names)...)
+
+	pw := &parquetWriter{w: w, compress: opts.Compress}
+	if err := pw.write([]byte("PAR1")); err != nil {
+		return err
+	}
+
+	start := cfg.GetStartTimeUTC().UnixNano()
+	var groups [][]parquetColumn
+	// One row group per parquetRowGroupSize samples, a single empty one for an empty record
+	for first := 0; ; first += parquetRowGroupSize {
+		last := first + parquetRowGroupSize
+		if last > len(t.times) {
+			last = len(t.times)
+		}
+		rows := last - first
+		columns := make([]parquetColumn, len(names))
+
+		buf := make([]byte, rows*8)
+		for i, offset := range t.times[first:last] {
+			binary.LittleEndian.PutUint64(buf[i*8:], uint64(start+int64(math.Round(offset*1e9))))
+		}
+		columns[0] = parquetColumn{name: names[0], kind: parquetInt64}
+		if err := pw.writePage(&columns[0], buf, rows); err != nil {
+			return err
+		}
+
+		for c, values := range t.values {
+			for i, v := range values[first:last] {
+				binary.LittleEndian.PutUint64(buf[i*8:], math.Float64bits(v))
+			}
+			col := &columns[1+c]
+			col.name, col.kind = names[1+c], parquetDouble
+			if err := pw.writePage(col, buf, rows); err != nil {
+				return err
+			}
+		}
+
+		for c, states := range t.states {
+			// Booleans are bit packed, least significant bit first
+			buf = make([]byte, (rows+7)/8)
+			for i, state := range states[first:last] {
+				if state != 0 {
+					buf[i/8] |= 1 << uint(i%8)
+				}
+			}
+			col := &columns[1+len(t.values)+c]
+			col.name, col.kind = names[1+len(t.values)+c], parquetBoolean
+			if err := pw.writePage(col, buf, rows); err != nil {
+				return err
+			}
+		}
+		groups = append(groups, columns)
+		if last == len(t.times) {
+			break
+		}
+	}
+
+	footer := cfg.parquetFooter(names, groups, int64(len(t.times)), opts.Compress, string(meta))
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(footer)))
+	if err := pw.write(size); err != nil {
+		return err
+	}
+	return pw.write([]byte("PAR1"))
+}
+
+// Encodes the FileMetaData of the Parquet file
+func (cfg *CFG) parquetFooter(names []string, groups [][]parquetColumn, rows int64, compress bool, meta string) []byte {
+	codec := int32(parquetUncompressed)
+	if compress {
+		codec = parquetGzip
+	}
+
+	t := &thriftWriter{last: []int16{0}}
+	t.i32(1, 1)
+
+	// Schema: a root element followed by one required element per column
+	t.list(2, thriftStruct, len(names)+1)
+	t.begin(0)
+	t.string(4, "schema")
+	t.i32(5, int32(len(names)))
+	t.end()
+	for i, name := range names {
+		t.begin(0)
+		t.i32(1, groups[0][i].kind)
+		t.i32(3, 0) // REQUIRED
+		t.string(4, name)
+		if i == 0 {
+			// TIMESTAMP(isAdjustedToUTC=true, unit=NANOS)
+			t.begin(10)
+			t.begin(8)
+			t.bool(1, true)
+			t.begin(2)
+			t.begin(3)
+			t.end()
+			t.end()
+			t.end()
+			t.end()
+		}
+		t.end()
+	}
+
+	t.i64(3, rows)
+
+	t.list(4, thriftStruct, len(groups))
+	for _, columns := range groups {
+		var size, compressed int64
+		t.begin(0)
+		t.list(1, thriftStruct, len(columns))
+		for _, col := range columns {
+			size += col.size
+			compressed += col.compressed
+			t.begin(0)
+			t.i64(2, col.offset)
+			t.begin(3)
+			t.i32(1, col.kind)
+			t.list(2, thriftI32, 2)
+			t.zigzag(parquetPlain)
+			t.zigzag(parquetRLE)
+			t.list(3, thriftBinary, 1)
+			t.varint(uint64(len(col.name)))
+			t.buf = append(t.buf, col.name...)
+			t.i32(4, codec)
+			t.i64(5, col.rows)
+			t.i64(6, col.size)
+			t.i64(7, col.compressed)
+			t.i64(9, col.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, columns[0].rows)
+		t.i64(5, columns[0].offset)
+		t.i64(6, compressed)
+		t.end()
+	}
+
+	metadata := [][2]string{
+		{"comtrade", meta},
+		{"comtrade.station", cfg.GetStationName()},
+		{"comtrade.device", cfg.GetRecordDeviceId()},
+		{"comtrade.start_time", cfg.GetStartTimeUTC().Format(time.RFC3339Nano)},
+		{"comtrade.trigger_time", cfg.GetTriggerTimeUTC().Format(time.RFC3339Nano)},
+	}
+	t.list(5, thriftStruct, len(metadata))
+	for _, kv := range metadata {
+		t.begin(0)
+		t.string(1, kv[0])
+		t.string(2, kv[1])
+		t.end()
+	}
+	t.string(6, "comgo")
+	t.buf = append(t.buf, 0)
+	return t.buf
+}
@@ -0,0 +1,219 @@
+package comgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+)
+
+/*
+ * thriftReader - Decoder of the Thrift compact protocol, independent of thriftWriter
+ * @buf: Encoded bytes
+ * @pos: Read position
+ */
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		panic(errors.New("thrift: unexpected end of data"))
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) varint() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		b := r.byte()
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v
+		}
+	}
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// Reads a value of typ: bool, int64, float64, []byte, []interface{} or map[int16]interface{}
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, thriftI32, thriftI64:
+		return r.zigzag()
+	case 7:
+		b := r.buf[r.pos : r.pos+8]
+		r.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case thriftBinary:
+		n := int(r.varint())
+		b := r.buf[r.pos : r.pos+n]
+		r.pos += n
+		return b
+	case thriftList, 10:
+		header := r.byte()
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			if elem == thriftTrue || elem == thriftFalse {
+				list[i] = r.byte() == thriftTrue
+			} else {
+				list[i] = r.value(elem)
+			}
+		}
+		return list
+	case thriftStruct:
+		fields := make(map[int16]interface{})
+		var id int16
+		for {
+			header := r.byte()
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(r.zigzag())
+			}
+			fields[id] = r.value(header & 0x0f)
+		}
+	}
+	panic(errors.New("thrift: unsupported type"))
+}
+
+// Reads the Thrift struct at the start of b, returning its fields and encoded size
+func readThriftStruct(b []byte) (fields map[int16]interface{}, size int) {
+	r := &thriftReader{buf: b}
+	fields = r.value(thriftStruct).(map[int16]interface{})
+	return fields, r.pos
+}
+
+/*
+ * parquetTestFile - Content of a Parquet file read by readParquet
+ * @names: Column names
+ * @values: Data page values of each column, uncompressed
+ * @rows: Number of rows
+ * @metadata: Key/value metadata
+ */
+type parquetTestFile struct {
+	names    []string
+	values   [][]byte
+	rows     []int64
+	metadata map[string]string
+}
+
+// Reads a Parquet file with a single row group and one page per column
+func readParquet(t *testing.T, content []byte) *parquetTestFile {
+	t.Helper()
+	n := len(content)
+	if n < 12 || string(content[:4]) != "PAR1" || string(content[n-4:]) != "PAR1" {
+		t.Fatal("missing PAR1 magic")
+	}
+	size := int(binary.LittleEndian.Uint32(content[n-8:]))
+	footer, _ := readThriftStruct(content[n-8-size : n-8])
+
+	f := &parquetTestFile{metadata: make(map[string]string)}
+	schema := footer[2].([]interface{})
+	for _, element := range schema[1:] {
+		f.names = append(f.names, string(element.(map[int16]interface{})[4].([]byte)))
+	}
+	for _, kv := range footer[5].([]interface{}) {
+		fields := kv.(map[int16]interface{})
+		f.metadata[string(fields[1].([]byte))] = string(fields[2].([]byte))
+	}
+
+	groups := footer[4].([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("got %d row groups, want 1", len(groups))
+	}
+	for _, chunk := range groups[0].(map[int16]interface{})[1].([]interface{}) {
+		meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		offset := int(meta[9].(int64))
+		page, headerSize := readThriftStruct(content[offset:])
+		data := content[offset+headerSize : offset+headerSize+int(page[3].(int64))]
+		if meta[4].(int64) == parquetGzip {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = ioutil.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(data) != int(page[2].(int64)) {
+			t.Errorf("got %d bytes of page data, want %d", len(data), page[2])
+		}
+		f.values = append(f.values, data)
+		f.rows = append(f.rows, meta[5].(int64))
+	}
+	return f
+}
+
+func TestWriteParquetRoundTrip(t *testing.T) {
+	rec := testRecord(t, FileTypeBinary)
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := rec.WriteParquet(&buf, ParquetOptions{Scaling: ScalePrimary, Compress: compress}); err != nil {
+			t.Fatal(err)
+		}
+		f := readParquet(t, buf.Bytes())
+		if want := []string{"time", "VA", "IA", "TRIP"}; !reflect.DeepEqual(f.names, want) {
+			t.Fatalf("compress %v: got columns %v, want %v", compress, f.names, want)
+		}
+		for i, rows := range f.rows {
+			if rows != int64(len(testTimes)) {
+				t.Errorf("compress %v: got %d rows in column %s", compress, rows, f.names[i])
+			}
+		}
+
+		// Time stamps in nanoseconds, doubles and bit packed booleans, all PLAIN encoded
+		start := rec.GetStartTimeUTC().UnixNano()
+		times := make([]float64, len(testTimes))
+		for i := range times {
+			times[i] = float64(int64(binary.LittleEndian.Uint64(f.values[0][i*8:]))-start) / 1e9
+		}
+		assertFloats(t, "time", times, testTimes, 1e-9)
+		for c, want := range [][]float64{testVA, testIA} {
+			values := make([]float64, len(want))
+			for i := range values {
+				values[i] = math.Float64frombits(binary.LittleEndian.Uint64(f.values[1+c][i*8:]))
+			}
+			assertFloats(t, f.names[1+c], values, want, 1e-2)
+		}
+		states := make([]uint8, len(testTRIP))
+		for i := range states {
+			states[i] = f.values[3][i/8] >> uint(i%8) & 1
+		}
+		if !bytes.Equal(states, testTRIP) {
+			t.Errorf("compress %v: got TRIP %v, want %v", compress, states, testTRIP)
+		}
+
+		var m JSONRecord
+		if err := json.Unmarshal([]byte(f.metadata["comtrade"]), &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Station != rec.GetStationName() || f.metadata["comtrade.station"] != rec.GetStationName() || len(m.Analog) != 2 {
+			t.Errorf("compress %v: got metadata %v", compress, f.metadata)
+		}
+	}
+}
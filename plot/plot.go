@@ -0,0 +1,512 @@
+// Package plot draws the analog and digital channels of a COMTRADE record to SVG and PNG images.
+package plot
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ValleyZw/comgo"
+)
+
+// Default sizes in pixels
+const (
+	DefaultWidth       = 960
+	DefaultPanelHeight = 120
+	DefaultLaneHeight  = 16
+)
+
+// Largest sizes in pixels, the image of a chart being held in memory
+const (
+	MaxWidth       = 8192
+	MaxPanelHeight = 2048
+	MaxLaneHeight  = 256
+	MaxPixels      = 16 << 20
+)
+
+// Layout in pixels
+const (
+	marginLeft   = 72
+	marginRight  = 28
+	marginTop    = 36
+	marginBottom = 40
+	panelGap     = 10
+	charWidth    = 6
+	yTicks       = 4
+	xTicks       = 8
+)
+
+// Colors of the chart
+var (
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colorPanel      = color.RGBA{0xfa, 0xfa, 0xfa, 0xff}
+	colorLane       = color.RGBA{0xf2, 0xf2, 0xf2, 0xff}
+	colorGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	colorAxis       = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	colorText       = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	colorTrigger    = color.RGBA{0x94, 0x67, 0xbd, 0xff}
+	colorHigh       = color.RGBA{0xff, 0xd8, 0xa8, 0xff}
+	colorState      = color.RGBA{0xe6, 0x7e, 0x00, 0xff}
+)
+
+// Colors of the phases, others take the palette in turn
+var phaseColors = map[string]color.RGBA{
+	"A": {0xd4, 0xa0, 0x17, 0xff},
+	"B": {0x2c, 0xa0, 0x2c, 0xff},
+	"C": {0xd6, 0x27, 0x28, 0xff},
+	"N": {0x55, 0x55, 0x55, 0xff},
+}
+
+var palette = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+	{0x17, 0xbe, 0xcf, 0xff},
+	{0xe3, 0x77, 0xc2, 0xff},
+	{0x7f, 0x7f, 0x7f, 0xff},
+}
+
+/*
+ * Options - Channels, time window and size of a chart
+ * @Analog: Analog channels drawn in a panel each, nil for every channel, empty for none
+ * @Digital: Digital channels drawn in a lane each under the panels, nil for every channel, empty for none
+ * @ChangedOnly: Whether to skip digital channels that do not change in the window
+ * @Scaling: Scaling of the analog values
+ * @From: Start of the window in seconds from the trigger, negative before it
+ * @To: End of the window in seconds from the trigger, the whole record is drawn when To is not after From
+ * @Width: Image width in pixels, DefaultWidth when 0, at most MaxWidth
+ * @PanelHeight: Height of the analog panels in pixels, DefaultPanelHeight when 0, at most MaxPanelHeight
+ * @LaneHeight: Height of the digital lanes in pixels, DefaultLaneHeight when 0, at most MaxLaneHeight
+ * @Title: Title above the chart, station, device and trigger time when empty
+ */
+type Options struct {
+	Analog      []uint16
+	Digital     []uint16
+	ChangedOnly bool
+	Scaling     comgo.Scaling
+	From        float64
+	To          float64
+	Width       int
+	PanelHeight int
+	LaneHeight  int
+	Title       string
+}
+
+/*
+ * series - Values of an analog channel
+ * @label: Number, name and unit of the channel
+ * @color: Line color
+ * @values: Value of every sample
+ * @low: Bottom of the value axis
+ * @high: Top of the value axis
+ */
+type series struct {
+	label     string
+	color     color.RGBA
+	values    []float64
+	low, high float64
+}
+
+/*
+ * lane - States of a digital channel
+ * @label: Name of the channel
+ * @states: State of every sample
+ */
+type lane struct {
+	label  string
+	states []uint8
+}
+
+/*
+ * Chart - Channels of a record ready to be drawn
+ * @opts: Options with the defaults set
+ * @title: Title above the chart
+ * @times: Time of every sample in seconds from the trigger
+ * @first: Index of the first sample in the window
+ * @last: Index following the last sample in the window
+ * @from: Time at the left edge
+ * @to: Time at the right edge
+ * @analog: Analog panels from top to bottom
+ * @digital: Digital lanes from top to bottom
+ */
+type Chart struct {
+	opts        Options
+	title       string
+	times       []float64
+	first, last int
+	from, to    float64
+	analog      []series
+	digital     []lane
+}
+
+// Returns the chart of the channels of cfg selected by opts, charts of more than MaxPixels
+// pixels are refused
+func New(cfg *comgo.CFG, opts Options) (*Chart, error) {
+	if cfg == nil {
+		return nil, errors.New("no record to plot")
+	}
+	if opts.Width <= 0 {
+		opts.Width = DefaultWidth
+	}
+	if opts.PanelHeight <= 0 {
+		opts.PanelHeight = DefaultPanelHeight
+	}
+	if opts.LaneHeight <= 0 {
+		opts.LaneHeight = DefaultLaneHeight
+	}
+	if opts.Width < marginLeft+marginRight+xTicks*charWidth {
+		return nil, fmt.Errorf("plot width %d too small", opts.Width)
+	}
+	if opts.Width > MaxWidth || opts.PanelHeight > MaxPanelHeight || opts.LaneHeight > MaxLaneHeight {
+		return nil, fmt.Errorf("plot size too large, at most %d pixels wide, panels %d and lanes %d pixels high",
+			MaxWidth, MaxPanelHeight, MaxLaneHeight)
+	}
+
+	times, err := cfg.GetSampleTimes()
+	if err != nil {
+		return nil, err
+	}
+	if len(times) == 0 {
+		return nil, errors.New("no sample to plot")
+	}
+	trigger := cfg.GetTriggerTime().Sub(cfg.GetStartTime()).Seconds()
+	for i := range times {
+		times[i] -= trigger
+	}
+	c := &Chart{opts: opts, title: opts.Title, times: times, from: times[0], to: times[len(times)-1]}
+	if opts.To > opts.From {
+		c.from, c.to = math.Max(c.from, opts.From), math.Min(c.to, opts.To)
+	}
+	for c.first < len(times) && times[c.first] < c.from {
+		c.first++
+	}
+	c.last = c.first
+	for c.last < len(times) && times[c.last] <= c.to {
+		c.last++
+	}
+	if c.first == c.last {
+		return nil, fmt.Errorf("no sample between %g and %g s from the trigger", opts.From, opts.To)
+	}
+	if c.to == c.from {
+		// A single sample is drawn in the middle of a millisecond
+		c.from, c.to = c.from-0.0005, c.to+0.0005
+	}
+	if c.title == "" {
+		c.title = fmt.Sprintf("%s  %s  %s", cfg.GetStationName(), cfg.GetRecordDeviceId(), cfg.GetTriggerTime().Format(comgo.ISOTimeFormat))
+	}
+
+	analog := opts.Analog
+	if analog == nil {
+		for _, ch := range cfg.GetAnalogChannels() {
+			analog = append(analog, ch.GetIndex())
+		}
+	}
+	for i, num := range analog {
+		ch, err := cfg.GetAnalogChannel(num)
+		if err != nil {
+			return nil, err
+		}
+		values, err := cfg.GetAnalogChannelDataScaled(num, opts.Scaling)
+		if err != nil {
+			return nil, err
+		}
+		s := series{label: fmt.Sprintf("%d %s", ch.GetIndex(), ch.GetOriginalName()), values: values}
+		if ch.GetUnit() != "" {
+			s.label += " [" + ch.GetUnit() + "]"
+		}
+		var ok bool
+		if s.color, ok = phaseColors[strings.ToUpper(ch.GetPhase())]; !ok {
+			s.color = palette[i%len(palette)]
+		}
+		s.low, s.high = valueRange(values[c.first:c.last])
+		c.analog = append(c.analog, s)
+	}
+
+	digital := opts.Digital
+	if digital == nil {
+		for _, ch := range cfg.GetDigitalChannels() {
+			digital = append(digital, ch.GetIndex())
+		}
+	}
+	for _, num := range digital {
+		ch, err := cfg.GetDigitalChannel(num)
+		if err != nil {
+			return nil, err
+		}
+		states, err := cfg.GetDigitalChannelData(num)
+		if err != nil {
+			return nil, err
+		}
+		if opts.ChangedOnly && !Changes(states[c.first:c.last]) {
+			continue
+		}
+		c.digital = append(c.digital, lane{label: ch.GetOriginalName(), states: states})
+	}
+	if width, height := c.Size(); width*height > MaxPixels {
+		return nil, fmt.Errorf("plot of %dx%d pixels too large, at most %d pixels", width, height, MaxPixels)
+	}
+	return c, nil
+}
+
+// Returns the chart size in pixels
+func (c *Chart) Size() (int, int) {
+	height := marginTop + marginBottom
+	if len(c.analog) > 0 {
+		height += len(c.analog)*(c.opts.PanelHeight+panelGap) - panelGap
+	}
+	if len(c.digital) > 0 {
+		if len(c.analog) > 0 {
+			height += panelGap
+		}
+		height += len(c.digital) * c.opts.LaneHeight
+	}
+	return c.opts.Width, height
+}
+
+// Returns the number of channels drawn, analog then digital
+func (c *Chart) Channels() (int, int) {
+	return len(c.analog), len(c.digital)
+}
+
+// Returns the bottom and top of the value axis of values, padded so that lines do not
+// touch the panel edges
+func valueRange(values []float64) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if !comgo.IsMissing(v) && !math.IsInf(v, 0) {
+			low, high = math.Min(low, v), math.Max(high, v)
+		}
+	}
+	switch {
+	case low > high:
+		return -1, 1
+	case low == high:
+		pad := math.Max(math.Abs(low)*0.1, 1)
+		return low - pad, high + pad
+	}
+	pad := (high - low) * 0.05
+	return low - pad, high + pad
+}
+
+// Changes returns whether states holds both states, as digital channels left out by
+// Options.ChangedOnly do not
+func Changes(states []uint8) bool {
+	for _, s := range states {
+		if s != states[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns round values from low to high, about n of them, and the decimals showing them
+func ticks(low, high float64, n int) ([]float64, int) {
+	raw := (high - low) / float64(n)
+	if raw <= 0 || math.IsNaN(raw) || math.IsInf(raw, 0) {
+		return nil, 0
+	}
+	scale := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := 10 * scale
+	for _, f := range []float64{1, 2, 5} {
+		if raw <= f*scale {
+			step = f * scale
+			break
+		}
+	}
+	decimals := int(-math.Floor(math.Log10(step) + 1e-9))
+	if decimals < 0 {
+		decimals = 0
+	}
+	var values []float64
+	for i := math.Ceil(low / step); i*step <= high+step*1e-9; i++ {
+		v := i * step
+		if math.Abs(v) < step*1e-9 {
+			v = 0
+		}
+		values = append(values, v)
+	}
+	return values, decimals
+}
+
+// Returns s cut to n characters
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n < 2 {
+		return string(r[:n])
+	}
+	return string(r[:n-1]) + "~"
+}
+
+// Anchors of a text
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// Point of a polyline
+type point struct {
+	x, y float64
+}
+
+// surface - Drawing primitives of an image format, y going down
+type surface interface {
+	rect(x, y, w, h float64, fill color.RGBA)
+	line(x0, y0, x1, y1 float64, stroke color.RGBA, dashed bool)
+	polyline(points []point, stroke color.RGBA)
+	// text draws s vertically centered on y
+	text(x, y float64, s string, fill color.RGBA, a anchor)
+}
+
+// Draws the chart on s
+func (c *Chart) draw(s surface) {
+	width, height := c.Size()
+	left, right := float64(marginLeft), float64(width-marginRight)
+	x := func(t float64) float64 {
+		return left + (t-c.from)/(c.to-c.from)*(right-left)
+	}
+	top, bottom := float64(marginTop), float64(height-marginBottom)
+
+	s.rect(0, 0, float64(width), float64(height), colorBackground)
+	s.text(left, 12, c.title, colorText, anchorStart)
+
+	timeTicks, timeDecimals := ticks(c.from, c.to, xTicks)
+	y := top
+	for _, a := range c.analog {
+		h := float64(c.opts.PanelHeight)
+		s.rect(left, y, right-left, h, colorPanel)
+		for _, t := range timeTicks {
+			s.line(x(t), y, x(t), y+h, colorGrid, false)
+		}
+		value := func(v float64) float64 {
+			return y + (a.high-v)/(a.high-a.low)*h
+		}
+		valueTicks, decimals := ticks(a.low, a.high, yTicks)
+		for _, v := range valueTicks {
+			s.line(left, value(v), right, value(v), colorGrid, false)
+			s.line(left-3, value(v), left, value(v), colorAxis, false)
+			s.text(left-5, value(v), strconv.FormatFloat(v, 'f', decimals, 64), colorText, anchorEnd)
+		}
+		s.line(left, y, left, y+h, colorAxis, false)
+		// The label background hides the grid, not the values
+		s.rect(left+1, y+1, float64(len([]rune(a.label))*charWidth+6), 14, colorPanel)
+		for _, line := range c.analogLines(a, x, value) {
+			if len(line) == 1 {
+				// A sample between missing values shows as a dot
+				s.rect(line[0].x-1.5, line[0].y-1.5, 3, 3, a.color)
+				continue
+			}
+			s.polyline(line, a.color)
+		}
+		s.text(left+4, y+8, a.label, colorText, anchorStart)
+		y += h + panelGap
+	}
+	if len(c.analog) > 0 && len(c.digital) == 0 {
+		y -= panelGap
+	}
+
+	labelChars := (marginLeft - 8) / charWidth
+	for i, d := range c.digital {
+		h := float64(c.opts.LaneHeight)
+		if i%2 == 0 {
+			s.rect(left, y, right-left, h, colorLane)
+		}
+		low, high := y+h-3, y+3
+		level := func(state uint8) float64 {
+			if state != 0 {
+				return high
+			}
+			return low
+		}
+		// Steps at each change of state, high spans filled
+		states := d.states[c.first:c.last]
+		times := c.times[c.first:c.last]
+		start := 0
+		line := []point{{x(times[0]), level(states[0])}}
+		for j := 1; j <= len(states); j++ {
+			if j < len(states) && states[j] == states[start] {
+				continue
+			}
+			end := c.to
+			if j < len(states) {
+				end = times[j]
+			}
+			if states[start] != 0 {
+				s.rect(x(times[start]), high, x(end)-x(times[start]), low-high, colorHigh)
+			}
+			line = append(line, point{x(end), level(states[start])})
+			if j < len(states) {
+				line = append(line, point{x(end), level(states[j])})
+			}
+			start = j
+		}
+		s.polyline(line, colorState)
+		s.text(left-5, y+h/2, truncate(d.label, labelChars), colorText, anchorEnd)
+		y += h
+	}
+
+	s.line(left, bottom, right, bottom, colorAxis, false)
+	for _, t := range timeTicks {
+		s.line(x(t), bottom, x(t), bottom+4, colorAxis, false)
+		s.text(x(t), bottom+12, strconv.FormatFloat(t, 'f', timeDecimals, 64), colorText, anchorMiddle)
+	}
+	s.text((left+right)/2, bottom+28, "time from the trigger [s]", colorText, anchorMiddle)
+
+	if c.from <= 0 && c.to >= 0 {
+		s.line(x(0), top-4, x(0), bottom, colorTrigger, true)
+		s.text(x(0), top-10, "trigger", colorTrigger, anchorMiddle)
+	}
+}
+
+// Returns the polylines of a series, broken at missing values: the samples as they are when
+// sparse, else the first, lowest, highest and last value of each pixel column
+func (c *Chart) analogLines(a series, x, value func(float64) float64) [][]point {
+	var lines [][]point
+	var line []point
+	var first, low, high, last, at float64
+	column, n := 0, 0
+	flush := func() {
+		switch {
+		case n == 1:
+			line = append(line, point{at, value(first)})
+		case n > 1:
+			center := float64(column) + 0.5
+			line = append(line, point{center, value(first)}, point{center, value(low)},
+				point{center, value(high)}, point{center, value(last)})
+		}
+		n = 0
+	}
+	for i := c.first; i < c.last; i++ {
+		v := a.values[i]
+		if comgo.IsMissing(v) || math.IsInf(v, 0) {
+			flush()
+			if len(line) > 0 {
+				lines = append(lines, line)
+			}
+			line = nil
+			continue
+		}
+		px := x(c.times[i])
+		if n > 0 && int(math.Floor(px)) != column {
+			flush()
+		}
+		if n == 0 {
+			column, at = int(math.Floor(px)), px
+			first, low, high = v, v, v
+		}
+		low, high, last = math.Min(low, v), math.Max(high, v), v
+		n++
+	}
+	flush()
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,201 @@
+package plot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValleyZw/comgo"
+)
+
+// Returns a record of n analog channels and a digital one
+func testCFG(t *testing.T, n int) *comgo.CFG {
+	t.Helper()
+	cfg := comgo.NewCFG()
+	cfg.StationName, cfg.RecordDeviceId = "North", "Relay 7"
+	cfg.StartTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.TriggerTime = cfg.StartTime.Add(time.Millisecond)
+	cfg.AnalogDetail, cfg.DigitDetail = &comgo.ChannelA{}, &comgo.ChannelD{}
+	times := []float64{0, 0.001, 0.002, 0.003}
+	var analog [][]float64
+	for i := 0; i < n; i++ {
+		cfg.AnalogDetail.AddChannel(comgo.AnalogChannel{Number: uint16(i + 1), Name: "IA", OriginalName: "IA", Unit: "A", Primary: 1, Secondary: 1})
+		analog = append(analog, []float64{0, 1, -1, 0.5})
+	}
+	cfg.DigitDetail.AddChannel(comgo.DigitalChannel{Number: 1, Name: "TRIP", OriginalName: "TRIP"})
+	if err := cfg.SetSamples(times, analog, [][]uint8{{0, 1, 1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+func TestNewSize(t *testing.T) {
+	chart, err := New(testCFG(t, 2), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	width, height := chart.Size()
+	want := marginTop + marginBottom + 2*DefaultPanelHeight + panelGap + panelGap + DefaultLaneHeight
+	if width != DefaultWidth || height != want {
+		t.Errorf("got %dx%d, want %dx%d", width, height, DefaultWidth, want)
+	}
+	var buf bytes.Buffer
+	if err := chart.WritePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewRefusesLargeCharts(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		channels int
+		opts     Options
+	}{
+		{"width", 1, Options{Width: 20000}},
+		{"panel height", 1, Options{PanelHeight: MaxPanelHeight + 1}},
+		{"lane height", 1, Options{LaneHeight: MaxLaneHeight + 1}},
+		{"area", 40, Options{Width: MaxWidth, PanelHeight: MaxPanelHeight}},
+	} {
+		if _, err := New(testCFG(t, tc.channels), tc.opts); err == nil {
+			t.Errorf("%s: chart accepted", tc.name)
+		}
+	}
+}
+
+// Returns a record with a channel named to be escaped, missing values, a digital channel
+// changing state and one that does not, the trigger at the second sample
+func testSVGCFG(t *testing.T) *comgo.CFG {
+	t.Helper()
+	cfg := comgo.NewCFG()
+	cfg.StationName, cfg.RecordDeviceId = "North", "Relay 7"
+	cfg.StartTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.TriggerTime = cfg.StartTime.Add(time.Millisecond)
+	cfg.AnalogDetail, cfg.DigitDetail = &comgo.ChannelA{}, &comgo.ChannelD{}
+	cfg.AnalogDetail.AddChannel(comgo.AnalogChannel{Number: 1, Name: "I<A&B", OriginalName: "I<A&B", Phase: "B", Unit: "A", Primary: 1, Secondary: 1})
+	cfg.DigitDetail.AddChannel(comgo.DigitalChannel{Number: 1, Name: "TRIP", OriginalName: "TRIP"})
+	cfg.DigitDetail.AddChannel(comgo.DigitalChannel{Number: 2, Name: "CLOSE", OriginalName: "CLOSE"})
+	times := []float64{0, 0.001, 0.002, 0.003, 0.004}
+	analog := [][]float64{{0, 1, math.NaN(), 0.5, 2}}
+	digital := [][]uint8{{0, 1, 1, 0, 0}, {0, 0, 0, 0, 0}}
+	if err := cfg.SetSamples(times, analog, digital); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+// Returns the SVG image of chart, checked to be well formed
+func testSVG(t *testing.T, chart *Chart) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := chart.WriteSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid SVG: %v", err)
+		}
+	}
+	return buf.String()
+}
+
+func TestWriteSVG(t *testing.T) {
+	chart, err := New(testSVGCFG(t), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := testSVG(t, chart)
+	for _, want := range []string{
+		`stroke="#9467bd" stroke-dasharray="4 3"/>`,
+		`>trigger</text>`,
+		`>1 I&lt;A&amp;B [A]</text>`,
+		`>TRIP</text>`,
+		`>CLOSE</text>`,
+		`>time from the trigger [s]</text>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG without %s", want)
+		}
+	}
+	if strings.Contains(svg, "I<A") {
+		t.Error("channel name not escaped")
+	}
+	// The line breaks at the missing value
+	if n := strings.Count(svg, `<polyline fill="none" stroke-linejoin="round" stroke="#2ca02c"`); n != 2 {
+		t.Errorf("%d lines of phase B, want 2", n)
+	}
+
+	// Single samples on either side of the missing value are dots
+	chart, err = New(testSVGCFG(t), Options{From: -0.0005, To: 0.0025, Digital: []uint16{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg = testSVG(t, chart)
+	if n := strings.Count(svg, `<polyline fill="none" stroke-linejoin="round" stroke="#2ca02c"`); n != 0 {
+		t.Errorf("%d lines of phase B in the window, want none", n)
+	}
+	if n := strings.Count(svg, `width="3.0" height="3.0" fill="#2ca02c"/>`); n != 2 {
+		t.Errorf("%d dots of phase B in the window, want 2", n)
+	}
+}
+
+func TestNewWindow(t *testing.T) {
+	cfg := testSVGCFG(t)
+	for _, tc := range []struct {
+		name        string
+		opts        Options
+		first, last int
+		trigger     bool
+	}{
+		{"whole record", Options{}, 0, 5, true},
+		{"To not after From", Options{From: 0.002, To: 0.001}, 0, 5, true},
+		{"around the trigger", Options{From: -0.0005, To: 0.0015}, 1, 3, true},
+		{"after the trigger", Options{From: 0.0015, To: 0.01}, 3, 5, false},
+	} {
+		chart, err := New(cfg, tc.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if chart.first != tc.first || chart.last != tc.last {
+			t.Errorf("%s: samples %d to %d, want %d to %d", tc.name, chart.first, chart.last, tc.first, tc.last)
+		}
+		if got := strings.Contains(testSVG(t, chart), ">trigger</text>"); got != tc.trigger {
+			t.Errorf("%s: trigger drawn %v, want %v", tc.name, got, tc.trigger)
+		}
+	}
+	if _, err := New(cfg, Options{From: 0.0012, To: 0.0018}); err == nil {
+		t.Error("window without samples accepted")
+	}
+}
+
+func TestNewChangedOnly(t *testing.T) {
+	cfg := testSVGCFG(t)
+	for _, tc := range []struct {
+		name    string
+		opts    Options
+		digital int
+	}{
+		{"every channel", Options{}, 2},
+		{"changed", Options{ChangedOnly: true}, 1},
+		{"changed in the window", Options{ChangedOnly: true, From: 0, To: 0.001}, 0},
+		{"selected", Options{ChangedOnly: true, Digital: []uint16{2}}, 0},
+	} {
+		chart, err := New(cfg, tc.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if _, digital := chart.Channels(); digital != tc.digital {
+			t.Errorf("%s: %d digital channels, want %d", tc.name, digital, tc.digital)
+		}
+	}
+	if Changes([]uint8{1, 1}) || !Changes([]uint8{1, 0}) || Changes(nil) {
+		t.Error("Changes")
+	}
+}
@@ -0,0 +1,104 @@
+package plot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+// pngSurface - Surface rasterizing to an image, text drawn with the bitmap font
+type pngSurface struct {
+	img *image.RGBA
+}
+
+func (s *pngSurface) rect(x, y, w, h float64, fill color.RGBA) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h)))
+	draw.Draw(s.img, r, image.NewUniform(fill), image.Point{}, draw.Src)
+}
+
+// Draws a line with the Bresenham algorithm, dashes being 4 pixels on and 3 off
+func (s *pngSurface) line(x0, y0, x1, y1 float64, stroke color.RGBA, dashed bool) {
+	ax, ay := int(math.Floor(x0)), int(math.Floor(y0))
+	bx, by := int(math.Floor(x1)), int(math.Floor(y1))
+	dx, dy := abs(bx-ax), -abs(by-ay)
+	sx, sy := 1, 1
+	if ax > bx {
+		sx = -1
+	}
+	if ay > by {
+		sy = -1
+	}
+	e := dx + dy
+	for k := 0; ; k++ {
+		if !dashed || k%7 < 4 {
+			s.img.SetRGBA(ax, ay, stroke)
+		}
+		if ax == bx && ay == by {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			ax += sx
+		} else {
+			e += dx
+			ay += sy
+		}
+	}
+}
+
+func (s *pngSurface) polyline(points []point, stroke color.RGBA) {
+	if len(points) == 1 {
+		s.line(points[0].x, points[0].y, points[0].x, points[0].y, stroke, false)
+	}
+	for i := 1; i < len(points); i++ {
+		s.line(points[i-1].x, points[i-1].y, points[i].x, points[i].y, stroke, false)
+	}
+}
+
+func (s *pngSurface) text(x, y float64, text string, fill color.RGBA, a anchor) {
+	runes := []rune(text)
+	left := int(math.Round(x))
+	switch a {
+	case anchorMiddle:
+		left -= len(runes) * charWidth / 2
+	case anchorEnd:
+		left -= len(runes) * charWidth
+	}
+	top := int(math.Round(y)) - 3
+	for i, r := range runes {
+		// Characters outside of the font show as a question mark
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+		for row, bits := range font[r-' '] {
+			for col := 0; col < 5; col++ {
+				if bits&(0x10>>uint(col)) != 0 {
+					s.img.SetRGBA(left+i*charWidth+col, top+row, fill)
+				}
+			}
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Returns the chart drawn on an image
+func (c *Chart) Image() *image.RGBA {
+	width, height := c.Size()
+	s := &pngSurface{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+	c.draw(s)
+	return s.img
+}
+
+// Writes the chart as a PNG image
+func (c *Chart) WritePNG(w io.Writer) error {
+	return png.Encode(w, c.Image())
+}
@@ -0,0 +1,70 @@
+package plot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// svgSurface - Surface writing SVG elements to a buffer
+type svgSurface struct {
+	buf bytes.Buffer
+}
+
+// Formats a coordinate
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+// Formats a color
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (s *svgSurface) rect(x, y, w, h float64, fill color.RGBA) {
+	fmt.Fprintf(&s.buf, "<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"%s\"/>\n",
+		svgNumber(x), svgNumber(y), svgNumber(w), svgNumber(h), svgColor(fill))
+}
+
+func (s *svgSurface) line(x0, y0, x1, y1 float64, stroke color.RGBA, dashed bool) {
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="4 3"`
+	}
+	fmt.Fprintf(&s.buf, "<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" stroke=\"%s\"%s/>\n",
+		svgNumber(x0), svgNumber(y0), svgNumber(x1), svgNumber(y1), svgColor(stroke), dash)
+}
+
+func (s *svgSurface) polyline(points []point, stroke color.RGBA) {
+	s.buf.WriteString(`<polyline fill="none" stroke-linejoin="round" stroke="` + svgColor(stroke) + `" points="`)
+	for i, p := range points {
+		if i > 0 {
+			s.buf.WriteByte(' ')
+		}
+		s.buf.WriteString(svgNumber(p.x) + "," + svgNumber(p.y))
+	}
+	s.buf.WriteString("\"/>\n")
+}
+
+func (s *svgSurface) text(x, y float64, text string, fill color.RGBA, a anchor) {
+	anchors := [...]string{anchorStart: "start", anchorMiddle: "middle", anchorEnd: "end"}
+	fmt.Fprintf(&s.buf, "<text x=\"%s\" y=\"%s\" fill=\"%s\" text-anchor=\"%s\" dominant-baseline=\"central\">",
+		svgNumber(x), svgNumber(y), svgColor(fill), anchors[a])
+	xml.EscapeText(&s.buf, []byte(text))
+	s.buf.WriteString("</text>\n")
+}
+
+// Writes the chart as an SVG image
+func (c *Chart) WriteSVG(w io.Writer) error {
+	width, height := c.Size()
+	s := &svgSurface{}
+	fmt.Fprintf(&s.buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"10\" stroke-width=\"1\">\n",
+		width, height, width, height)
+	c.draw(s)
+	s.buf.WriteString("</svg>\n")
+	_, err := s.buf.WriteTo(w)
+	return err
+}
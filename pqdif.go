@@ -0,0 +1,943 @@
+package comgo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// pqdifGUID is a GUID in its binary form: little endian Data1 to Data3, then Data4 as is
+type pqdifGUID [16]byte
+
+// Parses a GUID written as xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func parseGUID(s string) pqdifGUID {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		panic("invalid GUID " + s)
+	}
+	var g pqdifGUID
+	g[0], g[1], g[2], g[3] = b[3], b[2], b[1], b[0]
+	g[4], g[5] = b[5], b[4]
+	g[6], g[7] = b[7], b[6]
+	copy(g[8:], b[8:])
+	return g
+}
+
+// Record signature and record, tag and identifier GUIDs of IEEE 1159.3
+var (
+	pqdifSignature = parseGUID("4a111440-e49f-11cf-9d89-0080c72e70a3")
+
+	pqdifRecContainer       = parseGUID("89738607-f1c3-11cf-9d89-0080c72e70a3")
+	pqdifRecDataSource      = parseGUID("89738619-f1c3-11cf-9d89-0080c72e70a3")
+	pqdifRecMonitorSettings = parseGUID("b48d858c-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifRecObservation     = parseGUID("8973861a-f1c3-11cf-9d89-0080c72e70a3")
+
+	// Container record
+	pqdifTagVersionInfo          = parseGUID("89738606-f1c3-11cf-9d89-0080c72e70a3")
+	pqdifTagFileName             = parseGUID("89738608-f1c3-11cf-9d89-0080c72e70a3")
+	pqdifTagCreation             = parseGUID("89738609-f1c3-11cf-9d89-0080c72e70a3")
+	pqdifTagCompressionStyle     = parseGUID("8973861b-f1c3-11cf-9d89-0080c72e70a3")
+	pqdifTagCompressionAlgorithm = parseGUID("8973861c-f1c3-11cf-9d89-0080c72e70a3")
+
+	// Data source record
+	pqdifTagDataSourceType   = parseGUID("b48d8581-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagSerialNumber     = parseGUID("b48d8584-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagDataSourceName   = parseGUID("b48d8586-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagEffective        = parseGUID("62f28183-f9c4-11cf-9d89-0080c72e70a3")
+	pqdifTagChannelDefns     = parseGUID("b48d858d-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagOneChannelDefn   = parseGUID("b48d858e-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagPhaseID          = parseGUID("b48d858f-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagQuantityType     = parseGUID("b48d8590-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagChannelName      = parseGUID("b48d8591-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagSeriesDefns      = parseGUID("b48d8592-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagOneSeriesDefn    = parseGUID("b48d8593-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagQuantityUnits    = parseGUID("b48d859b-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagValueType        = parseGUID("b48d859c-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagStorageMethod    = parseGUID("b48d85a1-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagQuantityMeasured = parseGUID("c690e872-f755-11cf-9d89-0080c72e70a3")
+
+	// Monitor settings record
+	pqdifTagNominalFrequency = parseGUID("0fa118c3-cb4a-11d2-b30b-fe25cb9a1760")
+
+	// Observation record
+	pqdifTagObservationName   = parseGUID("3d786f8a-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagTimeCreate        = parseGUID("3d786f8b-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagTimeStart         = parseGUID("3d786f8c-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagTriggerMethod     = parseGUID("3d786f8d-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagTimeTriggered     = parseGUID("3d786f8e-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagChannelInstances  = parseGUID("3d786f91-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagOneChannelInst    = parseGUID("3d786f92-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagChannelDefnIdx    = parseGUID("b48d858b-f5f5-11cf-9d89-0080c72e70a3")
+	pqdifTagSeriesInstances   = parseGUID("3d786f93-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagOneSeriesInstance = parseGUID("3d786f94-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagSeriesScale       = parseGUID("3d786f96-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagSeriesOffset      = parseGUID("3d786f97-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagSeriesValues      = parseGUID("3d786f99-f76e-11cf-9d89-0080c72e70a3")
+	pqdifTagShareChannelIdx   = parseGUID("8973861f-f1c3-11cf-9d89-0080c72e70a3")
+	pqdifTagShareSeriesIdx    = parseGUID("89738620-f1c3-11cf-9d89-0080c72e70a3")
+
+	// Identifiers
+	pqdifDataSourceMeasure = parseGUID("e6b51730-f747-11cf-9d89-0080c72e70a3")
+	pqdifQuantityWaveform  = parseGUID("67f6af80-f753-11cf-9d89-0080c72e70a3")
+	pqdifValueTypeValue    = parseGUID("67f6af97-f753-11cf-9d89-0080c72e70a3")
+	pqdifValueTypeTime     = parseGUID("c690e86c-f755-11cf-9d89-0080c72e70a3")
+)
+
+// Element and physical types
+const (
+	pqdifCollection = 1
+	pqdifScalar     = 2
+	pqdifVector     = 3
+
+	pqdifBoolean1  = 1
+	pqdifBoolean2  = 2
+	pqdifBoolean4  = 3
+	pqdifChar1     = 10
+	pqdifChar2     = 11
+	pqdifInteger1  = 20
+	pqdifInteger2  = 21
+	pqdifInteger4  = 22
+	pqdifUnsigned1 = 30
+	pqdifUnsigned2 = 31
+	pqdifUnsigned4 = 32
+	pqdifReal4     = 40
+	pqdifReal8     = 41
+	pqdifComplex8  = 42
+	pqdifComplex16 = 43
+	pqdifTimestamp = 50
+	pqdifGUIDType  = 60
+)
+
+// Size in bytes of the values of each physical type
+var pqdifSizes = map[uint8]int{
+	pqdifBoolean1: 1, pqdifBoolean2: 2, pqdifBoolean4: 4,
+	pqdifChar1: 1, pqdifChar2: 2,
+	pqdifInteger1: 1, pqdifInteger2: 2, pqdifInteger4: 4,
+	pqdifUnsigned1: 1, pqdifUnsigned2: 2, pqdifUnsigned4: 4,
+	pqdifReal4: 4, pqdifReal8: 8, pqdifComplex8: 8, pqdifComplex16: 16,
+	pqdifTimestamp: 12, pqdifGUIDType: 16,
+}
+
+// Identifier values
+const (
+	pqdifCompressionTotalFile = 1
+	pqdifCompressionRecord    = 2
+	pqdifCompressionZlib      = 1
+
+	pqdifMeasuredStatus = 17
+
+	pqdifUnitsTimestamp = 1
+	pqdifUnitsSeconds   = 2
+
+	pqdifStorageValues    = 1
+	pqdifStorageIncrement = 4
+)
+
+// Size of the record header
+const pqdifHeaderSize = 64
+
+// PQDIF time stamps count days and seconds in the day, day 25569 being the Unix epoch
+// as in the reference implementation
+const pqdifUnixDays = 25569
+
+// Returns the time of a PQDIF time stamp
+func pqdifTimeOf(days uint32, seconds float64) time.Time {
+	return time.Unix((int64(days)-pqdifUnixDays)*86400, 0).UTC().Add(time.Duration(math.Round(seconds * 1e9)))
+}
+
+// Returns t as seconds from the PQDIF day 0, as time series of time stamps are
+func pqdifSeconds(t time.Time) float64 {
+	return float64(t.Unix()+pqdifUnixDays*86400) + float64(t.Nanosecond())/1e9
+}
+
+// Phases of PQDIF channels as COMTRADE phase identifiers, indexed by PQDIF phase ID
+var pqdifPhases = []string{"", "A", "B", "C", "N", "AB", "BC", "CA", "R", "Net", "+", "-", "0", "Total"}
+
+// Units of PQDIF quantities as COMTRADE units, indexed by PQDIF quantity units ID:
+// ID_QU_VOLTS is 4, ID_QU_AMPS 5 up to ID_QU_FEET 32
+var pqdifUnits = []string{"", "", "s", "cycles", "V", "A", "VA", "W", "var", "Ohm", "S", "V/A", "J", "Hz", "C", "deg", "dB", "%", "pu", "samples", "varh", "Wh", "VAh", "m/s", "mph", "bar", "Pa", "N", "Nm", "rpm", "rad/s", "m", "ft"}
+
+// PQDIF quantity measured IDs of COMTRADE units
+var pqdifMeasured = map[string]uint32{"V": 1, "A": 2, "VA": 3, "W": 3, "var": 3, "J": 4, "Wh": 4, "varh": 4, "VAh": 4, "C": 5, "Pa": 6, "bar": 6, "N": 12, "Nm": 13, "m": 14}
+
+// SI prefixes of COMTRADE units
+var siPrefixes = map[string]float64{"k": 1e3, "M": 1e6, "G": 1e9, "m": 1e-3, "u": 1e-6, "µ": 1e-6}
+
+// Returns the PQDIF units ID of unit and the factor converting values to them,
+// e.g. 1000 for "kV"
+func pqdifUnitID(unit string) (uint32, float64) {
+	unit = strings.TrimSpace(unit)
+	find := func(unit string) int {
+		for id, name := range pqdifUnits {
+			if name != "" && name == unit {
+				return id
+			}
+		}
+		for id, name := range pqdifUnits {
+			if name != "" && strings.EqualFold(name, unit) {
+				return id
+			}
+		}
+		return -1
+	}
+	if id := find(unit); id >= 0 {
+		return uint32(id), 1
+	}
+	for prefix, factor := range siPrefixes {
+		if strings.HasPrefix(unit, prefix) {
+			if id := find(strings.TrimPrefix(unit, prefix)); id >= 0 {
+				return uint32(id), factor
+			}
+		}
+	}
+	return 0, 1
+}
+
+// Returns the PQDIF phase ID of a COMTRADE phase identifier
+func pqdifPhaseID(phase string) uint32 {
+	phase = strings.ToUpper(strings.TrimSpace(phase))
+	switch phase {
+	case "AN", "A-N":
+		return 1
+	case "BN", "B-N":
+		return 2
+	case "CN", "C-N":
+		return 3
+	}
+	for id, name := range pqdifPhases {
+		if name != "" && strings.EqualFold(name, phase) {
+			return uint32(id)
+		}
+	}
+	return 0
+}
+
+/*
+ * pqdifElement - An element of a PQDIF record body
+ * @tag: Tag GUID
+ * @kind: Collection, scalar or vector
+ * @typ: Physical type of scalar and vector values
+ * @children: Elements of a collection
+ * @data: Encoded values of a scalar or vector
+ * @count: Number of values of a vector
+ */
+type pqdifElement struct {
+	tag      pqdifGUID
+	kind     uint8
+	typ      uint8
+	children []*pqdifElement
+	data     []byte
+	count    int
+}
+
+// Returns the first child element with the given tag, nil if there is none
+func (e *pqdifElement) find(tag pqdifGUID) *pqdifElement {
+	if e == nil {
+		return nil
+	}
+	for _, child := range e.children {
+		if child.tag == tag {
+			return child
+		}
+	}
+	return nil
+}
+
+// Returns the child elements with the given tag
+func (e *pqdifElement) findAll(tag pqdifGUID) []*pqdifElement {
+	var result []*pqdifElement
+	if e == nil {
+		return result
+	}
+	for _, child := range e.children {
+		if child.tag == tag {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+// Returns the values of a numeric scalar or vector
+func (e *pqdifElement) floats() ([]float64, error) {
+	if e == nil || e.kind == pqdifCollection {
+		return nil, errors.New("pqdif format error: numeric element expected")
+	}
+	size := pqdifSizes[e.typ]
+	if size == 0 || len(e.data) < size*e.count {
+		return nil, fmt.Errorf("pqdif format error: invalid element of physical type %d", e.typ)
+	}
+	result := make([]float64, e.count)
+	for i := range result {
+		b := e.data[i*size:]
+		switch e.typ {
+		case pqdifBoolean1, pqdifUnsigned1, pqdifChar1:
+			result[i] = float64(b[0])
+		case pqdifInteger1:
+			result[i] = float64(int8(b[0]))
+		case pqdifBoolean2, pqdifUnsigned2, pqdifChar2:
+			result[i] = float64(binary.LittleEndian.Uint16(b))
+		case pqdifInteger2:
+			result[i] = float64(int16(binary.LittleEndian.Uint16(b)))
+		case pqdifBoolean4, pqdifUnsigned4:
+			result[i] = float64(binary.LittleEndian.Uint32(b))
+		case pqdifInteger4:
+			result[i] = float64(int32(binary.LittleEndian.Uint32(b)))
+		case pqdifReal4, pqdifComplex8:
+			result[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case pqdifReal8, pqdifComplex16:
+			result[i] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		case pqdifTimestamp:
+			// Seconds from the PQDIF day 0
+			result[i] = float64(binary.LittleEndian.Uint32(b))*86400 + math.Float64frombits(binary.LittleEndian.Uint64(b[4:]))
+		default:
+			return nil, fmt.Errorf("pqdif format error: physical type %d is not numeric", e.typ)
+		}
+	}
+	return result, nil
+}
+
+// Returns the first value of a numeric element, def if the element is absent
+func (e *pqdifElement) float(def float64) float64 {
+	if e == nil {
+		return def
+	}
+	values, err := e.floats()
+	if err != nil || len(values) == 0 {
+		return def
+	}
+	return values[0]
+}
+
+// Returns the text of a character vector
+func (e *pqdifElement) string() string {
+	if e == nil || e.kind == pqdifCollection {
+		return ""
+	}
+	if e.typ == pqdifChar2 {
+		var runes []rune
+		for i := 0; i+1 < len(e.data); i += 2 {
+			runes = append(runes, rune(binary.LittleEndian.Uint16(e.data[i:])))
+		}
+		return strings.TrimRight(string(runes), "\x00")
+	}
+	return strings.TrimRight(string(e.data), "\x00")
+}
+
+// Returns the value of a time stamp element, false if the element is absent
+func (e *pqdifElement) time() (time.Time, bool) {
+	if e == nil || e.typ != pqdifTimestamp || len(e.data) < 12 {
+		return time.Time{}, false
+	}
+	days := binary.LittleEndian.Uint32(e.data)
+	seconds := math.Float64frombits(binary.LittleEndian.Uint64(e.data[4:]))
+	return pqdifTimeOf(days, seconds), true
+}
+
+// Returns the GUID of a GUID element
+func (e *pqdifElement) guid() pqdifGUID {
+	var g pqdifGUID
+	if e != nil && e.typ == pqdifGUIDType {
+		copy(g[:], e.data)
+	}
+	return g
+}
+
+// Decodes the collection stored at offset of a record body
+func parsePQDIFCollection(body []byte, offset int, depth int) ([]*pqdifElement, error) {
+	if depth > 32 {
+		return nil, errors.New("pqdif format error: collections nested too deeply")
+	}
+	if offset < 0 || offset+4 > len(body) {
+		return nil, errors.New("pqdif format error: collection out of record")
+	}
+	count := int(int32(binary.LittleEndian.Uint32(body[offset:])))
+	if count < 0 || offset+4+count*28 > len(body) {
+		return nil, errors.New("pqdif format error: invalid collection size")
+	}
+
+	elements := make([]*pqdifElement, count)
+	for i := range elements {
+		h := body[offset+4+i*28:]
+		e := &pqdifElement{kind: h[16], typ: h[17]}
+		copy(e.tag[:], h[:16])
+		embedded := h[18] != 0
+		link := int(int32(binary.LittleEndian.Uint32(h[20:])))
+
+		switch e.kind {
+		case pqdifCollection:
+			children, err := parsePQDIFCollection(body, link, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			e.children = children
+		case pqdifScalar:
+			size := pqdifSizes[e.typ]
+			if size == 0 {
+				return nil, fmt.Errorf("pqdif format error: unknown physical type %d", e.typ)
+			}
+			e.count = 1
+			if embedded {
+				if size > 8 {
+					return nil, fmt.Errorf("pqdif format error: embedded scalar of physical type %d", e.typ)
+				}
+				e.data = h[20 : 20+size]
+			} else {
+				if link < 0 || link+size > len(body) {
+					return nil, errors.New("pqdif format error: scalar out of record")
+				}
+				e.data = body[link : link+size]
+			}
+		case pqdifVector:
+			size := pqdifSizes[e.typ]
+			if size == 0 {
+				return nil, fmt.Errorf("pqdif format error: unknown physical type %d", e.typ)
+			}
+			if link < 0 || link+4 > len(body) {
+				return nil, errors.New("pqdif format error: vector out of record")
+			}
+			e.count = int(int32(binary.LittleEndian.Uint32(body[link:])))
+			if e.count < 0 || link+4+e.count*size > len(body) {
+				return nil, errors.New("pqdif format error: invalid vector size")
+			}
+			e.data = body[link+4 : link+4+e.count*size]
+		default:
+			return nil, fmt.Errorf("pqdif format error: unknown element type %d", e.kind)
+		}
+		elements[i] = e
+	}
+	return elements, nil
+}
+
+// Encodes a collection of elements into body, links are offsets from the start of body
+func encodePQDIFCollection(body []byte, elements []*pqdifElement) []byte {
+	start := len(body)
+	body = append(body, make([]byte, 4+28*len(elements))...)
+	binary.LittleEndian.PutUint32(body[start:], uint32(len(elements)))
+	for i, e := range elements {
+		header := start + 4 + i*28
+		copy(body[header:], e.tag[:])
+		body[header+16], body[header+17] = e.kind, e.typ
+		if e.kind == pqdifScalar && len(e.data) <= 8 {
+			body[header+18] = 1
+			copy(body[header+20:], e.data)
+			continue
+		}
+
+		// Linked elements are aligned on 4 bytes
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		link := len(body)
+		switch e.kind {
+		case pqdifCollection:
+			body = encodePQDIFCollection(body, e.children)
+		case pqdifVector:
+			body = append(body, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(body[link:], uint32(e.count))
+			body = append(body, e.data...)
+		default:
+			body = append(body, e.data...)
+		}
+		binary.LittleEndian.PutUint32(body[header+20:], uint32(link))
+		binary.LittleEndian.PutUint32(body[header+24:], uint32(len(body)-link))
+	}
+	return body
+}
+
+// Element constructors used by the writer
+func pqdifCollectionOf(tag pqdifGUID, children ...*pqdifElement) *pqdifElement {
+	return &pqdifElement{tag: tag, kind: pqdifCollection, children: children}
+}
+
+func pqdifUint(tag pqdifGUID, v uint32) *pqdifElement {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, v)
+	return &pqdifElement{tag: tag, kind: pqdifScalar, typ: pqdifUnsigned4, data: data, count: 1}
+}
+
+func pqdifGUIDOf(tag pqdifGUID, v pqdifGUID) *pqdifElement {
+	return &pqdifElement{tag: tag, kind: pqdifScalar, typ: pqdifGUIDType, data: v[:], count: 1}
+}
+
+func pqdifString(tag pqdifGUID, s string) *pqdifElement {
+	data := append([]byte(s), 0)
+	return &pqdifElement{tag: tag, kind: pqdifVector, typ: pqdifChar1, data: data, count: len(data)}
+}
+
+func pqdifTime(tag pqdifGUID, t time.Time) *pqdifElement {
+	unix := t.Unix()
+	days := unix / 86400
+	if unix%86400 < 0 {
+		days--
+	}
+	seconds := float64(unix-days*86400) + float64(t.Nanosecond())/1e9
+	days += pqdifUnixDays
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint32(data, uint32(days))
+	binary.LittleEndian.PutUint64(data[4:], math.Float64bits(seconds))
+	return &pqdifElement{tag: tag, kind: pqdifScalar, typ: pqdifTimestamp, data: data, count: 1}
+}
+
+func pqdifReals(tag pqdifGUID, kind uint8, values ...float64) *pqdifElement {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(v))
+	}
+	return &pqdifElement{tag: tag, kind: kind, typ: pqdifReal8, data: data, count: len(values)}
+}
+
+/*
+ * PQDIFOptions - Content of a PQDIF export
+ * @Analog: Analog channel numbers to export, nil for all
+ * @Digital: Digital channel numbers to export, nil for all
+ * @Scaling: Scaling of analog values, PQDIF quantities are usually primary
+ * @Compress: Compress the records following the container with zlib
+ */
+type PQDIFOptions struct {
+	Analog   []uint16
+	Digital  []uint16
+	Scaling  Scaling
+	Compress bool
+}
+
+// WritePQDIF writes the selected channels as a PQDIF (IEEE 1159.3) file made of a container,
+// a data source, a monitor settings and an observation record. Each channel is a waveform
+// channel holding a time series in seconds from the start time and a value series, values
+// in units with an SI prefix such as kV are converted to the base unit. Digital channels are
+// status channels of 0 and 1 values.
+func (cfg *CFG) WritePQDIF(w io.Writer, opts PQDIFOptions) error {
+	t, err := cfg.decodeTable(opts.Analog, opts.Digital, opts.Scaling)
+	if err != nil {
+		return err
+	}
+
+	style, algorithm := uint32(0), uint32(0)
+	if opts.Compress {
+		style, algorithm = pqdifCompressionRecord, pqdifCompressionZlib
+	}
+	container := []*pqdifElement{
+		{tag: pqdifTagVersionInfo, kind: pqdifVector, typ: pqdifUnsigned4, count: 4, data: []byte{1, 0, 0, 0, 5, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}},
+		pqdifString(pqdifTagFileName, cfg.GetStationName()+".pqd"),
+		pqdifTime(pqdifTagCreation, time.Now().UTC()),
+		pqdifUint(pqdifTagCompressionStyle, style),
+		pqdifUint(pqdifTagCompressionAlgorithm, algorithm),
+	}
+
+	// Channel definitions, with the factor converting values to the PQDIF units
+	var definitions, instances []*pqdifElement
+	var factors []float64
+	defineChannel := func(name, phase string, units, measured uint32) {
+		definitions = append(definitions, pqdifCollectionOf(pqdifTagOneChannelDefn,
+			pqdifString(pqdifTagChannelName, name),
+			pqdifUint(pqdifTagPhaseID, pqdifPhaseID(phase)),
+			pqdifGUIDOf(pqdifTagQuantityType, pqdifQuantityWaveform),
+			pqdifUint(pqdifTagQuantityMeasured, measured),
+			pqdifCollectionOf(pqdifTagSeriesDefns,
+				pqdifCollectionOf(pqdifTagOneSeriesDefn,
+					pqdifGUIDOf(pqdifTagValueType, pqdifValueTypeTime),
+					pqdifUint(pqdifTagQuantityUnits, pqdifUnitsSeconds),
+					pqdifUint(pqdifTagStorageMethod, pqdifStorageValues),
+				),
+				pqdifCollectionOf(pqdifTagOneSeriesDefn,
+					pqdifGUIDOf(pqdifTagValueType, pqdifValueTypeValue),
+					pqdifUint(pqdifTagQuantityUnits, units),
+					pqdifUint(pqdifTagStorageMethod, pqdifStorageValues),
+				),
+			),
+		))
+	}
+	for _, ch := range t.analog {
+		units, factor := pqdifUnitID(ch.Unit)
+		defineChannel(ch.Name, ch.Phase, units, pqdifMeasured[pqdifUnits[units]])
+		factors = append(factors, factor)
+	}
+	for _, ch := range t.digital {
+		defineChannel(ch.Name, ch.Phase, 0, pqdifMeasuredStatus)
+	}
+
+	// Every channel shares the time series of the first one
+	addInstance := func(values []float64) {
+		index := uint32(len(instances))
+		timeSeries := pqdifCollectionOf(pqdifTagOneSeriesInstance,
+			pqdifUint(pqdifTagShareChannelIdx, 0),
+			pqdifUint(pqdifTagShareSeriesIdx, 0),
+		)
+		if index == 0 {
+			timeSeries = pqdifCollectionOf(pqdifTagOneSeriesInstance, pqdifReals(pqdifTagSeriesValues, pqdifVector, t.times...))
+		}
+		instances = append(instances, pqdifCollectionOf(pqdifTagOneChannelInst,
+			pqdifUint(pqdifTagChannelDefnIdx, index),
+			pqdifCollectionOf(pqdifTagSeriesInstances,
+				timeSeries,
+				pqdifCollectionOf(pqdifTagOneSeriesInstance, pqdifReals(pqdifTagSeriesValues, pqdifVector, values...)),
+			),
+		))
+	}
+	for c, values := range t.values {
+		scaled := make([]float64, len(values))
+		for i, v := range values {
+			scaled[i] = v * factors[c]
+		}
+		addInstance(scaled)
+	}
+	for _, states := range t.states {
+		values := make([]float64, len(states))
+		for i, state := range states {
+			values[i] = float64(state)
+		}
+		addInstance(values)
+	}
+
+	dataSource := []*pqdifElement{
+		pqdifGUIDOf(pqdifTagDataSourceType, pqdifDataSourceMeasure),
+		pqdifString(pqdifTagDataSourceName, cfg.GetStationName()),
+		pqdifString(pqdifTagSerialNumber, cfg.GetRecordDeviceId()),
+		pqdifTime(pqdifTagEffective, cfg.GetStartTimeUTC()),
+		pqdifCollectionOf(pqdifTagChannelDefns, definitions...),
+	}
+	settings := []*pqdifElement{
+		pqdifTime(pqdifTagEffective, cfg.GetStartTimeUTC()),
+		pqdifReals(pqdifTagNominalFrequency, pqdifScalar, float64(cfg.GetLineFrequency())),
+	}
+	observation := []*pqdifElement{
+		pqdifString(pqdifTagObservationName, cfg.GetRecordDeviceId()),
+		pqdifTime(pqdifTagTimeCreate, time.Now().UTC()),
+		pqdifTime(pqdifTagTimeStart, cfg.GetStartTimeUTC()),
+		pqdifUint(pqdifTagTriggerMethod, 0),
+		pqdifTime(pqdifTagTimeTriggered, cfg.GetTriggerTimeUTC()),
+		pqdifCollectionOf(pqdifTagChannelInstances, instances...),
+	}
+
+	records := []struct {
+		typ      pqdifGUID
+		elements []*pqdifElement
+	}{
+		{pqdifRecContainer, container},
+		{pqdifRecDataSource, dataSource},
+		{pqdifRecMonitorSettings, settings},
+		{pqdifRecObservation, observation},
+	}
+	var offset int
+	for i, rec := range records {
+		body := encodePQDIFCollection(nil, rec.elements)
+		checksum := adler32.Checksum(body)
+		// The container is never compressed, it tells how the other records are
+		if opts.Compress && i > 0 {
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			if _, err := zw.Write(body); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			body = buf.Bytes()
+		}
+
+		header := make([]byte, pqdifHeaderSize)
+		copy(header, pqdifSignature[:])
+		copy(header[16:], rec.typ[:])
+		binary.LittleEndian.PutUint32(header[32:], pqdifHeaderSize)
+		binary.LittleEndian.PutUint32(header[36:], uint32(len(body)))
+		offset += pqdifHeaderSize + len(body)
+		if i < len(records)-1 {
+			binary.LittleEndian.PutUint32(header[40:], uint32(offset))
+		}
+		binary.LittleEndian.PutUint32(header[44:], checksum)
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenPQDIF reads every observation of the PQDIF file name, see ReadPQDIF
+func OpenPQDIF(name string) ([]*Record, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPQDIF(f)
+}
+
+// ReadPQDIF reads a PQDIF (IEEE 1159.3) file, gzip compressed or not, and returns one record
+// per observation. Channels are mapped to analog channels, status channels to digital ones.
+// The record holds the channels sharing the time series of the first channel of the
+// observation, other channels, e.g. trends recorded at another rate, are left out.
+func ReadPQDIF(rd io.Reader) ([]*Record, error) {
+	content, err := readAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	var dataSource, settings []*pqdifElement
+	var compressed bool
+	for offset := 0; ; {
+		if offset+pqdifHeaderSize > len(content) {
+			return nil, errors.New("pqdif format error: truncated record header")
+		}
+		header := content[offset:]
+		var signature, typ pqdifGUID
+		copy(signature[:], header)
+		copy(typ[:], header[16:])
+		if signature != pqdifSignature {
+			return nil, fmt.Errorf("pqdif format error: invalid record signature at offset %d", offset)
+		}
+		headerSize := int(binary.LittleEndian.Uint32(header[32:]))
+		bodySize := int(binary.LittleEndian.Uint32(header[36:]))
+		next := int(binary.LittleEndian.Uint32(header[40:]))
+		checksum := binary.LittleEndian.Uint32(header[44:])
+		if headerSize < pqdifHeaderSize || offset+headerSize+bodySize > len(content) {
+			return nil, fmt.Errorf("pqdif format error: truncated record at offset %d", offset)
+		}
+		body := content[offset+headerSize : offset+headerSize+bodySize]
+
+		if compressed && typ != pqdifRecContainer {
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("pqdif format error: record at offset %d: %v", offset, err)
+			}
+			raw, err := ioutil.ReadAll(zr)
+			if err != nil {
+				return nil, fmt.Errorf("pqdif format error: record at offset %d: %v", offset, err)
+			}
+			// Writers differ on whether the checksum covers the compressed or raw body
+			if checksum != 0 && checksum != adler32.Checksum(body) && checksum != adler32.Checksum(raw) {
+				return nil, fmt.Errorf("pqdif format error: checksum mismatch in record at offset %d", offset)
+			}
+			body = raw
+		} else if checksum != 0 && checksum != adler32.Checksum(body) {
+			return nil, fmt.Errorf("pqdif format error: checksum mismatch in record at offset %d", offset)
+		}
+
+		elements, err := parsePQDIFCollection(body, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		root := &pqdifElement{children: elements}
+		switch typ {
+		case pqdifRecContainer:
+			style := root.find(pqdifTagCompressionStyle).float(0)
+			algorithm := root.find(pqdifTagCompressionAlgorithm).float(0)
+			if style == pqdifCompressionTotalFile || style > pqdifCompressionRecord || algorithm > pqdifCompressionZlib {
+				return nil, fmt.Errorf("pqdif: unsupported compression style %g algorithm %g", style, algorithm)
+			}
+			compressed = style == pqdifCompressionRecord && algorithm == pqdifCompressionZlib
+		case pqdifRecDataSource:
+			dataSource, settings = elements, nil
+		case pqdifRecMonitorSettings:
+			settings = elements
+		case pqdifRecObservation:
+			rec, err := pqdifRecord(&pqdifElement{children: dataSource}, &pqdifElement{children: settings}, root)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rec)
+		}
+
+		if next == 0 {
+			break
+		}
+		if next <= offset {
+			return nil, fmt.Errorf("pqdif format error: record at offset %d links backwards", offset)
+		}
+		offset = next
+	}
+	if len(records) == 0 {
+		return nil, errors.New("pqdif: no observation record found")
+	}
+	return records, nil
+}
+
+// Returns the values of a series instance with its scale and offset applied, shared series
+// are looked up in the channel instances
+func pqdifSeriesValues(instances []*pqdifElement, series *pqdifElement, depth int) ([]float64, error) {
+	if values := series.find(pqdifTagSeriesValues); values != nil {
+		result, err := values.floats()
+		if err != nil {
+			return nil, err
+		}
+		scale := series.find(pqdifTagSeriesScale).float(1)
+		offset := series.find(pqdifTagSeriesOffset).float(0)
+		if scale != 1 || offset != 0 {
+			for i := range result {
+				result[i] = result[i]*scale + offset
+			}
+		}
+		return result, nil
+	}
+
+	share := series.find(pqdifTagShareChannelIdx)
+	if share == nil || depth > 4 {
+		return nil, errors.New("pqdif format error: series instance without values")
+	}
+	ch, idx := int(share.float(-1)), int(series.find(pqdifTagShareSeriesIdx).float(-1))
+	if ch < 0 || ch >= len(instances) {
+		return nil, fmt.Errorf("pqdif format error: shared channel %d out of range", ch)
+	}
+	shared := instances[ch].find(pqdifTagSeriesInstances).findAll(pqdifTagOneSeriesInstance)
+	if idx < 0 || idx >= len(shared) {
+		return nil, fmt.Errorf("pqdif format error: shared series %d out of range", idx)
+	}
+	return pqdifSeriesValues(instances, shared[idx], depth+1)
+}
+
+// Expands a series stored with the increment method: a number of rate changes
+// followed by sample count and increment pairs
+func pqdifIncrements(values []float64) []float64 {
+	var result []float64
+	var value float64
+	for i := 0; len(values) > 0 && i < int(values[0]) && 2+2*i < len(values); i++ {
+		count, increment := int(values[1+2*i]), values[2+2*i]
+		for j := 0; j < count; j++ {
+			result = append(result, value)
+			value += increment
+		}
+	}
+	return result
+}
+
+// Builds a record from an observation and the data source and monitor settings it refers to
+func pqdifRecord(dataSource, settings, observation *pqdifElement) (*Record, error) {
+	start, ok := observation.find(pqdifTagTimeStart).time()
+	if !ok {
+		return nil, errors.New("pqdif format error: observation without start time")
+	}
+	trigger, ok := observation.find(pqdifTagTimeTriggered).time()
+	if !ok {
+		trigger = start
+	}
+
+	cfg := NewCFG()
+	cfg.StationName = dataSource.find(pqdifTagDataSourceName).string()
+	cfg.RecordDeviceId = dataSource.find(pqdifTagSerialNumber).string()
+	if cfg.RecordDeviceId == "" {
+		cfg.RecordDeviceId = observation.find(pqdifTagObservationName).string()
+	}
+	cfg.RevisionYear = 2013
+	cfg.DataFileType = FileTypeFloat32
+	cfg.LineFrequency = uint16(math.Round(settings.find(pqdifTagNominalFrequency).float(0)))
+	cfg.StartTime, cfg.TriggerTime = start, trigger
+	cfg.TimeCode, cfg.LocalCode = "0", "0"
+	cfg.AnalogDetail, cfg.DigitDetail = &ChannelA{}, &ChannelD{}
+
+	definitions := dataSource.find(pqdifTagChannelDefns).findAll(pqdifTagOneChannelDefn)
+	instances := observation.find(pqdifTagChannelInstances).findAll(pqdifTagOneChannelInst)
+	var times []float64
+	var analog [][]float64
+	var digital [][]uint8
+	for _, instance := range instances {
+		idx := int(instance.find(pqdifTagChannelDefnIdx).float(-1))
+		if idx < 0 || idx >= len(definitions) {
+			return nil, fmt.Errorf("pqdif format error: channel definition %d out of range", idx)
+		}
+		definition := definitions[idx]
+		seriesDefinitions := definition.find(pqdifTagSeriesDefns).findAll(pqdifTagOneSeriesDefn)
+		series := instance.find(pqdifTagSeriesInstances).findAll(pqdifTagOneSeriesInstance)
+
+		var channelTimes, values []float64
+		var units uint32
+		for i, s := range series {
+			if i >= len(seriesDefinitions) {
+				break
+			}
+			sd := seriesDefinitions[i]
+			v, err := pqdifSeriesValues(instances, s, 0)
+			if err != nil {
+				return nil, err
+			}
+			if int(sd.find(pqdifTagStorageMethod).float(pqdifStorageValues))&pqdifStorageIncrement != 0 {
+				v = pqdifIncrements(v)
+			}
+			switch {
+			case sd.find(pqdifTagValueType).guid() == pqdifValueTypeTime && channelTimes == nil:
+				channelTimes = v
+				if sd.find(pqdifTagQuantityUnits).float(pqdifUnitsSeconds) == pqdifUnitsTimestamp {
+					// Absolute time stamps in seconds from the PQDIF day 0
+					origin := pqdifSeconds(start)
+					for i := range channelTimes {
+						channelTimes[i] -= origin
+					}
+				}
+			case values == nil:
+				values = v
+				units = uint32(sd.find(pqdifTagQuantityUnits).float(0))
+			}
+		}
+		if channelTimes == nil || values == nil {
+			continue
+		}
+		if times == nil {
+			times = channelTimes
+		}
+		if len(channelTimes) != len(times) || len(values) != len(times) {
+			continue
+		}
+
+		name := definition.find(pqdifTagChannelName).string()
+		phase := ""
+		if id := int(definition.find(pqdifTagPhaseID).float(0)); id < len(pqdifPhases) {
+			phase = pqdifPhases[id]
+		}
+		if definition.find(pqdifTagQuantityMeasured).float(0) == pqdifMeasuredStatus {
+			states := make([]uint8, len(values))
+			for i, v := range values {
+				if v != 0 {
+					states[i] = 1
+				}
+			}
+			ch := DigitalChannel{
+				Number:       cfg.DigitDetail.ChannelTotal + 1,
+				Name:         normalizeChannelName(name),
+				OriginalName: name,
+				Phase:        phase,
+			}
+			if len(states) > 0 {
+				ch.InitialState = states[0]
+			}
+			cfg.DigitDetail.AddChannel(ch)
+			digital = append(digital, states)
+			continue
+		}
+
+		unit := ""
+		if int(units) < len(pqdifUnits) {
+			unit = pqdifUnits[units]
+		}
+		cfg.AnalogDetail.AddChannel(AnalogChannel{
+			Number:       cfg.AnalogDetail.ChannelTotal + 1,
+			Name:         normalizeChannelName(name),
+			OriginalName: name,
+			Phase:        phase,
+			Unit:         unit,
+			Primary:      1,
+			Secondary:    1,
+			HasRatio:     true,
+		})
+		analog = append(analog, values)
+	}
+
+	if err := cfg.SetSamples(times, analog, digital); err != nil {
+		return nil, err
+	}
+	name := observation.find(pqdifTagObservationName).string()
+	if name == "" {
+		name = cfg.StationName
+	}
+	return &Record{CFG: &cfg, Name: name}, nil
+}
@@ -0,0 +1,182 @@
+package comgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// testdata/record_level.pqd is laid out as other IEEE 1159.3 tools write files, independently of
+// WritePQDIF: records after the container compressed with zlib at record level (style 2,
+// algorithm 1), time stamps counted from day 0 with the Unix epoch on day 25569. Its observation
+// starts on day 39083 at 44570.4075 s and triggers 0.3 s later, VA is stored as real4 values
+// with a scale of 0.5 and an offset of 1 in volts (ID_QU_VOLTS), IA as real8 values in amps
+// (ID_QU_AMPS), IA and TRIP share the time series of VA.
+func TestReadPQDIFRecordLevelCompression(t *testing.T) {
+	records, err := OpenPQDIF("testdata/record_level.pqd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.GetStationName() != "North" || rec.GetRecordDeviceId() != "Relay 7" || rec.Name != "Fault 12" {
+		t.Errorf("got station %q device %q name %q", rec.GetStationName(), rec.GetRecordDeviceId(), rec.Name)
+	}
+	if rec.GetLineFrequency() != 60 {
+		t.Errorf("got line frequency %d, want 60", rec.GetLineFrequency())
+	}
+	start := time.Date(2007, 1, 1, 12, 22, 50, 407500000, time.UTC)
+	if !rec.GetStartTime().Equal(start) {
+		t.Errorf("got start time %v, want %v", rec.GetStartTime(), start)
+	}
+	if trigger := start.Add(300 * time.Millisecond); !rec.GetTriggerTime().Equal(trigger) {
+		t.Errorf("got trigger time %v, want %v", rec.GetTriggerTime(), trigger)
+	}
+
+	times, err := rec.GetSampleTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloats(t, "times", times, []float64{0, 0.001, 0.002, 0.003}, 1e-9)
+	values, err := rec.GetAnalogChannelData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloats(t, "VA", values, []float64{2, 3, 0, 1}, 1e-6)
+	if ch, err := rec.GetAnalogChannel(1); err != nil || ch.GetName() != "VA" || ch.GetUnit() != "V" || ch.GetPhase() != "A" {
+		t.Errorf("got analog channel %+v, %v", ch, err)
+	}
+	if values, err = rec.GetAnalogChannelData(2); err != nil {
+		t.Fatal(err)
+	}
+	assertFloats(t, "IA", values, []float64{10, -20.5, 30, 0.25}, 1e-9)
+	if ch, err := rec.GetAnalogChannel(2); err != nil || ch.GetName() != "IA" || ch.GetUnit() != "A" {
+		t.Errorf("got analog channel %+v, %v", ch, err)
+	}
+	states, err := rec.GetDigitalChannelData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(states, []uint8{0, 0, 1, 1}) {
+		t.Errorf("got TRIP %v, want [0 0 1 1]", states)
+	}
+}
+
+func TestPQDIFTimeStamps(t *testing.T) {
+	for _, tc := range []struct {
+		days    uint32
+		seconds float64
+		want    time.Time
+	}{
+		{25569, 0, time.Unix(0, 0).UTC()},
+		{2, 0, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{39083, 44570.4075, time.Date(2007, 1, 1, 12, 22, 50, 407500000, time.UTC)},
+	} {
+		got := pqdifTimeOf(tc.days, tc.seconds)
+		if !got.Equal(tc.want) {
+			t.Errorf("pqdifTimeOf(%d, %g) = %v, want %v", tc.days, tc.seconds, got, tc.want)
+		}
+		e := pqdifTime(pqdifTagTimeStart, tc.want)
+		if back, _ := e.time(); !back.Equal(tc.want) {
+			t.Errorf("time stamp of %v reads back as %v", tc.want, back)
+		}
+		if days := binary.LittleEndian.Uint32(e.data); days != tc.days {
+			t.Errorf("time stamp of %v written on day %d, want %d", tc.want, days, tc.days)
+		}
+	}
+}
+
+// Quantity units IDs of IEEE 1159.3
+func TestPQDIFUnits(t *testing.T) {
+	const (
+		idQUSeconds = 2
+		idQUVolts   = 4
+		idQUAmps    = 5
+		idQUWatts   = 7
+		idQUHertz   = 13
+		idQUMeters  = 31
+		idQUFeet    = 32
+	)
+	for _, tc := range []struct {
+		unit   string
+		id     uint32
+		factor float64
+	}{
+		{"s", idQUSeconds, 1},
+		{"V", idQUVolts, 1},
+		{"kV", idQUVolts, 1e3},
+		{"A", idQUAmps, 1},
+		{"MW", idQUWatts, 1e6},
+		{"Hz", idQUHertz, 1},
+		{"m", idQUMeters, 1},
+		{"ft", idQUFeet, 1},
+	} {
+		if id, factor := pqdifUnitID(tc.unit); id != tc.id || factor != tc.factor {
+			t.Errorf("pqdifUnitID(%q) = %d, %g, want %d, %g", tc.unit, id, factor, tc.id, tc.factor)
+		}
+	}
+	if unit := pqdifUnits[idQUVolts]; unit != "V" {
+		t.Errorf("got unit %q for ID_QU_VOLTS, want V", unit)
+	}
+	if unit := pqdifUnits[idQUAmps]; unit != "A" {
+		t.Errorf("got unit %q for ID_QU_AMPS, want A", unit)
+	}
+}
+
+func TestWritePQDIFCompressed(t *testing.T) {
+	rec := testRecord(t, FileTypeASCII)
+	var buf bytes.Buffer
+	if err := rec.WritePQDIF(&buf, PQDIFOptions{Compress: true}); err != nil {
+		t.Fatal(err)
+	}
+	// The container declares record-level compression
+	content := buf.Bytes()
+	elements, err := parsePQDIFCollection(content[pqdifHeaderSize:], 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := &pqdifElement{children: elements}
+	if style := container.find(pqdifTagCompressionStyle).float(0); style != pqdifCompressionRecord {
+		t.Errorf("got compression style %g, want %d", style, pqdifCompressionRecord)
+	}
+
+	records, err := ReadPQDIF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameSamples(t, rec.CFG, records[0].CFG, ScalePrimary)
+}
+
+func TestWritePQDIFRoundTrip(t *testing.T) {
+	rec := testRecord(t, FileTypeBinary)
+	var buf bytes.Buffer
+	if err := rec.WritePQDIF(&buf, PQDIFOptions{Scaling: ScalePrimary}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadPQDIF(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	got := records[0]
+	if got.GetStationName() != rec.GetStationName() || got.GetRecordDeviceId() != rec.GetRecordDeviceId() || got.GetLineFrequency() != rec.GetLineFrequency() {
+		t.Errorf("got station %q device %q line frequency %d", got.GetStationName(), got.GetRecordDeviceId(), got.GetLineFrequency())
+	}
+	if !got.GetStartTime().Equal(rec.GetStartTime()) || !got.GetTriggerTime().Equal(rec.GetTriggerTime()) {
+		t.Errorf("got start %v and trigger %v, want %v and %v", got.GetStartTime(), got.GetTriggerTime(), rec.GetStartTime(), rec.GetTriggerTime())
+	}
+	for _, ch := range rec.GetAnalogChannels() {
+		if back, err := got.GetAnalogChannel(ch.Index); err != nil || back.GetName() != ch.GetName() || back.GetUnit() != ch.GetUnit() || back.GetPhase() != ch.GetPhase() {
+			t.Errorf("got analog channel %+v, %v, want %s", back, err, ch.GetName())
+		}
+	}
+	if back, err := got.GetDigitalChannel(1); err != nil || back.GetName() != "TRIP" {
+		t.Errorf("got digital channel %+v, %v, want TRIP", back, err)
+	}
+	assertSameSamples(t, rec.CFG, got.CFG, ScalePrimary)
+}
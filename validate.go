@@ -0,0 +1,403 @@
+package comgo
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severity of a validation finding
+type Severity uint8
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+/*
+ * Finding - One result of a record validation
+ * @Severity: How serious the finding is
+ * @Code: Stable identifier of the check, e.g. "dat-truncated"
+ * @Message: Human readable description
+ */
+type Finding struct {
+	Severity Severity
+	Code     string
+	Message  string
+}
+
+func (m *Finding) GetSeverity() Severity {
+	if m != nil {
+		return m.Severity
+	}
+	return SeverityInfo
+}
+
+func (m *Finding) GetCode() string {
+	if m != nil {
+		return m.Code
+	}
+	return ""
+}
+
+func (m *Finding) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s", m.Severity, m.Code, m.Message)
+}
+
+/*
+ * Report - Findings of a record validation
+ * @Findings: Findings in the order the checks ran
+ */
+type Report struct {
+	Findings []Finding
+}
+
+func (m *Report) GetFindings() []Finding {
+	if m != nil {
+		return m.Findings
+	}
+	return nil
+}
+
+// Returns true when at least one finding is an error
+func (m *Report) HasErrors() bool {
+	return m.Count(SeverityError) > 0
+}
+
+// Returns the number of findings of the given severity
+func (m *Report) Count(severity Severity) int {
+	var n int
+	for _, f := range m.GetFindings() {
+		if f.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Report) add(severity Severity, code string, format string, args ...interface{}) {
+	m.Findings = append(m.Findings, Finding{severity, code, fmt.Sprintf(format, args...)})
+}
+
+// Time codes as defined by C37.111-2013, e.g. "+10h30", "-4", "0"
+var timeCodePattern = regexp.MustCompile(`^[+-]?(\d{1,2})(?:[ht](\d{1,2})?)?$`)
+
+// Validate checks the parsed .cfg and, when read, the .dat content against C37.111
+// a nil CFG reports a single error finding
+func (cfg *CFG) Validate() *Report {
+	r := &Report{}
+	if cfg == nil {
+		r.add(SeverityError, "cfg-missing", "no configuration, read .cfg first")
+		return r
+	}
+
+	cfg.validateHeader(r)
+	cfg.validateChannels(r)
+	cfg.validateTiming(r)
+	cfg.validateData(r)
+	return r
+}
+
+func (cfg *CFG) validateHeader(r *Report) {
+	switch cfg.GetRevisionYear() {
+	case 0, 1991, 1999, 2013:
+	default:
+		r.add(SeverityWarning, "revision-year", "unknown revision year %d", cfg.GetRevisionYear())
+	}
+
+	switch strings.ToUpper(cfg.GetDataFileType()) {
+	case FileTypeASCII, FileTypeBinary, FileTypeBinary32, FileTypeFloat32:
+	default:
+		r.add(SeverityError, "file-type", "unknown data file type %q", cfg.GetDataFileType())
+	}
+
+	for _, code := range []struct{ name, value string }{{"time code", cfg.GetTimeCode()}, {"local code", cfg.GetLocalCode()}} {
+		if code.value == "" {
+			continue
+		}
+		matches := timeCodePattern.FindStringSubmatch(code.value)
+		if matches == nil {
+			r.add(SeverityError, "time-code", "invalid %s %q", code.name, code.value)
+			continue
+		}
+		hours, _ := strconv.Atoi(matches[1])
+		minutes, _ := strconv.Atoi(matches[2])
+		if hours > 24 || minutes > 59 {
+			r.add(SeverityError, "time-code", "%s %q out of range", code.name, code.value)
+		}
+	}
+}
+
+func (cfg *CFG) validateChannels(r *Report) {
+	analogDetail, digitDetail := cfg.GetAnalogDetail(), cfg.GetDigitDetail()
+	nA, nD := analogDetail.GetChannelTotal(), digitDetail.GetChannelTotal()
+
+	if cfg.GetChannelNumber() != nA+nD {
+		r.add(SeverityError, "channel-count", "total channel number %d differs from %dA + %dD", cfg.GetChannelNumber(), nA, nD)
+	}
+	if len(analogDetail.GetChannels()) != int(nA) {
+		r.add(SeverityError, "channel-count", "%d analog channels defined, %d declared", len(analogDetail.GetChannels()), nA)
+	}
+	if len(digitDetail.GetChannels()) != int(nD) {
+		r.add(SeverityError, "channel-count", "%d digital channels defined, %d declared", len(digitDetail.GetChannels()), nD)
+	}
+
+	seen := make(map[uint16]bool)
+	for _, ch := range analogDetail.GetChannels() {
+		if seen[ch.Number] {
+			r.add(SeverityError, "duplicate-channel", "analog channel number %d is used more than once", ch.Number)
+		}
+		seen[ch.Number] = true
+	}
+	seen = make(map[uint16]bool)
+	for _, ch := range digitDetail.GetChannels() {
+		if seen[ch.Number] {
+			r.add(SeverityError, "duplicate-channel", "digital channel number %d is used more than once", ch.Number)
+		}
+		seen[ch.Number] = true
+		if ch.InitialState > 2 {
+			r.add(SeverityWarning, "initial-state", "digital channel %d (%s) has initial state %d", ch.Index, ch.Name, ch.InitialState)
+		}
+	}
+
+	// Integer data files reserve the most negative value for missing samples
+	var limit int
+	switch strings.ToUpper(cfg.GetDataFileType()) {
+	case FileTypeBinary:
+		limit = -MissingBinary - 1
+	case FileTypeBinary32:
+		limit = -MissingBinary32 - 1
+	}
+	var exceeding []string
+	for _, ch := range analogDetail.GetChannels() {
+		if ch.ValueMin > ch.ValueMax {
+			r.add(SeverityError, "value-range", "analog channel %d (%s) min %d greater than max %d", ch.Index, ch.Name, ch.ValueMin, ch.ValueMax)
+		}
+		if limit != 0 && (ch.ValueMin < -limit || ch.ValueMax > limit) {
+			exceeding = append(exceeding, strconv.Itoa(int(ch.Index)))
+		}
+		if ch.HasRatio && (ch.Primary == 0 || ch.Secondary == 0) {
+			r.add(SeverityWarning, "ratio", "analog channel %d (%s) has ratio %g/%g", ch.Index, ch.Name, ch.Primary, ch.Secondary)
+		}
+	}
+	if len(exceeding) > 0 {
+		r.add(SeverityWarning, "value-range", "analog channels %s declare a range beyond %d..%d, the lowest value marks missing data",
+			strings.Join(exceeding, ","), -limit, limit)
+	}
+}
+
+func (cfg *CFG) validateTiming(r *Report) {
+	sampleDetail := cfg.GetSampleDetail()
+	if len(sampleDetail) == 0 {
+		r.add(SeverityError, "sample-rate", "no sampling rate defined")
+		return
+	}
+
+	last := 0
+	for i, rate := range sampleDetail {
+		if rate.Rate < 0 || (rate.Rate == 0 && len(sampleDetail) > 1) {
+			r.add(SeverityError, "sample-rate", "sampling rate %d is %g Hz", i+1, rate.Rate)
+		}
+		if rate.Number <= last {
+			r.add(SeverityError, "sample-rate", "end sample %d of rate %d does not follow %d", rate.Number, i+1, last)
+		}
+		last = rate.Number
+	}
+
+	if cfg.GetStartTime().IsZero() {
+		r.add(SeverityWarning, "start-time", "start time is not set")
+	}
+	if cfg.GetTriggerTime().Before(cfg.GetStartTime()) {
+		r.add(SeverityError, "trigger-time", "trigger time %s is before start time %s",
+			cfg.GetTriggerTime().Format(TimeFormat), cfg.GetStartTime().Format(TimeFormat))
+	}
+}
+
+func (cfg *CFG) validateData(r *Report) {
+	if len(cfg.GetDataFileContent()) == 0 {
+		r.add(SeverityWarning, "dat-missing", "no data content, only the configuration was checked")
+		return
+	}
+
+	rd, err := cfg.scanDat()
+	if err != nil {
+		r.add(SeverityError, "dat-format", "%v", err)
+		return
+	}
+
+	switch {
+	case rd.present < rd.samples:
+		r.add(SeverityError, "dat-truncated", "data file holds %d of %d samples", rd.present, rd.samples)
+	case rd.present > rd.samples:
+		r.add(SeverityWarning, "dat-size", "data file holds %d samples, %d declared", rd.present, rd.samples)
+	}
+	if rd.recordSize > 0 && len(rd.content)%rd.recordSize != 0 {
+		r.add(SeverityWarning, "dat-size", "data file has %d trailing bytes", len(rd.content)%rd.recordSize)
+	}
+
+	n := rd.present
+	if n > rd.samples {
+		n = rd.samples
+	}
+
+	// Sample numbers should count up by one from 1
+	var gaps, backwards, repeated, missingStamps int
+	stamps := make([]int64, 0, n)
+	var previous, previousStamp int64
+	firstGap, firstBackwards, firstRepeated := -1, -1, -1
+	hasStamp := false
+	for i := 0; i < n; i++ {
+		number, err := rd.getSampleNumber(i)
+		if err != nil {
+			r.add(SeverityError, "dat-format", "%v", err)
+			return
+		}
+		if i == 0 && number != 1 {
+			r.add(SeverityWarning, "sample-number", "first sample number is %d", number)
+		}
+		if i > 0 && number != previous+1 {
+			if gaps++; firstGap < 0 {
+				firstGap = i
+			}
+		}
+		previous = number
+
+		stamp, ok, err := rd.getTimestamp(i)
+		if err != nil {
+			r.add(SeverityError, "dat-format", "%v", err)
+			return
+		}
+		if !ok {
+			missingStamps++
+			continue
+		}
+		switch {
+		case hasStamp && stamp < previousStamp:
+			if backwards++; firstBackwards < 0 {
+				firstBackwards = i
+			}
+		case hasStamp && stamp == previousStamp:
+			if repeated++; firstRepeated < 0 {
+				firstRepeated = i
+			}
+		}
+		previousStamp, hasStamp = stamp, true
+		stamps = append(stamps, stamp)
+	}
+	if gaps > 0 {
+		r.add(SeverityWarning, "sample-number", "%d discontinuities in sample numbers, first at sample %d", gaps, firstGap+1)
+	}
+	if backwards > 0 {
+		// Time stamps are only authoritative without a fixed sampling rate
+		severity := SeverityWarning
+		if cfg.GetSamplingRate() == 0 {
+			severity = SeverityError
+		}
+		r.add(severity, "timestamp", "time stamps go backwards %d times, first at sample %d", backwards, firstBackwards+1)
+	}
+	// Recorders with a fixed sampling rate often write the same time stamp in every sample
+	if repeated > 0 && cfg.GetSamplingRate() == 0 {
+		r.add(SeverityError, "timestamp", "%d samples repeat the time stamp of the previous one, first at sample %d", repeated, firstRepeated+1)
+	}
+	if missingStamps > 0 {
+		severity := SeverityInfo
+		if cfg.GetSamplingRate() == 0 {
+			severity = SeverityError
+		}
+		r.add(severity, "timestamp", "%d samples have no time stamp", missingStamps)
+	}
+	if cfg.GetSamplingRate() > 0 && missingStamps == 0 && backwards == 0 && n == rd.samples {
+		cfg.validateStamps(r, rd, stamps)
+	}
+
+	// Recorded values should stay inside the declared range
+	if rd.fileType == FileTypeBinary || rd.fileType == FileTypeBinary32 {
+		for idx, ch := range cfg.GetAnalogChannels() {
+			var outside, missing int
+			for i := 0; i < n; i++ {
+				value, _ := rd.getAnalog(i, idx)
+				switch {
+				case math.IsNaN(value):
+					missing++
+				case value < float64(ch.ValueMin) || value > float64(ch.ValueMax):
+					outside++
+				}
+			}
+			if outside > 0 {
+				r.add(SeverityWarning, "value-range", "analog channel %d (%s) has %d samples outside %d..%d", ch.Index, ch.Name, outside, ch.ValueMin, ch.ValueMax)
+			}
+			if missing > 0 {
+				r.add(SeverityInfo, "missing-data", "analog channel %d (%s) has %d missing samples", ch.Index, ch.Name, missing)
+			}
+		}
+	}
+
+	if n < rd.samples {
+		return
+	}
+	times, err := cfg.sampleTimes(rd)
+	if err != nil {
+		r.add(SeverityError, "timestamp", "%v", err)
+		return
+	}
+	if len(times) > 0 {
+		end := cfg.GetStartTime().Add(time.Duration(times[len(times)-1] * float64(time.Second)))
+		if cfg.GetTriggerTime().After(end) {
+			r.add(SeverityError, "trigger-time", "trigger time %s is after the last sample %s",
+				cfg.GetTriggerTime().Format(TimeFormat), end.Format(TimeFormat))
+		}
+	}
+}
+
+// Time stamps are optional with a fixed sampling rate, when given they should agree with it
+// within a sample period, measured from the first time stamp
+func (cfg *CFG) validateStamps(r *Report, rd *datReader, stamps []int64) {
+	times, err := cfg.sampleTimes(rd)
+	// Recorders not time stamping samples write the same value, usually 0, in every sample
+	if err != nil || len(times) != len(stamps) || len(stamps) < 2 || stamps[len(stamps)-1] == stamps[0] {
+		return
+	}
+	factor := cfg.GetTimeFactor()
+	if factor == 0 {
+		factor = 1
+	}
+	var drifting int
+	var worst float64
+	first := -1
+	for i := 1; i < len(times); i++ {
+		deviation := math.Abs(float64(stamps[i]-stamps[0])*factor*1e-6 - times[i])
+		if deviation > times[i]-times[i-1] {
+			if drifting++; first < 0 {
+				first = i
+			}
+		}
+		worst = math.Max(worst, deviation)
+	}
+	if drifting > 0 {
+		r.add(SeverityWarning, "timestamp-drift", "%d time stamps differ from the sampling rate by more than a sample period, first at sample %d, up to %.6f s",
+			drifting, first+1, worst)
+	}
+}
@@ -0,0 +1,99 @@
+package comgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the severity and code of every finding
+func findingCodes(r *Report) []string {
+	var codes []string
+	for _, f := range r.GetFindings() {
+		codes = append(codes, f.Severity.String()+" "+f.Code)
+	}
+	return codes
+}
+
+func TestValidate(t *testing.T) {
+	// Samples of VA and TRIP at 1 kHz, as testDatCFG declares them
+	const dat = "1,0,10,0\n2,1000,12,0\n3,2000,-4,1\n"
+	timeStamped := func(cfg *CFG) {
+		cfg.SampleDetail = []SampleRate{{0, 3}}
+	}
+	binaryDAT := func(stored ...float64) []byte {
+		return testBinaryDAT(2, stored, func(b []byte, v float64) {
+			binary.LittleEndian.PutUint16(b, uint16(int16(v)))
+		})
+	}
+
+	for _, tc := range []struct {
+		name     string
+		fileType string
+		dat      []byte
+		change   func(cfg *CFG)
+		want     []string
+	}{
+		{"valid", FileTypeASCII, []byte(dat), nil, nil},
+		{"no data", FileTypeASCII, nil, nil, []string{"warning dat-missing"}},
+		{"revision year", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.RevisionYear = 2005 }, []string{"warning revision-year"}},
+		{"file type", FileTypeASCII, nil, func(cfg *CFG) { cfg.DataFileType = "HEX" }, []string{"error file-type", "warning dat-missing"}},
+		{"invalid time code", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.TimeCode = "UTC" }, []string{"error time-code"}},
+		{"time code out of range", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.TimeCode, cfg.LocalCode = "+10h30", "-25" }, []string{"error time-code"}},
+		{"channel count", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.ChannelNumber = 3 }, []string{"error channel-count"}},
+		{"initial state", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.DigitDetail.Channels[0].InitialState = 3 }, []string{"warning initial-state"}},
+		{"min above max", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.AnalogDetail.Channels[0].ValueMin = 40000 }, []string{"error value-range"}},
+		{"range with the missing sample marker", FileTypeBinary, binaryDAT(1, 2, 3), func(cfg *CFG) { cfg.AnalogDetail.Channels[0].ValueMin = -32768 }, []string{"warning value-range"}},
+		{"zero ratio", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.AnalogDetail.Channels[0].Secondary = 0 }, []string{"warning ratio"}},
+		{"no sampling rate", FileTypeASCII, nil, func(cfg *CFG) { cfg.SampleDetail = nil }, []string{"error sample-rate", "warning dat-missing"}},
+		{"end samples", FileTypeASCII, nil, func(cfg *CFG) { cfg.SampleDetail = []SampleRate{{1000, 3}, {500, 3}} }, []string{"error sample-rate", "warning dat-missing"}},
+		{"no start time", FileTypeASCII, nil, func(cfg *CFG) { cfg.StartTime, cfg.TriggerTime = time.Time{}, time.Time{} }, []string{"warning start-time", "warning dat-missing"}},
+		{"trigger before start", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.TriggerTime = cfg.StartTime.Add(-time.Second) }, []string{"error trigger-time"}},
+		{"trigger after the last sample", FileTypeASCII, []byte(dat), func(cfg *CFG) { cfg.TriggerTime = cfg.StartTime.Add(time.Second) }, []string{"error trigger-time"}},
+		{"truncated", FileTypeASCII, []byte("1,0,10,0\n2,1000,12,0\n"), nil, []string{"error dat-truncated"}},
+		{"extra samples", FileTypeASCII, []byte(dat + "4,3000,1,1\n"), nil, []string{"warning dat-size"}},
+		{"trailing bytes", FileTypeBinary, append(binaryDAT(1, 2, 3), 0), nil, []string{"warning dat-size"}},
+		{"bad field", FileTypeASCII, []byte("1,0,10,0\n2,1000,x,0\n3,2000,-4\n"), nil, []string{"error dat-format"}},
+		{"first sample number", FileTypeASCII, []byte("0,0,10,0\n1,1000,12,0\n2,2000,-4,1\n"), nil, []string{"warning sample-number"}},
+		{"sample gap", FileTypeASCII, []byte("1,0,10,0\n2,1000,12,0\n4,2000,-4,1\n"), nil, []string{"warning sample-number"}},
+		{"backward time stamps with a sampling rate", FileTypeASCII, []byte("1,0,10,0\n2,2000,12,0\n3,1000,-4,1\n"), nil, []string{"warning timestamp"}},
+		{"backward time stamps", FileTypeASCII, []byte("1,0,10,0\n2,2000,12,0\n3,1000,-4,1\n"), timeStamped, []string{"error timestamp"}},
+		{"repeated time stamps", FileTypeASCII, []byte("1,0,10,0\n2,1000,12,0\n3,1000,-4,1\n"), timeStamped, []string{"error timestamp"}},
+		{"same time stamp with a sampling rate", FileTypeASCII, []byte("1,0,10,0\n2,0,12,0\n3,0,-4,1\n"), nil, nil},
+		{"missing time stamps with a sampling rate", FileTypeASCII, []byte("1,,10,0\n2,,12,0\n3,,-4,1\n"), nil, []string{"info timestamp"}},
+		{"missing time stamps", FileTypeASCII, []byte("1,0,10,0\n2,,12,0\n3,2000,-4,1\n"), timeStamped, []string{"error timestamp", "error timestamp"}},
+		{"time stamp drift", FileTypeASCII, []byte("1,0,10,0\n2,1000,12,0\n3,5000,-4,1\n"), nil, []string{"warning timestamp-drift"}},
+		{"values outside the range", FileTypeBinary, binaryDAT(1, 200, 3), func(cfg *CFG) { cfg.AnalogDetail.Channels[0].ValueMax = 100 }, []string{"warning value-range"}},
+		{"missing values", FileTypeBinary, binaryDAT(1, MissingBinary, 3), nil, []string{"info missing-data"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewCFG()
+			if err := cfg.ReadCFG(strings.NewReader(fmt.Sprintf(testDatCFG, tc.fileType))); err != nil {
+				t.Fatal(err)
+			}
+			if tc.dat != nil {
+				if err := cfg.ReadDAT(bytes.NewReader(tc.dat)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.change != nil {
+				tc.change(&cfg)
+			}
+			r := cfg.Validate()
+			if got := findingCodes(r); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got findings %q, want %q", r.GetFindings(), tc.want)
+			}
+			if wantErrors := strings.Contains(strings.Join(tc.want, ","), "error"); r.HasErrors() != wantErrors {
+				t.Errorf("HasErrors() = %v, want %v", r.HasErrors(), wantErrors)
+			}
+		})
+	}
+
+	if r := (*CFG)(nil).Validate(); !reflect.DeepEqual(findingCodes(r), []string{"error cfg-missing"}) {
+		t.Errorf("got findings %q for a nil configuration", r.GetFindings())
+	}
+}
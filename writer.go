@@ -0,0 +1,360 @@
+package comgo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Date and time format of the start and trigger lines of the .cfg file
+const cfgTimeFormat = "02/01/2006,15:04:05.000000"
+
+// Largest magnitude of the integer codes written for each data file type,
+// ASCII follows the -99999 to 99999 range of C37.111-1999
+var analogCodeLimit = map[string]float64{
+	FileTypeASCII:    99999,
+	FileTypeBinary:   32767,
+	FileTypeBinary32: 2147483647,
+}
+
+// Returns the sampling rates matching the sample times: a single rate when samples
+// are evenly spaced, a rate of 0 otherwise so that time stamps are used
+func inferRates(times []float64) []SampleRate {
+	n := len(times)
+	if n < 2 {
+		return []SampleRate{{Rate: 0, Number: n}}
+	}
+	step := (times[n-1] - times[0]) / float64(n-1)
+	if step <= 0 {
+		return []SampleRate{{Rate: 0, Number: n}}
+	}
+	for i := 1; i < n; i++ {
+		if math.Abs(times[i]-times[i-1]-step) > step*1e-3 {
+			return []SampleRate{{Rate: 0, Number: n}}
+		}
+	}
+	// Rounding keeps rates such as 5760 Hz exact despite the time resolution of the source
+	return []SampleRate{{Rate: math.Round(1e6/step) / 1e6, Number: n}}
+}
+
+// Returns conversion factors mapping values to integer codes of at most limit,
+// with the range of codes used
+func analogFactors(values []float64, limit float64) (a, b float64, min, max int) {
+	var peak float64
+	for _, v := range values {
+		if !math.IsNaN(v) && math.Abs(v) > peak {
+			peak = math.Abs(v)
+		}
+	}
+	a = 1
+	if peak > 0 {
+		a = peak / limit
+	}
+	first := true
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		code := int(math.Round(v / a))
+		if first || code < min {
+			min = code
+		}
+		if first || code > max {
+			max = code
+		}
+		first = false
+	}
+	return a, 0, min, max
+}
+
+// Updates the conversion factors and value range of analog channel idx (0-based)
+func (m *ChannelA) setFactors(idx int, a, b float64, min, max int) {
+	m.Channels[idx].FactorA, m.Channels[idx].FactorB = a, b
+	m.Channels[idx].ValueMin, m.Channels[idx].ValueMax = min, max
+	m.ConversionFactors["a"][idx], m.ConversionFactors["b"][idx] = a, b
+	m.ValueMin[idx], m.ValueMax[idx] = min, max
+}
+
+// SetSamples encodes sample values into the data file content of a record whose channels
+// are defined, e.g. with AddChannel, and updates the .cfg parameters to match:
+// conversion factors and value ranges are chosen per channel to fit the data file type
+// (BINARY when not set), and sampling rates are inferred from times when not set.
+// times are the offsets of the samples from the start time in seconds, analog and digital
+// hold the values of every channel in .cfg order, NaN marks a missing analog sample
+func (cfg *CFG) SetSamples(times []float64, analog [][]float64, digital [][]uint8) error {
+	if cfg.AnalogDetail == nil {
+		cfg.AnalogDetail = &ChannelA{}
+	}
+	if cfg.DigitDetail == nil {
+		cfg.DigitDetail = &ChannelD{}
+	}
+	chA, chD := cfg.AnalogDetail, cfg.DigitDetail
+	// Channels defined through the per field slices only are grouped first
+	chA.setChannels(chA.GetChannels())
+	chD.setChannels(chD.GetChannels())
+	if len(analog) != len(chA.Channels) || len(digital) != len(chD.Channels) {
+		return fmt.Errorf("got %d analog and %d digital channels, expected %d and %d",
+			len(analog), len(digital), len(chA.Channels), len(chD.Channels))
+	}
+	n := len(times)
+	for i, values := range analog {
+		if len(values) != n {
+			return fmt.Errorf("analog channel %d has %d samples, expected %d", i+1, len(values), n)
+		}
+	}
+	for i, states := range digital {
+		if len(states) != n {
+			return fmt.Errorf("digital channel %d has %d samples, expected %d", i+1, len(states), n)
+		}
+	}
+
+	cfg.DataFileType = strings.ToUpper(cfg.DataFileType)
+	switch cfg.DataFileType {
+	case "":
+		cfg.DataFileType = FileTypeBinary
+	case FileTypeASCII, FileTypeBinary, FileTypeBinary32, FileTypeFloat32:
+	default:
+		return fmt.Errorf("unsupported data file type %q", cfg.DataFileType)
+	}
+	if cfg.RevisionYear == 0 {
+		cfg.RevisionYear = 1999
+	}
+	if cfg.DataFileType == FileTypeFloat32 && cfg.RevisionYear < 2013 {
+		cfg.RevisionYear = 2013
+	}
+	if cfg.TimeFactor == 0 {
+		cfg.TimeFactor = 1
+	}
+	if len(cfg.SampleDetail) == 0 {
+		cfg.SampleDetail = inferRates(times)
+	}
+	if total := cfg.getTotalSamples(); total != n {
+		return fmt.Errorf("sampling rates end at sample %d, got %d samples", total, n)
+	}
+	cfg.SampleRateNum = uint16(len(cfg.SampleDetail))
+	chA.ChannelTotal, chD.ChannelTotal = uint16(len(chA.Channels)), uint16(len(chD.Channels))
+	cfg.ChannelNumber = chA.ChannelTotal + chD.ChannelTotal
+
+	// Time stamps are in microseconds divided by the time factor
+	stamps := make([]int64, n)
+	for i, t := range times {
+		stamps[i] = int64(math.Round(t * 1e6 / cfg.TimeFactor))
+		if stamps[i] < 0 || (cfg.DataFileType != FileTypeASCII && stamps[i] >= math.MaxUint32) {
+			return fmt.Errorf("time stamp of sample %d out of range", i+1)
+		}
+	}
+
+	for i, values := range analog {
+		if cfg.DataFileType == FileTypeFloat32 {
+			min, max := math.Inf(1), math.Inf(-1)
+			for _, v := range values {
+				if !math.IsNaN(v) {
+					min, max = math.Min(min, v), math.Max(max, v)
+				}
+			}
+			if min > max {
+				min, max = 0, 0
+			}
+			chA.setFactors(i, 1, 0, int(math.Floor(min)), int(math.Ceil(max)))
+			continue
+		}
+		a, b, min, max := analogFactors(values, analogCodeLimit[cfg.DataFileType])
+		chA.setFactors(i, a, b, min, max)
+	}
+
+	code := func(ch, i int) float64 {
+		return math.Round((analog[ch][i] - chA.Channels[ch].FactorB) / chA.Channels[ch].FactorA)
+	}
+
+	if cfg.DataFileType == FileTypeASCII {
+		var b []byte
+		for i := 0; i < n; i++ {
+			b = strconv.AppendInt(b, int64(i+1), 10)
+			b = append(b, ',')
+			b = strconv.AppendInt(b, stamps[i], 10)
+			for ch := range analog {
+				b = append(b, ',')
+				if !math.IsNaN(analog[ch][i]) {
+					b = strconv.AppendFloat(b, code(ch, i), 'f', 0, 64)
+				}
+			}
+			for ch := range digital {
+				b = append(b, ',')
+				b = strconv.AppendUint(b, uint64(digital[ch][i]&1), 10)
+			}
+			b = append(b, '\r', '\n')
+		}
+		cfg.DataFileContent = b
+		return nil
+	}
+
+	analogSize := 4
+	if cfg.DataFileType == FileTypeBinary {
+		analogSize = 2
+	}
+	recordSize := 8 + len(analog)*analogSize + (len(digital)+15)/16*2
+	content := make([]byte, n*recordSize)
+	for i := 0; i < n; i++ {
+		record := content[i*recordSize:]
+		binary.LittleEndian.PutUint32(record, uint32(i+1))
+		binary.LittleEndian.PutUint32(record[4:], uint32(stamps[i]))
+		for ch := range analog {
+			offset := 8 + ch*analogSize
+			v := analog[ch][i]
+			switch cfg.DataFileType {
+			case FileTypeBinary:
+				value := int16(MissingBinary)
+				if !math.IsNaN(v) {
+					value = int16(code(ch, i))
+				}
+				binary.LittleEndian.PutUint16(record[offset:], uint16(value))
+			case FileTypeBinary32:
+				value := int32(MissingBinary32)
+				if !math.IsNaN(v) {
+					value = int32(code(ch, i))
+				}
+				binary.LittleEndian.PutUint32(record[offset:], uint32(value))
+			case FileTypeFloat32:
+				binary.LittleEndian.PutUint32(record[offset:], math.Float32bits(float32(v)))
+			}
+		}
+		for ch := range digital {
+			offset := 8 + len(analog)*analogSize + ch/16*2
+			word := binary.LittleEndian.Uint16(record[offset:]) | uint16(digital[ch][i]&1)<<uint(ch%16)
+			binary.LittleEndian.PutUint16(record[offset:], word)
+		}
+	}
+	cfg.DataFileContent = content
+	return nil
+}
+
+// Formats a number of the .cfg file
+func formatCFGFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteCFG writes the configuration as a .cfg file
+// the time code line is only written for revision 2013 and later
+func (cfg *CFG) WriteCFG(w io.Writer) error {
+	if cfg == nil {
+		return errors.New("invalid cfg file")
+	}
+	bw := bufio.NewWriter(w)
+	line := func(fields ...string) {
+		bw.WriteString(strings.Join(fields, ","))
+		bw.WriteString("\r\n")
+	}
+
+	revision := cfg.GetRevisionYear()
+	if revision == 0 {
+		revision = 1999
+	}
+	analog, digital := cfg.GetAnalogChannels(), cfg.GetDigitalChannels()
+	line(cfg.GetStationName(), cfg.GetRecordDeviceId(), strconv.Itoa(int(revision)))
+	line(strconv.Itoa(len(analog)+len(digital)), strconv.Itoa(len(analog))+"A", strconv.Itoa(len(digital))+"D")
+
+	for _, ch := range analog {
+		name := ch.OriginalName
+		if name == "" {
+			name = ch.Name
+		}
+		primary, secondary := 1.0, 1.0
+		if ch.HasRatio {
+			primary, secondary = ch.Primary, ch.Secondary
+		}
+		line(strconv.Itoa(int(ch.Number)), name, ch.Phase, ch.Element, ch.Unit,
+			formatCFGFloat(ch.FactorA), formatCFGFloat(ch.FactorB), formatCFGFloat(ch.TimeFactor),
+			strconv.Itoa(ch.ValueMin), strconv.Itoa(ch.ValueMax),
+			formatCFGFloat(primary), formatCFGFloat(secondary), ch.GetPS())
+	}
+	for _, ch := range digital {
+		name := ch.OriginalName
+		if name == "" {
+			name = ch.Name
+		}
+		line(strconv.Itoa(int(ch.Number)), name, ch.Phase, ch.Element, strconv.Itoa(int(ch.InitialState)))
+	}
+
+	line(strconv.Itoa(int(cfg.GetLineFrequency())))
+	rates := cfg.GetSampleDetail()
+	// A single rate of 0 is written as 0 rates, samples are then time stamped
+	if len(rates) == 1 && rates[0].Rate == 0 {
+		line("0")
+	} else {
+		line(strconv.Itoa(len(rates)))
+	}
+	for _, rate := range rates {
+		line(formatCFGFloat(rate.Rate), strconv.Itoa(rate.Number))
+	}
+	line(cfg.GetStartTime().Format(cfgTimeFormat))
+	line(cfg.GetTriggerTime().Format(cfgTimeFormat))
+	line(cfg.GetDataFileType())
+	timeFactor := cfg.GetTimeFactor()
+	if timeFactor == 0 {
+		timeFactor = 1
+	}
+	line(formatCFGFloat(timeFactor))
+	if revision >= 2013 {
+		timeCode, localCode := cfg.GetTimeCode(), cfg.GetLocalCode()
+		if timeCode == "" {
+			timeCode = "0"
+		}
+		if localCode == "" {
+			localCode = timeCode
+		}
+		line(timeCode, localCode)
+		line("0", "0")
+	}
+	return bw.Flush()
+}
+
+// WriteDAT writes the data file content
+func (cfg *CFG) WriteDAT(w io.Writer) error {
+	if len(cfg.GetDataFileContent()) == 0 {
+		return errors.New("not data content, read .dat first")
+	}
+	_, err := w.Write(cfg.GetDataFileContent())
+	return err
+}
+
+// Save writes the record as name.cfg and name.dat, with name.hdr and name.inf
+// when the record has a header or information file
+func (m *Record) Save(name string) error {
+	if err := writeFile(name+ExtCFG, m.WriteCFG); err != nil {
+		return err
+	}
+	if err := writeFile(name+ExtDAT, m.WriteDAT); err != nil {
+		return err
+	}
+	for ext, content := range map[string][]byte{ExtHDR: m.GetHeader(), ExtINF: m.GetInfo()} {
+		if len(content) == 0 {
+			continue
+		}
+		if err := writeFile(name+ext, func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates the file name and hands it to write
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}